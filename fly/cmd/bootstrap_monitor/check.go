@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"go.uber.org/zap"
+)
+
+// Reasons a check failed, from the earliest step that failed.
+const (
+	failureInvalidPeer = "invalid_peer"
+	failureDNS         = "dns"
+	failureHost        = "host"
+	failureDialTimeout = "dial_timeout"
+	failureDial        = "dial_error"
+	failureNoGossip    = "no_gossip"
+)
+
+// peerResult is the outcome of checking one bootstrap peer.
+type peerResult struct {
+	bootstrap string
+	connected bool
+	// timeToConnect is from the start of the check until the host was connected to the bootstrap peer.
+	timeToConnect time.Duration
+	// rtt is the round trip time to the bootstrap peer measured with libp2p ping, 0 if unknown.
+	rtt       time.Duration
+	heartbeat bool
+	// timeToHeartbeat is from the start of the check until the first heartbeat was received.
+	timeToHeartbeat time.Duration
+	// peersLearned counts the peers other than the bootstrap peer the host knows addresses of at the end of the check.
+	peersLearned int
+	// guardians counts the distinct guardians of the set verified heartbeats were received from.
+	guardians int
+	// failure is one of the failure reasons, empty if a heartbeat was received.
+	failure string
+	err     error
+}
+
+// peerChecker checks one bootstrap peer with a host of its own, on its own port and with its own node key,
+// so the checks of different peers can run concurrently without seeing each other.
+type peerChecker struct {
+	logger    *zap.Logger
+	bootstrap string
+	port      uint
+	priv      crypto.PrivKey
+	// gs is the guardian set heartbeats are verified against, so heartbeats of other peers don't count.
+	gs *node_common.GuardianSet
+	// lastSuccess is when a heartbeat was last received. It is only used between rounds.
+	lastSuccess time.Time
+}
+
+// connectResult is the outcome of dialing the bootstrap peer.
+type connectResult struct {
+	err     error
+	elapsed time.Duration
+	rtt     time.Duration
+}
+
+// check bootstraps from the peer only and listens to heartbeats until the timeout expires.
+// The host is closed when it returns, so the port can be used again by the next round.
+func (c *peerChecker) check(ctx context.Context, timeout time.Duration) peerResult {
+	r := peerResult{bootstrap: c.bootstrap}
+	info, err := peer.AddrInfoFromString(c.bootstrap)
+	if err != nil {
+		r.failure, r.err = failureInvalidPeer, err
+		return r
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	start := time.Now()
+	if err := resolve(ctx, net.DefaultResolver, info.Addrs); err != nil {
+		cancel()
+		r.failure, r.err = failureDNS, err
+		return r
+	}
+	l, err := gossip.NewListener(ctx, c.logger, gossip.ListenerConfig{
+		NetworkID: p2pNetworkID,
+		Bootstrap: c.bootstrap,
+		Port:      c.port,
+		Priv:      c.priv,
+		Topics:    []string{"control"},
+	})
+	if err != nil {
+		cancel()
+		r.failure, r.err = failureHost, err
+		return r
+	}
+	defer func() {
+		cancel()
+		l.Close()
+	}()
+
+	connectC := make(chan connectResult, 1)
+	go func() {
+		connectC <- connect(ctx, l.Host(), *info, start)
+	}()
+
+	hbs := newHeartbeats(c.logger, c.gs, start)
+	go l.Run(ctx, hbs.handle)
+
+	// Listen for the whole timeout, to count the guardians heard and the peers learned through the bootstrap peer.
+	var conn connectResult
+	select {
+	case conn = <-connectC:
+		<-ctx.Done()
+	case <-ctx.Done():
+		conn = connectResult{err: ctx.Err()}
+	}
+
+	for _, p := range l.Host().Peerstore().PeersWithAddrs() {
+		if p != l.Host().ID() && p != info.ID {
+			r.peersLearned++
+		}
+	}
+	r.connected, r.timeToConnect, r.rtt = conn.err == nil, conn.elapsed, conn.rtt
+	r.heartbeat, r.timeToHeartbeat, r.guardians = hbs.result()
+	r.failure, r.err = classifyFailure(conn.err, r.heartbeat)
+	return r
+}
+
+// heartbeats records the verified heartbeats of the guardian set received during a check.
+type heartbeats struct {
+	logger *zap.Logger
+	gs     *node_common.GuardianSet
+	start  time.Time
+
+	mu sync.Mutex
+	// first is the time from the start of the check until the first heartbeat.
+	first     time.Duration
+	guardians map[eth_common.Address]bool
+}
+
+func newHeartbeats(logger *zap.Logger, gs *node_common.GuardianSet, start time.Time) *heartbeats {
+	return &heartbeats{logger: logger, gs: gs, start: start, guardians: map[eth_common.Address]bool{}}
+}
+
+func (h *heartbeats) handle(_ context.Context, e *gossip.Envelope) {
+	if e.Msg == nil || e.Msg.GetSignedHeartbeat() == nil {
+		return
+	}
+	if _, err := gossip.VerifyHeartbeat(e.Msg.GetSignedHeartbeat(), h.gs, e.From); err != nil {
+		h.logger.Debug("invalid heartbeat", zap.String("from", e.From.String()), zap.Error(err))
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.guardians) == 0 {
+		h.first = e.ReceivedAt.Sub(h.start)
+	}
+	h.guardians[eth_common.BytesToAddress(e.Msg.GetSignedHeartbeat().GuardianAddr)] = true
+}
+
+// result returns whether a heartbeat was received, the time until the first one and the number of guardians heard.
+func (h *heartbeats) result() (bool, time.Duration, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.guardians) > 0, h.first, len(h.guardians)
+}
+
+// classifyFailure returns the failure reason of a check that got as far as dialing, or an empty reason if the check
+// succeeded, along with the connection error. The connection may fail after a heartbeat was received, which is
+// still a success: the bootstrap peer did its job.
+func classifyFailure(connErr error, heartbeat bool) (string, error) {
+	switch {
+	case heartbeat:
+		return "", connErr
+	case errors.Is(connErr, context.DeadlineExceeded):
+		return failureDialTimeout, connErr
+	case connErr != nil:
+		return failureDial, connErr
+	default:
+		return failureNoGossip, nil
+	}
+}
+
+// connect dials the peer, which the host may already be doing, and measures the round trip time once connected.
+func connect(ctx context.Context, h host.Host, info peer.AddrInfo, start time.Time) connectResult {
+	if err := h.Connect(ctx, info); err != nil {
+		return connectResult{err: err}
+	}
+	r := connectResult{elapsed: time.Since(start)}
+	if res := <-ping.Ping(ctx, h, info.ID); res.Error == nil {
+		r.rtt = res.RTT
+	}
+	return r
+}
+
+// ipResolver is implemented by net.Resolver.
+type ipResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// resolve checks that the DNS names of the addresses resolve, so DNS failures are told apart from dial failures.
+func resolve(ctx context.Context, resolver ipResolver, addrs []ma.Multiaddr) error {
+	for _, addr := range addrs {
+		for _, code := range []int{ma.P_DNS, ma.P_DNS4, ma.P_DNS6} {
+			name, err := addr.ValueForProtocol(code)
+			if err != nil {
+				continue
+			}
+			if _, err := resolver.LookupIPAddr(ctx, name); err != nil {
+				return fmt.Errorf("failed to resolve %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
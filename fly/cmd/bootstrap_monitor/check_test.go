@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"go.uber.org/zap"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	dialErr := errors.New("connection refused")
+	timeout := fmt.Errorf("failed to dial: %w", context.DeadlineExceeded)
+	for _, c := range []struct {
+		name      string
+		connErr   error
+		heartbeat bool
+		want      string
+		wantErr   error
+	}{
+		{"heartbeat", nil, true, "", nil},
+		{"heartbeat after the connection failed", dialErr, true, "", dialErr},
+		{"connected without gossip", nil, false, failureNoGossip, nil},
+		{"dial timeout", timeout, false, failureDialTimeout, timeout},
+		{"dial error", dialErr, false, failureDial, dialErr},
+		{"cancelled", context.Canceled, false, failureDial, context.Canceled},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := classifyFailure(c.connErr, c.heartbeat)
+			if got != c.want || err != c.wantErr {
+				t.Errorf("classifyFailure(%v, %v) = %q, %v, want %q, %v", c.connErr, c.heartbeat, got, err, c.want, c.wantErr)
+			}
+		})
+	}
+}
+
+// fakeResolver resolves the names it knows, and records every lookup.
+type fakeResolver struct {
+	known   map[string]bool
+	lookups []string
+}
+
+func (r *fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups = append(r.lookups, host)
+	if !r.known[host] {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []net.IPAddr{{IP: net.IPv4(127, 0, 0, 1)}}, nil
+}
+
+func TestResolve(t *testing.T) {
+	addrs := func(t *testing.T, ss ...string) []ma.Multiaddr {
+		var out []ma.Multiaddr
+		for _, s := range ss {
+			a, err := ma.NewMultiaddr(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, a)
+		}
+		return out
+	}
+	for _, c := range []struct {
+		name        string
+		addrs       []string
+		wantLookups []string
+		wantErr     string
+	}{
+		{"ip only", []string{"/ip4/10.0.0.1/udp/8999/quic-v1"}, nil, ""},
+		{"dns names", []string{"/dns/a.example/udp/8999/quic-v1", "/dns4/b.example/udp/8999/quic-v1", "/dns6/c.example/udp/8999/quic-v1"}, []string{"a.example", "b.example", "c.example"}, ""},
+		{"unknown name", []string{"/ip4/10.0.0.1/udp/8999/quic-v1", "/dns/unknown.example/udp/8999/quic-v1", "/dns/a.example/udp/8999/quic-v1"}, []string{"unknown.example"}, "failed to resolve unknown.example"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := &fakeResolver{known: map[string]bool{"a.example": true, "b.example": true, "c.example": true}}
+			err := resolve(context.Background(), r, addrs(t, c.addrs...))
+			if c.wantErr == "" && err != nil {
+				t.Errorf("resolve failed: %v", err)
+			}
+			if c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)) {
+				t.Errorf("resolve returned %v, want %q", err, c.wantErr)
+			}
+			if fmt.Sprint(r.lookups) != fmt.Sprint(c.wantLookups) {
+				t.Errorf("looked up %v, want %v", r.lookups, c.wantLookups)
+			}
+		})
+	}
+}
+
+func TestHeartbeats(t *testing.T) {
+	g, outsider := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	gs := &node_common.GuardianSet{Keys: []eth_common.Address{g.Addr}, Index: 4}
+	start := time.Now()
+	h := newHeartbeats(zap.NewNop(), gs, start)
+
+	// Heartbeats of peers outside the guardian set don't count, however well signed.
+	h.handle(context.Background(), gossiptest.Envelope(t, outsider.Peer, "control", start.Add(time.Second), outsider.Heartbeat(t, &gossipv1.Heartbeat{Counter: 1})))
+	if ok, _, n := h.result(); ok || n != 0 {
+		t.Fatalf("result after an outsider's heartbeat = %v, %d guardians, want no heartbeat", ok, n)
+	}
+
+	forged := g.Heartbeat(t, &gossipv1.Heartbeat{Counter: 1})
+	forged.GetSignedHeartbeat().Signature = outsider.Heartbeat(t, &gossipv1.Heartbeat{Counter: 1}).GetSignedHeartbeat().Signature
+	h.handle(context.Background(), gossiptest.Envelope(t, outsider.Peer, "control", start.Add(2*time.Second), forged))
+	h.handle(context.Background(), gossiptest.Envelope(t, g.Peer, "control", start.Add(3*time.Second), g.Heartbeat(t, &gossipv1.Heartbeat{Counter: 1})))
+	h.handle(context.Background(), gossiptest.Envelope(t, g.Peer, "control", start.Add(4*time.Second), g.Heartbeat(t, &gossipv1.Heartbeat{Counter: 2})))
+	ok, first, n := h.result()
+	if !ok || first != 3*time.Second || n != 1 {
+		t.Errorf("result = %v, %s, %d guardians, want the first heartbeat of the guardian after 3s", ok, first, n)
+	}
+}
@@ -5,34 +5,35 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/certusone/wormhole/node/pkg/common"
 	"github.com/certusone/wormhole/node/pkg/p2p"
-	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
-	promremotew "github.com/certusone/wormhole/node/pkg/telemetry/prom_remote_write"
 	ipfslog "github.com/ipfs/go-log/v2"
 	"github.com/joho/godotenv"
-	pubsub "github.com/libp2p/go-libp2p-pubsub"
-	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/utils"
 	"go.uber.org/zap"
-	"google.golang.org/protobuf/proto"
 )
 
 var (
 	rootCtx       context.Context
 	rootCtxCancel context.CancelFunc
-	hbReceived    bool
 	// The following are from the .env file:
 	p2pNetworkID  string
 	p2pPort       uint
 	nodeKeyPath   string
 	logLevel      string
-	promRemoteURL string
+	metricsConfig metrics.Config
+	roundInterval time.Duration
+	checkTimeout  time.Duration
 )
 
 var (
@@ -41,6 +42,41 @@ var (
 			Name: "bootstrap_peer_status",
 			Help: "Bootstrap peer status (1 = received heartbeat, 0 = no heartbeat)",
 		}, []string{"bootstrap_peer"})
+	bootstrapPeerTimeToConnect = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bootstrap_peer_time_to_connect_seconds",
+			Help: "Time from the start of the last check until connected to the bootstrap peer, absent if it did not connect",
+		}, []string{"bootstrap_peer"})
+	bootstrapPeerTimeToHeartbeat = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bootstrap_peer_time_to_first_heartbeat_seconds",
+			Help: "Time from the start of the last check until the first heartbeat was received, absent if none was",
+		}, []string{"bootstrap_peer"})
+	bootstrapPeerConnectLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bootstrap_peer_connect_latency_seconds",
+			Help: "Round trip time of the connection to the bootstrap peer in the last check, measured with libp2p ping",
+		}, []string{"bootstrap_peer"})
+	bootstrapPeerPeersLearned = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bootstrap_peer_peers_learned",
+			Help: "Number of other peers learned through the bootstrap peer in the last check",
+		}, []string{"bootstrap_peer"})
+	bootstrapPeerGuardians = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bootstrap_peer_guardians_heard",
+			Help: "Number of distinct guardians of the mainnet guardian set verified heartbeats were received from through the bootstrap peer in the last check",
+		}, []string{"bootstrap_peer"})
+	bootstrapPeerSinceSuccess = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bootstrap_peer_seconds_since_last_success",
+			Help: "Time since a heartbeat was last received through the bootstrap peer, as of the last check, absent if never",
+		}, []string{"bootstrap_peer"})
+	bootstrapPeerFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bootstrap_peer_failures_total",
+			Help: "Failed checks of the bootstrap peer by reason: invalid_peer, dns, host, dial_timeout, dial_error or no_gossip",
+		}, []string{"bootstrap_peer", "reason"})
 )
 
 func loadEnvVars() {
@@ -55,7 +91,15 @@ func loadEnvVars() {
 	p2pPort = uint(port)
 	nodeKeyPath = verifyEnvVar("NODE_KEY_PATH")
 	logLevel = verifyEnvVar("LOG_LEVEL")
-	promRemoteURL = verifyEnvVar("PROM_REMOTE_URL")
+	metricsConfig, err = metrics.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	roundInterval = durationEnvVar("ROUND_INTERVAL", 2*time.Minute)
+	checkTimeout = durationEnvVar("CHECK_TIMEOUT", 30*time.Second)
+	if checkTimeout >= roundInterval {
+		log.Fatal("CHECK_TIMEOUT must be shorter than ROUND_INTERVAL")
+	}
 }
 
 func verifyEnvVar(key string) string {
@@ -66,27 +110,16 @@ func verifyEnvVar(key string) string {
 	return value
 }
 
-func RunPrometheusScraper(ctx context.Context, logger *zap.Logger, info promremotew.PromTelemetryInfo) error {
-	promLogger := logger.With(zap.String("component", "prometheus_scraper"))
-	errC := make(chan error)
-	common.StartRunnable(ctx, errC, false, "prometheus_scraper", func(ctx context.Context) error {
-		t := time.NewTicker(15 * time.Second)
-
-		for {
-			select {
-			case <-ctx.Done():
-				return nil
-			case <-t.C:
-				err := promremotew.ScrapeAndSendLocalMetrics(ctx, info, promLogger)
-				if err != nil {
-					promLogger.Error("ScrapeAndSendLocalMetrics error", zap.Error(err))
-					// Don't want to return here, as we want to keep trying.
-					// We only want to return if the context is done.
-				}
-			}
-		}
-	})
-	return nil
+func durationEnvVar(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("Error parsing %s", key)
+	}
+	return d
 }
 
 func main() {
@@ -103,136 +136,116 @@ func main() {
 
 	ipfslog.SetAllLoggers(level)
 
-	// Load p2p private key
-	var priv crypto.PrivKey
-	priv, err = common.GetOrCreateNodeKey(logger, nodeKeyPath)
+	// Only heartbeats of the guardians count, which are known offline since the monitor only checks mainnet.
+	gsIndex, sgs, err := utils.StaticGuardianSet(common.MainNet)
 	if err != nil {
-		logger.Fatal("Failed to load node key", zap.Error(err))
+		logger.Fatal("Failed to load the guardian set", zap.Error(err))
+	}
+	gs := &common.GuardianSet{Keys: sgs.Keys, Index: gsIndex}
+
+	// Every bootstrap peer is checked by a host of its own, on the port P2P_PORT plus its index and with a node key
+	// of its own, so the bootstrap peers see the hosts as distinct peers.
+	checkers := make([]*peerChecker, len(p2pBootstraps))
+	for i, bootstrap := range p2pBootstraps {
+		priv, err := common.GetOrCreateNodeKey(logger, fmt.Sprintf("%s.%d", nodeKeyPath, i))
+		if err != nil {
+			logger.Fatal("Failed to load node key", zap.Error(err))
+		}
+		checkers[i] = &peerChecker{
+			logger:    logger.With(zap.String("bootstrap_peer", bootstrap)),
+			bootstrap: bootstrap,
+			port:      p2pPort + uint(i),
+			priv:      priv,
+			gs:        gs,
+		}
 	}
 
 	// Main lifecycle context.
-	rootCtx, rootCtxCancel = context.WithCancel(context.Background())
+	rootCtx, rootCtxCancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer rootCtxCancel()
 
-	// Prometheus stuff
-	// Start the Prometheus scraper
-	usingPromRemoteWrite := promRemoteURL != ""
-	if usingPromRemoteWrite {
-		var info promremotew.PromTelemetryInfo
-		info.PromRemoteURL = promRemoteURL
-		info.Labels = map[string]string{
-			"network": p2pNetworkID,
-			"product": "bootstrap_monitor",
-		}
-
-		err := RunPrometheusScraper(rootCtx, logger, info)
-		if err != nil {
-			logger.Fatal("Failed to start prometheus scraper", zap.Error(err))
-		}
+	// Push the metrics to PROM_REMOTE_URL, and serve them on METRICS_ADDR if set. Every pushed sample is labelled
+	// with the network, next to PROM_REMOTE_LABELS, which take precedence since the last value of a key wins.
+	metricsConfig.Labels = strings.Trim("network="+p2pNetworkID+","+metricsConfig.Labels, ",")
+	if err := metrics.Start(rootCtx, logger, metricsConfig, "bootstrap_monitor", nil); err != nil {
+		logger.Fatal("Failed to start metrics", zap.Error(err))
 	}
-	// End Prometheus stuff
 
-	// This starts an infinite loop that will run the p2p heartbeat checks every 15 minutes
+	// Check all the peers concurrently every ROUND_INTERVAL.
+	t := time.NewTicker(roundInterval)
+	defer t.Stop()
 	for {
-		for _, bootstrap := range p2pBootstraps {
-			localContext, localCancel := context.WithCancel(rootCtx)
-			defer localCancel()
-			logger.Info("Starting p2p", zap.String("bootstrap", bootstrap))
-			hbReceived = false
-			bootstrapPeer := bootstrap
-			components := p2p.DefaultComponents()
-			components.Port = p2pPort
-
-			host, err := p2p.NewHost(logger, localContext, p2pNetworkID, bootstrapPeer, components, priv)
-			if err != nil {
-				bootstrapPeerStatus.WithLabelValues(bootstrapPeer).Set(0)
-				logger.Error("failed to create host", zap.String("bootstrapPeer", bootstrapPeer), zap.Error(err))
-				continue
-			}
-
-			ps, err := pubsub.NewGossipSub(localContext, host)
-			if err != nil {
-				bootstrapPeerStatus.WithLabelValues(bootstrapPeer).Set(0)
-				logger.Error("failed to create subscription", zap.String("bootstrapPeer", bootstrapPeer), zap.Error(err))
-				continue
-			}
-
-			topic := fmt.Sprintf("%s/%s", p2pNetworkID, "broadcast")
-			topicHandle, err := ps.Join(topic)
-			if err != nil {
-				bootstrapPeerStatus.WithLabelValues(bootstrapPeer).Set(0)
-				logger.Error("failed to join topic", zap.String("bootstrapPeer", bootstrapPeer), zap.Error(err))
-				continue
-			}
-			sub, err := topicHandle.Subscribe()
-			if err != nil {
-				bootstrapPeerStatus.WithLabelValues(bootstrapPeer).Set(0)
-				logger.Error("failed to subscribe to topic", zap.String("bootstrapPeer", bootstrapPeer), zap.Error(err))
-				continue
-			}
-
-			go func() {
-				for {
-					envelope, err := sub.Next(localContext)
-					if err != nil {
-						logger.Error("failed to receive pubsub message", zap.Error(err))
-						break
-					}
-					var msg gossipv1.GossipMessage
-					err = proto.Unmarshal(envelope.Data, &msg)
-					if err != nil {
-						logger.Info("received invalid message",
-							zap.Binary("data", envelope.Data),
-							zap.String("from", envelope.GetFrom().String()))
-						continue
-					}
-					// Only look at heartbeats
-					if msg.GetSignedHeartbeat() == nil {
-						continue
-					}
-					logger.Debug("received Heartbeat")
-					hbReceived = true
-					break
-				}
-				// Start shutdown
-				logger.Debug("Shutting down...")
-				sub.Cancel()
-				if err := topicHandle.Close(); err != nil {
-					logger.Error("Error closing the broadcast topic", zap.Error(err))
-				}
-				if err := host.Close(); err != nil {
-					logger.Error("Error closing the host", zap.Error(err))
-				}
-				// End shutdown
-			}()
-
-			// Max time to wait for a heartbeat is 15 seconds
-			for i := 0; i < 15; i++ {
-				time.Sleep(1 * time.Second)
-				if hbReceived {
-					break
-				}
-			}
-
-			if hbReceived {
-				logger.Info("***** Heartbeat received ***** for", zap.String("bootstrap peer", bootstrapPeer))
-				bootstrapPeerStatus.WithLabelValues(bootstrapPeer).Set(1)
-			} else {
-				logger.Warn("******** ALERT ********** No heartbeat received for", zap.String("bootstrap peer", bootstrapPeer))
-				bootstrapPeerStatus.WithLabelValues(bootstrapPeer).Set(0)
-			}
-
-			// Cancel local context to break out of sub.Next()
-			localCancel()
-			logger.Info("local context cancelled")
-
-			// This is the udp port timeout
-			time.Sleep(40 * time.Second)
+		runRound(rootCtx, logger, checkers)
+		select {
+		case <-rootCtx.Done():
+			logger.Info("root context cancelled, exiting...")
+			return
+		case <-t.C:
 		}
-		logger.Info("Sleeping for 15 minutes")
-		time.Sleep(15 * time.Minute)
 	}
+}
 
-	rootCtxCancel()
-	logger.Info("root context cancelled, exiting...")
+func runRound(ctx context.Context, logger *zap.Logger, checkers []*peerChecker) {
+	logger.Info("Checking bootstrap peers", zap.Int("peers", len(checkers)), zap.Duration("timeout", checkTimeout))
+	results := make([]peerResult, len(checkers))
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx, checkTimeout)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	for i, r := range results {
+		c := checkers[i]
+		fields := []zap.Field{
+			zap.String("bootstrap_peer", r.bootstrap),
+			zap.Bool("connected", r.connected),
+			zap.Bool("heartbeat", r.heartbeat),
+			zap.Int("peers_learned", r.peersLearned),
+			zap.Int("guardians", r.guardians),
+		}
+		if r.connected {
+			bootstrapPeerTimeToConnect.WithLabelValues(r.bootstrap).Set(r.timeToConnect.Seconds())
+			fields = append(fields, zap.Duration("time_to_connect", r.timeToConnect))
+		} else {
+			bootstrapPeerTimeToConnect.DeleteLabelValues(r.bootstrap)
+		}
+		if r.rtt > 0 {
+			bootstrapPeerConnectLatency.WithLabelValues(r.bootstrap).Set(r.rtt.Seconds())
+			fields = append(fields, zap.Duration("rtt", r.rtt))
+		} else {
+			bootstrapPeerConnectLatency.DeleteLabelValues(r.bootstrap)
+		}
+		if r.heartbeat {
+			bootstrapPeerTimeToHeartbeat.WithLabelValues(r.bootstrap).Set(r.timeToHeartbeat.Seconds())
+			fields = append(fields, zap.Duration("time_to_first_heartbeat", r.timeToHeartbeat))
+			c.lastSuccess = now
+		} else {
+			bootstrapPeerTimeToHeartbeat.DeleteLabelValues(r.bootstrap)
+		}
+		bootstrapPeerPeersLearned.WithLabelValues(r.bootstrap).Set(float64(r.peersLearned))
+		bootstrapPeerGuardians.WithLabelValues(r.bootstrap).Set(float64(r.guardians))
+		if !c.lastSuccess.IsZero() {
+			bootstrapPeerSinceSuccess.WithLabelValues(r.bootstrap).Set(now.Sub(c.lastSuccess).Seconds())
+		}
+		if r.err != nil {
+			fields = append(fields, zap.Error(r.err))
+		}
+
+		if r.failure == "" {
+			logger.Info("Heartbeat received", fields...)
+			bootstrapPeerStatus.WithLabelValues(r.bootstrap).Set(1)
+		} else {
+			logger.Warn("Bootstrap peer check failed", append(fields, zap.String("reason", r.failure))...)
+			bootstrapPeerStatus.WithLabelValues(r.bootstrap).Set(0)
+			bootstrapPeerFailures.WithLabelValues(r.bootstrap, r.failure).Inc()
+		}
+	}
 }
@@ -2,12 +2,9 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
-	"sync"
-	"time"
 
 	"github.com/certusone/wormhole/node/pkg/common"
 	"github.com/certusone/wormhole/node/pkg/p2p"
@@ -17,7 +14,11 @@ import (
 	ipfslog "github.com/ipfs/go-log/v2"
 	"github.com/joho/godotenv"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	fly_common "github.com/wormhole-foundation/wormhole-monitor/fly/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
 	"github.com/wormhole-foundation/wormhole-monitor/fly/utils"
 
 	"go.uber.org/zap"
@@ -25,9 +26,7 @@ import (
 	"log"
 
 	firebase "firebase.google.com/go"
-	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
-	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -45,8 +44,25 @@ var (
 	coreBridgeAddr  string
 	credentialsFile string
 	network         string
+	replayFiles     string
+	replaySpeed     float64
+	dryRun          bool
+	metricsConfig   metrics.Config
 )
 
+var firestoreWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "fly_firestore_writes_total",
+	Help: "The number of Firestore document writes, by collection and result (ok or error)",
+}, []string{"collection", "result"})
+
+func countWrite(collection string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	firestoreWrites.WithLabelValues(collection, result).Inc()
+}
+
 func loadEnvVars() {
 	err := godotenv.Load() // By default loads .env
 	if err != nil {
@@ -59,10 +75,34 @@ func loadEnvVars() {
 	p2pPort = uint(port)
 	nodeKeyPath = verifyEnvVar("NODE_KEY_PATH")
 	logLevel = verifyEnvVar("LOG_LEVEL")
-	rpcUrl = verifyEnvVar("RPC_URL")
-	coreBridgeAddr = verifyEnvVar("CORE_BRIDGE_ADDR")
-	credentialsFile = verifyEnvVar("CREDENTIALS_FILE")
 	network = verifyEnvVar("NETWORK")
+	// Optional: log the writes instead of making them.
+	dryRun = os.Getenv("DRY_RUN") == "true"
+	if !dryRun {
+		credentialsFile = verifyEnvVar("CREDENTIALS_FILE")
+	}
+	// Optional: replay recorded gossip instead of connecting to the network.
+	replayFiles = os.Getenv("REPLAY_FILES")
+	replaySpeed = 1
+	if s := os.Getenv("REPLAY_SPEED"); s != "" {
+		replaySpeed, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			log.Fatal("Error parsing REPLAY_SPEED")
+		}
+	}
+	if err := checkReplayTarget(replayFiles, dryRun, os.Getenv("FIRESTORE_EMULATOR_HOST")); err != nil {
+		log.Fatal(err)
+	}
+	// Optional: expose metrics (METRICS_ADDR) and/or push them (PROM_REMOTE_URL).
+	metricsConfig, err = metrics.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The guardian set is not fetched from the chain when replaying.
+	if replayFiles == "" {
+		rpcUrl = verifyEnvVar("RPC_URL")
+		coreBridgeAddr = verifyEnvVar("CORE_BRIDGE_ADDR")
+	}
 }
 
 func verifyEnvVar(key string) string {
@@ -97,22 +137,30 @@ func main() {
 	ipfslog.SetAllLoggers(lvl)
 
 	ctx := context.Background()
-	sa := option.WithCredentialsFile(credentialsFile)
-	app, err := firebase.NewApp(ctx, nil, sa)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	var st store = dryRunStore{logger: logger}
+	if !dryRun {
+		sa := option.WithCredentialsFile(credentialsFile)
+		app, err := firebase.NewApp(ctx, nil, sa)
+		if err != nil {
+			log.Fatalln(err)
+		}
 
-	client, err := app.Firestore(ctx)
-	if err != nil {
-		log.Fatalln(err)
+		client, err := app.Firestore(ctx)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer client.Close()
+		st = firestoreStore{client: client}
 	}
-	defer client.Close()
 
 	// Node's main lifecycle context.
 	rootCtx, rootCtxCancel = context.WithCancel(context.Background())
 	defer rootCtxCancel()
 
+	if err := metrics.Start(rootCtx, logger, metricsConfig, "fly", nil); err != nil {
+		logger.Fatal("Failed to start metrics", zap.Error(err))
+	}
+
 	// Heartbeat updates
 	heartbeatC := make(chan *gossipv1.Heartbeat, 50)
 
@@ -125,7 +173,8 @@ func main() {
 	// Governor status
 	govStatusC := make(chan *gossipv1.SignedChainGovernorStatus, 50)
 	// Bootstrap guardian set, otherwise heartbeats would be skipped
-	idx, sgs, err := utils.FetchCurrentGuardianSet(rpcUrl, coreBridgeAddr)
+	// Replays have to work offline, so they use the known guardians for the environment instead of querying the chain.
+	idx, sgs, err := utils.GuardianSet(env, replayFiles != "", rpcUrl, coreBridgeAddr)
 	if err != nil {
 		logger.Fatal("Failed to fetch guardian set", zap.String("rpc", rpcUrl), zap.Error(err))
 	}
@@ -142,292 +191,76 @@ func main() {
 	}
 	gst.Set(&gs)
 
-	notionalByChainMu := sync.Mutex{}
-	availableNotionalByChain := map[string]map[uint32]uint64{}
-
-	type latestHeartbeat struct {
-		bootTimestamp int64
-		counter       int64
-	}
-
-	// Holds the most recent heartbeat (time-wise, not reception-wise) (NodeName → last seen)
-	lastHeartbeat := map[string]latestHeartbeat{}
-
+	w := newWriter(logger, st, gst, &gs)
 	// Seed most recent heartbeats from existing Firestore data
-	iter := client.Collection("heartbeats").Documents(ctx)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
+	w.seed(ctx)
+	w.start(rootCtx, heartbeatC, govConfigC, govStatusC)
+
+	if replayFiles != "" {
+		files, err := gossip.ExpandRecordings(replayFiles)
 		if err != nil {
-			logger.Info("Error reading heartbeats for seeding", zap.Error(err))
-			break
+			logger.Fatal("Invalid REPLAY_FILES", zap.Error(err))
 		}
-		data := doc.Data()
-		nodeName, _ := data["nodeName"].(string)
-		counterStr, _ := data["counter"].(string)
-		bootTsStr, _ := data["bootTimestamp"].(string)
-		if nodeName == "" {
-			continue
+		sinks := &gossip.Sinks{
+			Logger:     logger,
+			Gst:        gst,
+			GovConfigC: govConfigC,
+			GovStatusC: govStatusC,
 		}
-		counter, _ := strconv.ParseInt(counterStr, 10, 64)
-		bootTs, _ := strconv.ParseInt(bootTsStr, 10, 64)
-		lastHeartbeat[nodeName] = latestHeartbeat{
-			bootTimestamp: bootTs,
-			counter:       counter,
-		}
-	}
-	logger.Info("Seeded heartbeats from Firestore", zap.Int("count", len(lastHeartbeat)))
-
-	// Handle heartbeats
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case hb := <-heartbeatC:
-				id := hb.NodeName
-
-				// Only write if this is a newer heartbeat than the last one we saw.
-				// Accept if: new guardian (not seen before), newer boot cycle, or higher counter.
-				prev, hasPrev := lastHeartbeat[id]
-				if hasPrev {
-					if hb.BootTimestamp < prev.bootTimestamp {
-						continue
-					}
-					if hb.BootTimestamp == prev.bootTimestamp && hb.Counter <= prev.counter {
-						continue
-					}
-				}
-
-				// Update high-water mark
-				lastHeartbeat[id] = latestHeartbeat{
-					bootTimestamp: hb.BootTimestamp,
-					counter:       hb.Counter,
-				}
-
-				// Look up the libp2p peer ID that sent this heartbeat. The p2p loop
-				// stores (addr, peerID) → hb in gst.lastHeartbeats before sending hb
-				// to our channel, so the same pointer should be in the map.
-				p2pNodeAddr := ""
-				for peerId, stored := range gst.LastHeartbeat(eth_common.HexToAddress(hb.GuardianAddr)) {
-					if stored == hb {
-						p2pNodeAddr = peerId.String()
-						break
-					}
-				}
-
-				now := time.Now()
-				networks := make([]*map[string]interface{}, 0, len(hb.Networks))
-				for _, network := range hb.Networks {
-					networks = append(networks, &map[string]interface{}{
-						"id":                      network.Id,
-						"height":                  strconv.FormatInt(network.Height, 10),
-						"contractAddress":         network.ContractAddress,
-						"errorCount":              strconv.FormatUint(network.ErrorCount, 10),
-						"safeHeight":              strconv.FormatInt(network.SafeHeight, 10),
-						"finalizedHeight":         strconv.FormatInt(network.FinalizedHeight, 10),
-						"lastObservationSignedAt": strconv.FormatInt(network.LastObservationSignedAt, 10),
-					})
-				}
-
-				_, err = client.Collection("heartbeats").Doc(id).Set(ctx, map[string]interface{}{
-					"bootTimestamp": strconv.FormatInt(hb.BootTimestamp, 10),
-					"counter":       strconv.FormatInt(hb.Counter, 10),
-					"features":      hb.Features,
-					"guardianAddr":  hb.GuardianAddr,
-					"networks":      networks,
-					"nodeName":      hb.NodeName,
-					"timestamp":     strconv.FormatInt(hb.Timestamp, 10),
-					"updatedAt":     now,
-					"version":       hb.Version,
-					"p2pNodeAddr":   p2pNodeAddr,
-				})
-				if err != nil {
-					// Handle any errors in an appropriate way, such as returning them.
-					log.Printf("Error inserting heartbeat: %s", err)
-				}
+		go func() {
+			if err := gossip.Replay(rootCtx, logger, files, replaySpeed, sinks.Dispatch); err != nil && rootCtx.Err() == nil {
+				logger.Error("Replay failed", zap.Error(err))
 			}
+			logger.Info("Replay finished")
+		}()
+	} else {
+		// Load p2p private key
+		var priv crypto.PrivKey
+		priv, err = common.GetOrCreateNodeKey(logger, nodeKeyPath)
+		if err != nil {
+			logger.Fatal("Failed to load node key", zap.Error(err))
 		}
-	}()
-
-	// Handle govConfigs
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case govConfig := <-govConfigC:
-				id := hex.EncodeToString(govConfig.GuardianAddr)
-				_, isFromGuardian := gs.KeyIndex(eth_common.HexToAddress(id))
-				if !isFromGuardian {
-					log.Printf("gov cfg not from guardian set")
-					continue
-				}
-
-				now := time.Now()
-				var cfg gossipv1.ChainGovernorConfig
-				err := proto.Unmarshal(govConfig.Config, &cfg)
-				if err != nil {
-					log.Printf("Error unmarshalling govr config: %s", err)
-					continue
-				}
-				chains := make([]*map[string]interface{}, 0, len(cfg.Chains))
-				for _, chain := range cfg.Chains {
-					availableNotional := uint64(0)
-					notionalByChainMu.Lock()
-					if _, ok := availableNotionalByChain[id]; ok {
-						if _, ok := availableNotionalByChain[id][chain.ChainId]; ok {
-							availableNotional = availableNotionalByChain[id][chain.ChainId]
-						}
-					}
-					notionalByChainMu.Unlock()
-					chains = append(chains, &map[string]interface{}{
-						"chainId":            chain.ChainId,
-						"notionalLimit":      strconv.FormatUint(chain.NotionalLimit, 10),
-						"bigTransactionSize": strconv.FormatUint(chain.BigTransactionSize, 10),
-						// store the available notional in the same collection
-						// as the notional limits since they're closely related
-						// and is convenient for consumers
-						"availableNotional": strconv.FormatUint(availableNotional, 10),
-					})
-				}
-				tokens := make([]*map[string]interface{}, 0, len(cfg.Tokens))
-				for _, token := range cfg.Tokens {
-					tokens = append(tokens, &map[string]interface{}{
-						"originChainId": token.OriginChainId,
-						"originAddress": token.OriginAddress,
-						"price":         token.Price,
-					})
-				}
-
-				_, err = client.Collection("governorConfigs").Doc(id).Set(ctx, map[string]interface{}{
-					"guardianAddress": hex.EncodeToString(govConfig.GuardianAddr),
-					"chains":          chains,
-					"tokens":          tokens,
-					"updatedAt":       now,
-				})
-
-				if err != nil {
-					log.Printf("Error inserting govr config: %s", err)
-				}
-			}
+
+		// Run supervisor.
+		components := p2p.DefaultComponents()
+		components.Port = p2pPort
+		// Reduce number of connected peers to reduce network egress
+		components.GossipParams.D = 1    // default: 6
+		components.GossipParams.Dlo = 1  // default: 5
+		components.GossipParams.Dhi = 2  // default: 12
+		components.GossipParams.Dout = 1 // default: 2
+
+		params, err := p2p.NewRunParams(
+			p2pBootstrap,
+			p2pNetworkID,
+			priv,
+			gst,
+			rootCtxCancel,
+			p2p.WithComponents(components),
+			p2p.WithChainGovernorConfigListener(govConfigC),
+			p2p.WithChainGovernorStatusListener(govStatusC),
+		)
+		if err != nil {
+			logger.Fatal("Failed to create RunParams", zap.Error(err))
 		}
-	}()
-
-	// Handle govStatus
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case govStatus := <-govStatusC:
-				id := hex.EncodeToString(govStatus.GuardianAddr)
-				_, isFromGuardian := gs.KeyIndex(eth_common.HexToAddress(id))
-				if !isFromGuardian {
-					log.Printf("gov status not from guardian set")
-					continue
-				}
-
-				now := time.Now()
-				var status gossipv1.ChainGovernorStatus
-				err := proto.Unmarshal(govStatus.Status, &status)
-				if err != nil {
-					log.Printf("Error unmarshalling govr status: %s", err)
-					continue
-				}
-				chains := make([]*map[string]interface{}, 0, len(status.Chains))
-				for _, chain := range status.Chains {
-					emitters := make([]*map[string]interface{}, 0, len(chain.Emitters))
-					for _, emitter := range chain.Emitters {
-						enqueuedVaas := make([]*map[string]interface{}, 0, len(emitter.EnqueuedVaas))
-						for _, enqueuedVaa := range emitter.EnqueuedVaas {
-							enqueuedVaas = append(enqueuedVaas, &map[string]interface{}{
-								"sequence":      strconv.FormatUint(enqueuedVaa.Sequence, 10),
-								"releaseTime":   enqueuedVaa.ReleaseTime,
-								"notionalValue": strconv.FormatUint(enqueuedVaa.NotionalValue, 10),
-								"txHash":        enqueuedVaa.TxHash,
-							})
-						}
-						emitters = append(emitters, &map[string]interface{}{
-							"emitterAddress":    emitter.EmitterAddress,
-							"totalEnqueuedVaas": strconv.FormatUint(emitter.TotalEnqueuedVaas, 10),
-							"enqueuedVaas":      enqueuedVaas,
-						})
-					}
-					chains = append(chains, &map[string]interface{}{
-						"chainId":           chain.ChainId,
-						"availableNotional": strconv.FormatUint(chain.RemainingAvailableNotional, 10),
-						"emitters":          emitters,
-					})
-					notionalByChainMu.Lock()
-					if _, ok := availableNotionalByChain[id]; !ok {
-						availableNotionalByChain[id] = map[uint32]uint64{}
-					}
-					availableNotionalByChain[id][chain.ChainId] = chain.RemainingAvailableNotional
-					notionalByChainMu.Unlock()
-				}
-
-				_, err = client.Collection("governorStatus").Doc(id).Set(ctx, map[string]interface{}{
-					"guardianAddress": hex.EncodeToString(govStatus.GuardianAddr),
-					"chains":          chains,
-					"updatedAt":       now,
-				})
-
-				if err != nil {
-					log.Printf("Error inserting govr status: %s", err)
-				}
+
+		supervisor.New(rootCtx, logger, func(ctx context.Context) error {
+			if err := supervisor.Run(ctx,
+				"p2p",
+				p2p.Run(params)); err != nil {
+				return err
 			}
-		}
-	}()
 
-	// Load p2p private key
-	var priv crypto.PrivKey
-	priv, err = common.GetOrCreateNodeKey(logger, nodeKeyPath)
-	if err != nil {
-		logger.Fatal("Failed to load node key", zap.Error(err))
-	}
+			logger.Info("Started internal services")
 
-	// Run supervisor.
-	components := p2p.DefaultComponents()
-	components.Port = p2pPort
-	// Reduce number of connected peers to reduce network egress
-	components.GossipParams.D = 1    // default: 6
-	components.GossipParams.Dlo = 1  // default: 5
-	components.GossipParams.Dhi = 2  // default: 12
-	components.GossipParams.Dout = 1 // default: 2
-
-	params, err := p2p.NewRunParams(
-		p2pBootstrap,
-		p2pNetworkID,
-		priv,
-		gst,
-		rootCtxCancel,
-		p2p.WithComponents(components),
-		p2p.WithChainGovernorConfigListener(govConfigC),
-		p2p.WithChainGovernorStatusListener(govStatusC),
-	)
-	if err != nil {
-		logger.Fatal("Failed to create RunParams", zap.Error(err))
+			<-ctx.Done()
+			return nil
+		},
+			// It's safer to crash and restart the process in case we encounter a panic,
+			// rather than attempting to reschedule the runnable.
+			supervisor.WithPropagatePanic)
 	}
 
-	supervisor.New(rootCtx, logger, func(ctx context.Context) error {
-		if err := supervisor.Run(ctx,
-			"p2p",
-			p2p.Run(params)); err != nil {
-			return err
-		}
-
-		logger.Info("Started internal services")
-
-		<-ctx.Done()
-		return nil
-	},
-		// It's safer to crash and restart the process in case we encounter a panic,
-		// rather than attempting to reschedule the runnable.
-		supervisor.WithPropagatePanic)
-
 	<-rootCtx.Done()
 	logger.Info("root context cancelled, exiting...")
 	// TODO: wait for things to shut down gracefully
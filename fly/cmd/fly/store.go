@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+// store holds the latest heartbeat, governor config and governor status of each guardian, in one collection each.
+type store interface {
+	// documents returns the data of every document in the collection.
+	documents(ctx context.Context, collection string) ([]map[string]interface{}, error)
+	set(ctx context.Context, collection string, id string, data map[string]interface{}) error
+}
+
+// firestoreStore writes to Firestore, or to the emulator at FIRESTORE_EMULATOR_HOST when it is set.
+type firestoreStore struct {
+	client *firestore.Client
+}
+
+func (s firestoreStore) documents(ctx context.Context, collection string) ([]map[string]interface{}, error) {
+	var docs []map[string]interface{}
+	iter := s.client.Collection(collection).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return docs, nil
+		}
+		if err != nil {
+			return docs, err
+		}
+		docs = append(docs, doc.Data())
+	}
+}
+
+func (s firestoreStore) set(ctx context.Context, collection string, id string, data map[string]interface{}) error {
+	_, err := s.client.Collection(collection).Doc(id).Set(ctx, data)
+	return err
+}
+
+// dryRunStore logs the writes instead of making them, so that recordings can be replayed without touching the
+// collections that the dashboard reads.
+type dryRunStore struct {
+	logger *zap.Logger
+}
+
+func (s dryRunStore) documents(ctx context.Context, collection string) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (s dryRunStore) set(ctx context.Context, collection string, id string, data map[string]interface{}) error {
+	s.logger.Info("dry run write", zap.String("collection", collection), zap.String("id", id), zap.Any("data", data))
+	return nil
+}
+
+// checkReplayTarget refuses to replay into the live collections: the recorded heartbeats would overwrite the current
+// ones.
+func checkReplayTarget(replayFiles string, dryRun bool, emulatorHost string) error {
+	if replayFiles != "" && !dryRun && emulatorHost == "" {
+		return fmt.Errorf("REPLAY_FILES needs DRY_RUN=true or FIRESTORE_EMULATOR_HOST, so that recorded heartbeats are not written to the live collections")
+	}
+	return nil
+}
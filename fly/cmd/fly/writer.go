@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+type latestHeartbeat struct {
+	bootTimestamp int64
+	counter       int64
+}
+
+// writer writes the heartbeats and governor messages of the guardians to the store.
+type writer struct {
+	logger *zap.Logger
+	store  store
+	gst    *common.GuardianSetState
+	gs     *common.GuardianSet
+
+	// Holds the most recent heartbeat (time-wise, not reception-wise) (NodeName → last seen)
+	lastHeartbeat map[string]latestHeartbeat
+
+	notionalByChainMu        sync.Mutex
+	availableNotionalByChain map[string]map[uint32]uint64
+}
+
+func newWriter(logger *zap.Logger, s store, gst *common.GuardianSetState, gs *common.GuardianSet) *writer {
+	return &writer{
+		logger:                   logger,
+		store:                    s,
+		gst:                      gst,
+		gs:                       gs,
+		lastHeartbeat:            map[string]latestHeartbeat{},
+		availableNotionalByChain: map[string]map[uint32]uint64{},
+	}
+}
+
+// seed loads the most recent heartbeats from the store, so that older ones are not written over them.
+func (w *writer) seed(ctx context.Context) {
+	docs, err := w.store.documents(ctx, "heartbeats")
+	if err != nil {
+		w.logger.Info("Error reading heartbeats for seeding", zap.Error(err))
+	}
+	for _, data := range docs {
+		nodeName, _ := data["nodeName"].(string)
+		counterStr, _ := data["counter"].(string)
+		bootTsStr, _ := data["bootTimestamp"].(string)
+		if nodeName == "" {
+			continue
+		}
+		counter, _ := strconv.ParseInt(counterStr, 10, 64)
+		bootTs, _ := strconv.ParseInt(bootTsStr, 10, 64)
+		w.lastHeartbeat[nodeName] = latestHeartbeat{
+			bootTimestamp: bootTs,
+			counter:       counter,
+		}
+	}
+	w.logger.Info("Seeded heartbeats from Firestore", zap.Int("count", len(w.lastHeartbeat)))
+}
+
+// start handles the messages of each channel in its own goroutine until ctx is done.
+func (w *writer) start(ctx context.Context, heartbeatC <-chan *gossipv1.Heartbeat, govConfigC <-chan *gossipv1.SignedChainGovernorConfig, govStatusC <-chan *gossipv1.SignedChainGovernorStatus) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case hb := <-heartbeatC:
+				w.heartbeat(ctx, hb)
+			}
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case govConfig := <-govConfigC:
+				w.govConfig(ctx, govConfig)
+			}
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case govStatus := <-govStatusC:
+				w.govStatus(ctx, govStatus)
+			}
+		}
+	}()
+}
+
+func (w *writer) heartbeat(ctx context.Context, hb *gossipv1.Heartbeat) {
+	id := hb.NodeName
+
+	// Only write if this is a newer heartbeat than the last one we saw.
+	// Accept if: new guardian (not seen before), newer boot cycle, or higher counter.
+	prev, hasPrev := w.lastHeartbeat[id]
+	if hasPrev {
+		if hb.BootTimestamp < prev.bootTimestamp {
+			return
+		}
+		if hb.BootTimestamp == prev.bootTimestamp && hb.Counter <= prev.counter {
+			return
+		}
+	}
+
+	// Update high-water mark
+	w.lastHeartbeat[id] = latestHeartbeat{
+		bootTimestamp: hb.BootTimestamp,
+		counter:       hb.Counter,
+	}
+
+	// Look up the libp2p peer ID that sent this heartbeat. The p2p loop
+	// stores (addr, peerID) → hb in gst.lastHeartbeats before sending hb
+	// to our channel, so the same pointer should be in the map.
+	p2pNodeAddr := ""
+	for peerId, stored := range w.gst.LastHeartbeat(eth_common.HexToAddress(hb.GuardianAddr)) {
+		if stored == hb {
+			p2pNodeAddr = peerId.String()
+			break
+		}
+	}
+
+	now := time.Now()
+	networks := make([]*map[string]interface{}, 0, len(hb.Networks))
+	for _, network := range hb.Networks {
+		networks = append(networks, &map[string]interface{}{
+			"id":                      network.Id,
+			"height":                  strconv.FormatInt(network.Height, 10),
+			"contractAddress":         network.ContractAddress,
+			"errorCount":              strconv.FormatUint(network.ErrorCount, 10),
+			"safeHeight":              strconv.FormatInt(network.SafeHeight, 10),
+			"finalizedHeight":         strconv.FormatInt(network.FinalizedHeight, 10),
+			"lastObservationSignedAt": strconv.FormatInt(network.LastObservationSignedAt, 10),
+		})
+	}
+
+	err := w.store.set(ctx, "heartbeats", id, map[string]interface{}{
+		"bootTimestamp": strconv.FormatInt(hb.BootTimestamp, 10),
+		"counter":       strconv.FormatInt(hb.Counter, 10),
+		"features":      hb.Features,
+		"guardianAddr":  hb.GuardianAddr,
+		"networks":      networks,
+		"nodeName":      hb.NodeName,
+		"timestamp":     strconv.FormatInt(hb.Timestamp, 10),
+		"updatedAt":     now,
+		"version":       hb.Version,
+		"p2pNodeAddr":   p2pNodeAddr,
+	})
+	countWrite("heartbeats", err)
+	if err != nil {
+		// Handle any errors in an appropriate way, such as returning them.
+		log.Printf("Error inserting heartbeat: %s", err)
+	}
+}
+
+func (w *writer) govConfig(ctx context.Context, govConfig *gossipv1.SignedChainGovernorConfig) {
+	id := hex.EncodeToString(govConfig.GuardianAddr)
+	_, isFromGuardian := w.gs.KeyIndex(eth_common.HexToAddress(id))
+	if !isFromGuardian {
+		log.Printf("gov cfg not from guardian set")
+		return
+	}
+
+	now := time.Now()
+	var cfg gossipv1.ChainGovernorConfig
+	err := proto.Unmarshal(govConfig.Config, &cfg)
+	if err != nil {
+		log.Printf("Error unmarshalling govr config: %s", err)
+		return
+	}
+	chains := make([]*map[string]interface{}, 0, len(cfg.Chains))
+	for _, chain := range cfg.Chains {
+		availableNotional := uint64(0)
+		w.notionalByChainMu.Lock()
+		if _, ok := w.availableNotionalByChain[id]; ok {
+			if _, ok := w.availableNotionalByChain[id][chain.ChainId]; ok {
+				availableNotional = w.availableNotionalByChain[id][chain.ChainId]
+			}
+		}
+		w.notionalByChainMu.Unlock()
+		chains = append(chains, &map[string]interface{}{
+			"chainId":            chain.ChainId,
+			"notionalLimit":      strconv.FormatUint(chain.NotionalLimit, 10),
+			"bigTransactionSize": strconv.FormatUint(chain.BigTransactionSize, 10),
+			// store the available notional in the same collection
+			// as the notional limits since they're closely related
+			// and is convenient for consumers
+			"availableNotional": strconv.FormatUint(availableNotional, 10),
+		})
+	}
+	tokens := make([]*map[string]interface{}, 0, len(cfg.Tokens))
+	for _, token := range cfg.Tokens {
+		tokens = append(tokens, &map[string]interface{}{
+			"originChainId": token.OriginChainId,
+			"originAddress": token.OriginAddress,
+			"price":         token.Price,
+		})
+	}
+
+	err = w.store.set(ctx, "governorConfigs", id, map[string]interface{}{
+		"guardianAddress": hex.EncodeToString(govConfig.GuardianAddr),
+		"chains":          chains,
+		"tokens":          tokens,
+		"updatedAt":       now,
+	})
+
+	countWrite("governorConfigs", err)
+	if err != nil {
+		log.Printf("Error inserting govr config: %s", err)
+	}
+}
+
+func (w *writer) govStatus(ctx context.Context, govStatus *gossipv1.SignedChainGovernorStatus) {
+	id := hex.EncodeToString(govStatus.GuardianAddr)
+	_, isFromGuardian := w.gs.KeyIndex(eth_common.HexToAddress(id))
+	if !isFromGuardian {
+		log.Printf("gov status not from guardian set")
+		return
+	}
+
+	now := time.Now()
+	var status gossipv1.ChainGovernorStatus
+	err := proto.Unmarshal(govStatus.Status, &status)
+	if err != nil {
+		log.Printf("Error unmarshalling govr status: %s", err)
+		return
+	}
+	chains := make([]*map[string]interface{}, 0, len(status.Chains))
+	for _, chain := range status.Chains {
+		emitters := make([]*map[string]interface{}, 0, len(chain.Emitters))
+		for _, emitter := range chain.Emitters {
+			enqueuedVaas := make([]*map[string]interface{}, 0, len(emitter.EnqueuedVaas))
+			for _, enqueuedVaa := range emitter.EnqueuedVaas {
+				enqueuedVaas = append(enqueuedVaas, &map[string]interface{}{
+					"sequence":      strconv.FormatUint(enqueuedVaa.Sequence, 10),
+					"releaseTime":   enqueuedVaa.ReleaseTime,
+					"notionalValue": strconv.FormatUint(enqueuedVaa.NotionalValue, 10),
+					"txHash":        enqueuedVaa.TxHash,
+				})
+			}
+			emitters = append(emitters, &map[string]interface{}{
+				"emitterAddress":    emitter.EmitterAddress,
+				"totalEnqueuedVaas": strconv.FormatUint(emitter.TotalEnqueuedVaas, 10),
+				"enqueuedVaas":      enqueuedVaas,
+			})
+		}
+		chains = append(chains, &map[string]interface{}{
+			"chainId":           chain.ChainId,
+			"availableNotional": strconv.FormatUint(chain.RemainingAvailableNotional, 10),
+			"emitters":          emitters,
+		})
+		w.notionalByChainMu.Lock()
+		if _, ok := w.availableNotionalByChain[id]; !ok {
+			w.availableNotionalByChain[id] = map[uint32]uint64{}
+		}
+		w.availableNotionalByChain[id][chain.ChainId] = chain.RemainingAvailableNotional
+		w.notionalByChainMu.Unlock()
+	}
+
+	err = w.store.set(ctx, "governorStatus", id, map[string]interface{}{
+		"guardianAddress": hex.EncodeToString(govStatus.GuardianAddr),
+		"chains":          chains,
+		"updatedAt":       now,
+	})
+
+	countWrite("governorStatus", err)
+	if err != nil {
+		log.Printf("Error inserting govr status: %s", err)
+	}
+}
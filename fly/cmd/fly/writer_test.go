@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// memStore is a store that keeps the documents in memory.
+type memStore struct {
+	mu          sync.Mutex
+	collections map[string]map[string]map[string]interface{}
+}
+
+func newMemStore() *memStore {
+	return &memStore{collections: map[string]map[string]map[string]interface{}{}}
+}
+
+func (s *memStore) documents(ctx context.Context, collection string) ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var docs []map[string]interface{}
+	for _, data := range s.collections[collection] {
+		docs = append(docs, data)
+	}
+	return docs, nil
+}
+
+func (s *memStore) set(ctx context.Context, collection string, id string, data map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.collections[collection] == nil {
+		s.collections[collection] = map[string]map[string]interface{}{}
+	}
+	s.collections[collection][id] = data
+	return nil
+}
+
+func (s *memStore) doc(collection string, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.collections[collection][id]
+}
+
+func TestCheckReplayTarget(t *testing.T) {
+	tests := []struct {
+		name         string
+		replayFiles  string
+		dryRun       bool
+		emulatorHost string
+		wantErr      bool
+	}{
+		{name: "live gossip", wantErr: false},
+		{name: "replay into the live collections", replayFiles: "recordings", wantErr: true},
+		{name: "replay with a dry run", replayFiles: "recordings", dryRun: true, wantErr: false},
+		{name: "replay into the emulator", replayFiles: "recordings", emulatorHost: "localhost:8080", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkReplayTarget(tt.replayFiles, tt.dryRun, tt.emulatorHost)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkReplayTarget() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestReplay replays a recording the way main does with REPLAY_FILES, and checks what is written to the store.
+func TestReplay(t *testing.T) {
+	g0, outsider := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	heartbeatC := make(chan *gossipv1.Heartbeat, 10)
+	gst := common.NewGuardianSetState(heartbeatC)
+	gs := common.GuardianSet{Keys: []eth_common.Address{g0.Addr}, Index: 4}
+	gst.Set(&gs)
+	govConfigC := make(chan *gossipv1.SignedChainGovernorConfig, 10)
+	govStatusC := make(chan *gossipv1.SignedChainGovernorStatus, 10)
+
+	status, err := proto.Marshal(&gossipv1.ChainGovernorStatus{
+		NodeName: "g0",
+		Chains:   []*gossipv1.ChainGovernorStatus_Chain{{ChainId: 2, RemainingAvailableNotional: 500}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := proto.Marshal(&gossipv1.ChainGovernorConfig{
+		NodeName: "g0",
+		Chains:   []*gossipv1.ChainGovernorConfig_Chain{{ChainId: 2, NotionalLimit: 1000, BigTransactionSize: 100}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recording := gossiptest.WriteRecording(t,
+		gossiptest.Envelope(t, g0.Peer, "heartbeat", at, g0.Heartbeat(t, &gossipv1.Heartbeat{
+			NodeName:      "g0",
+			Counter:       2,
+			BootTimestamp: 1,
+			Networks:      []*gossipv1.Heartbeat_Network{{Id: 2, Height: 100}},
+		})),
+		gossiptest.Envelope(t, outsider.Peer, "heartbeat", at, outsider.Heartbeat(t, &gossipv1.Heartbeat{NodeName: "outsider", Counter: 1})),
+		gossiptest.Envelope(t, g0.Peer, "governor", at, &gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedChainGovernorStatus{
+			SignedChainGovernorStatus: &gossipv1.SignedChainGovernorStatus{Status: status, GuardianAddr: g0.Addr.Bytes()},
+		}}),
+		gossiptest.Envelope(t, g0.Peer, "governor", at, &gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedChainGovernorConfig{
+			SignedChainGovernorConfig: &gossipv1.SignedChainGovernorConfig{Config: config, GuardianAddr: g0.Addr.Bytes()},
+		}}),
+		gossiptest.Envelope(t, outsider.Peer, "governor", at, &gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedChainGovernorStatus{
+			SignedChainGovernorStatus: &gossipv1.SignedChainGovernorStatus{Status: status, GuardianAddr: outsider.Addr.Bytes()},
+		}}),
+	)
+
+	ctx := context.Background()
+	sinks := &gossip.Sinks{Logger: zap.NewNop(), Gst: gst, GovConfigC: govConfigC, GovStatusC: govStatusC}
+	if err := gossip.Replay(ctx, zap.NewNop(), []string{recording}, 0, sinks.Dispatch); err != nil {
+		t.Fatal(err)
+	}
+	close(heartbeatC)
+	close(govConfigC)
+	close(govStatusC)
+
+	st := newMemStore()
+	w := newWriter(zap.NewNop(), st, gst, &gs)
+	for hb := range heartbeatC {
+		w.heartbeat(ctx, hb)
+	}
+	// The status comes first, so that the config picks up the available notional.
+	for g := range govStatusC {
+		w.govStatus(ctx, g)
+	}
+	for g := range govConfigC {
+		w.govConfig(ctx, g)
+	}
+
+	hb := st.doc("heartbeats", "g0")
+	if hb == nil {
+		t.Fatal("no heartbeat written for g0")
+	}
+	if hb["counter"] != "2" || hb["p2pNodeAddr"] != g0.Peer.String() || hb["guardianAddr"] != g0.Addr.Hex() {
+		t.Errorf("heartbeat = %v, want counter 2 from %s", hb, g0.Peer)
+	}
+	if networks := hb["networks"].([]*map[string]interface{}); len(networks) != 1 || (*networks[0])["height"] != "100" {
+		t.Errorf("networks = %v, want chain 2 at height 100", networks)
+	}
+	if st.doc("heartbeats", "outsider") != nil {
+		t.Error("heartbeat of a guardian outside the set was written")
+	}
+
+	// Governor documents are keyed by the hex guardian address, without 0x.
+	id := hex.EncodeToString(g0.Addr.Bytes())
+	status0 := st.doc("governorStatus", id)
+	if status0 == nil {
+		t.Fatal("no governor status written for g0")
+	}
+	if chains := status0["chains"].([]*map[string]interface{}); len(chains) != 1 || (*chains[0])["availableNotional"] != "500" {
+		t.Errorf("governor status chains = %v, want chain 2 with 500 available", chains)
+	}
+	config0 := st.doc("governorConfigs", id)
+	if config0 == nil {
+		t.Fatal("no governor config written for g0")
+	}
+	if chains := config0["chains"].([]*map[string]interface{}); len(chains) != 1 || (*chains[0])["notionalLimit"] != "1000" || (*chains[0])["availableNotional"] != "500" {
+		t.Errorf("governor config chains = %v, want chain 2 limited to 1000 with 500 available", chains)
+	}
+	if st.doc("governorStatus", hex.EncodeToString(outsider.Addr.Bytes())) != nil {
+		t.Error("governor status of a guardian outside the set was written")
+	}
+}
+
+// TestSeed checks that heartbeats already in the store, or written since, are not overwritten by older ones.
+func TestSeed(t *testing.T) {
+	st := newMemStore()
+	if err := st.set(context.Background(), "heartbeats", "g0", map[string]interface{}{"nodeName": "g0", "counter": "5", "bootTimestamp": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	gst := common.NewGuardianSetState(nil)
+	w := newWriter(zap.NewNop(), st, gst, &common.GuardianSet{})
+	w.seed(context.Background())
+
+	w.heartbeat(context.Background(), &gossipv1.Heartbeat{NodeName: "g0", Counter: 4, BootTimestamp: 1})
+	if got := st.doc("heartbeats", "g0")["counter"]; got != "5" {
+		t.Errorf("counter after an older heartbeat = %v, want 5", got)
+	}
+	w.heartbeat(context.Background(), &gossipv1.Heartbeat{NodeName: "g0", Counter: 1, BootTimestamp: 2})
+	if got := st.doc("heartbeats", "g0")["counter"]; got != "1" {
+		t.Errorf("counter after a reboot = %v, want 1", got)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Statuses of a check.
+const (
+	statusPass = "pass"
+	statusFail = "fail"
+	statusSkip = "skip"
+)
+
+// Exit codes of the checks of a single guardian. Each check has its own, and when several checks fail the exit
+// code is the one of the first failed check, in the order they are reported. Invalid flags and other errors exit 1.
+const (
+	exitHeartbeat        = 10
+	exitObservations     = 11
+	exitHeartbeatContent = 12
+	exitChains           = 13
+	// The probes of the public API exit with the code of the API plus the index of the probe in apiProbes,
+	// e.g. 20 for rest/heartbeats and 31 for grpc/guardianset.
+	exitREST = 20
+	exitGRPC = 30
+)
+
+// checkResult is the outcome of one check.
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Duration is how long the check took, in seconds. For gossip checks it is the time until the first
+	// matching message arrived, or the whole --timeout if none did.
+	Duration float64 `json:"duration"`
+
+	exitCode int
+}
+
+func pass(name, detail string, d time.Duration) checkResult {
+	return checkResult{Name: name, Status: statusPass, Detail: detail, Duration: d.Seconds()}
+}
+
+func fail(name string, exitCode int, detail string, d time.Duration) checkResult {
+	return checkResult{Name: name, Status: statusFail, Detail: detail, Duration: d.Seconds(), exitCode: exitCode}
+}
+
+func skip(name, detail string) checkResult {
+	return checkResult{Name: name, Status: statusSkip, Detail: detail}
+}
+
+// exitCode returns the exit code of the first failed check, or 0 if none failed.
+func exitCode(results []checkResult) int {
+	for _, r := range results {
+		if r.Status == statusFail {
+			return r.exitCode
+		}
+	}
+	return 0
+}
+
+// guardianSetExitCode returns the number of guardians that failed, as --all exits with.
+func guardianSetExitCode(reports []guardianReport) int {
+	failed := 0
+	for _, r := range reports {
+		if !r.Healthy {
+			failed++
+		}
+	}
+	// Exit codes above 125 have special meanings to shells.
+	return min(failed, 125)
+}
+
+type checkReport struct {
+	Guardian string        `json:"guardian,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	URL      string        `json:"url,omitempty"`
+	GRPC     string        `json:"grpc,omitempty"`
+	Healthy  bool          `json:"healthy"`
+	Checks   []checkResult `json:"checks"`
+	// Heartbeat is the content of the heartbeats of the guardian, if any was received.
+	Heartbeat *heartbeatReport `json:"heartbeat,omitempty"`
+}
+
+func writeCheckReport(w io.Writer, output string, r checkReport) error {
+	if output == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	for _, c := range r.Checks {
+		var icon string
+		switch c.Status {
+		case statusPass:
+			icon = "✅"
+		case statusFail:
+			icon = "❌"
+		default:
+			icon = "ℹ️ "
+		}
+		line := fmt.Sprintf("%s %s", icon, c.Name)
+		if c.Detail != "" {
+			line += ": " + c.Detail
+		}
+		if c.Status != statusSkip && c.Duration > 0 {
+			line += fmt.Sprintf(" (%s)", time.Duration(c.Duration*float64(time.Second)).Round(time.Millisecond))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	if r.Heartbeat != nil && len(r.Heartbeat.Chains) > 0 {
+		writeChainTable(w, r.Heartbeat.Chains)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	publicrpcv1 "github.com/certusone/wormhole/node/pkg/proto/publicrpc/v1"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+var testVAAID = &publicrpcv1.MessageID{
+	EmitterChain:   publicrpcv1.ChainID(vaa.ChainIDEthereum),
+	EmitterAddress: "0000000000000000000000003ee18b2214aff97000d974cf647e7c347e8fa585",
+	Sequence:       7,
+}
+
+// fakeAPI serves a healthy public API of guardian set 4, made of guardian alone, except for the method named by fail,
+// which returns an error.
+type fakeAPI struct {
+	guardian gossiptest.Guardian
+	fail     string
+	// guardianSet overrides the guardian set.
+	guardianSet *publicrpcv1.GuardianSet
+}
+
+func (f *fakeAPI) err(method string) error {
+	if f.fail == method {
+		return errors.New(method + " unavailable")
+	}
+	return nil
+}
+
+func (f *fakeAPI) lastHeartbeats(context.Context) (*publicrpcv1.GetLastHeartbeatsResponse, error) {
+	return &publicrpcv1.GetLastHeartbeatsResponse{Entries: []*publicrpcv1.GetLastHeartbeatsResponse_Entry{{
+		VerifiedGuardianAddr: f.guardian.Addr.Hex(),
+		RawHeartbeat:         &gossipv1.Heartbeat{NodeName: "g0", Counter: 10, Timestamp: 1},
+	}}}, f.err("lastHeartbeats")
+}
+
+func (f *fakeAPI) currentGuardianSet(context.Context) (*publicrpcv1.GetCurrentGuardianSetResponse, error) {
+	if f.guardianSet != nil {
+		return &publicrpcv1.GetCurrentGuardianSetResponse{GuardianSet: f.guardianSet}, f.err("currentGuardianSet")
+	}
+	return &publicrpcv1.GetCurrentGuardianSetResponse{GuardianSet: &publicrpcv1.GuardianSet{
+		Index: 4, Addresses: []string{f.guardian.Addr.Hex()},
+	}}, f.err("currentGuardianSet")
+}
+
+func (f *fakeAPI) availableNotional(context.Context) (*publicrpcv1.GovernorGetAvailableNotionalByChainResponse, error) {
+	return &publicrpcv1.GovernorGetAvailableNotionalByChainResponse{Entries: []*publicrpcv1.GovernorGetAvailableNotionalByChainResponse_Entry{
+		{ChainId: 2, RemainingAvailableNotional: 10, NotionalLimit: 20},
+	}}, f.err("availableNotional")
+}
+
+func (f *fakeAPI) enqueuedVAAs(context.Context) (*publicrpcv1.GovernorGetEnqueuedVAAsResponse, error) {
+	return &publicrpcv1.GovernorGetEnqueuedVAAsResponse{}, f.err("enqueuedVAAs")
+}
+
+func (f *fakeAPI) tokenList(context.Context) (*publicrpcv1.GovernorGetTokenListResponse, error) {
+	return &publicrpcv1.GovernorGetTokenListResponse{Entries: []*publicrpcv1.GovernorGetTokenListResponse_Entry{
+		{OriginChainId: 2, OriginAddress: "000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", Price: 3000},
+	}}, f.err("tokenList")
+}
+
+func (f *fakeAPI) signedVAA(_ context.Context, id *publicrpcv1.MessageID) (*publicrpcv1.GetSignedVAAResponse, error) {
+	v := testVAA(id)
+	v.AddSignature(f.guardian.Key, 0)
+	b, err := v.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &publicrpcv1.GetSignedVAAResponse{VaaBytes: b}, f.err("signedVAA")
+}
+
+func testVAA(id *publicrpcv1.MessageID) *vaa.VAA {
+	emitter, err := vaa.StringToAddress(id.EmitterAddress)
+	if err != nil {
+		panic(err)
+	}
+	return &vaa.VAA{Version: 1, GuardianSetIndex: 4, EmitterChain: vaa.ChainID(id.EmitterChain), EmitterAddress: emitter, Sequence: id.Sequence}
+}
+
+// setTimeout sets the --timeout the probes run with for the duration of the test.
+func setTimeout(t *testing.T, d time.Duration) {
+	prev := timeout
+	t.Cleanup(func() { timeout = prev })
+	timeout = d
+}
+
+func TestExitCode(t *testing.T) {
+	setTimeout(t, time.Second)
+	g := gossiptest.NewGuardian(t)
+	probe := func(prefix string, base int, failing string) []checkResult {
+		return runProbes(context.Background(), prefix, base, &fakeAPI{guardian: g, fail: failing}, &probeState{vaaID: testVAAID})
+	}
+	passing := pass("heartbeat", "", time.Second)
+	type test struct {
+		name    string
+		results []checkResult
+		want    int
+	}
+	tests := []test{
+		{"none", nil, 0},
+		{"passing", []checkResult{passing, skip("rest", "--url not defined")}, 0},
+		{"heartbeat", []checkResult{fail("heartbeat", exitHeartbeat, "", 0)}, 10},
+		{"observations", []checkResult{passing, fail("observations", exitObservations, "", 0)}, 11},
+		{"heartbeat content", []checkResult{passing, fail("heartbeat_content", exitHeartbeatContent, "", 0)}, 12},
+		{"chains", []checkResult{passing, fail("chains", exitChains, "", 0)}, 13},
+		{"first failure", []checkResult{fail("chains", exitChains, "", 0), fail("heartbeat", exitHeartbeat, "", 0)}, 13},
+		{"rest", probe("rest", exitREST, ""), 0},
+		{"grpc", probe("grpc", exitGRPC, ""), 0},
+	}
+	for i, method := range []string{"lastHeartbeats", "currentGuardianSet", "availableNotional", "enqueuedVAAs", "tokenList", "signedVAA"} {
+		tests = append(tests,
+			test{"rest/" + apiProbes[i].name, probe("rest", exitREST, method), 20 + i},
+			test{"grpc/" + apiProbes[i].name, probe("grpc", exitGRPC, method), 30 + i},
+		)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.results); got != tt.want {
+				t.Errorf("exitCode = %d, want %d: %+v", got, tt.want, tt.results)
+			}
+		})
+	}
+}
+
+func TestGuardianSetExitCode(t *testing.T) {
+	reports := func(healthy, unhealthy int) []guardianReport {
+		var r []guardianReport
+		for i := 0; i < healthy; i++ {
+			r = append(r, guardianReport{Healthy: true})
+		}
+		for i := 0; i < unhealthy; i++ {
+			r = append(r, guardianReport{})
+		}
+		return r
+	}
+	for _, tt := range []struct {
+		healthy, unhealthy, want int
+	}{
+		{19, 0, 0},
+		{16, 3, 3},
+		{0, 125, 125},
+		// Exit codes above 125 are reserved by shells.
+		{0, 200, 125},
+	} {
+		if got := guardianSetExitCode(reports(tt.healthy, tt.unhealthy)); got != tt.want {
+			t.Errorf("%d healthy and %d unhealthy guardians: exit code %d, want %d", tt.healthy, tt.unhealthy, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCheckReport(t *testing.T) {
+	guardian := "0x58CC3AE5C097b213cE3c81979e1B9f9570746AA5"
+	r := checkReport{
+		Guardian: guardian,
+		Checks: []checkResult{
+			pass("heartbeat", "3 verified heartbeats", 1500*time.Millisecond),
+			fail("observations", exitObservations, "no observations received", 15*time.Second),
+			skip("rest", "--url not defined, skipping web checks"),
+		},
+		Heartbeat: &heartbeatReport{Chains: []chainReport{{ChainID: 2, Chain: "ethereum", Height: 100, Highest: 2000, Behind: 1900, Problems: []string{"1900 blocks behind"}}}},
+	}
+
+	var text bytes.Buffer
+	if err := writeCheckReport(&text, outputText, r); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(text.String(), "\n")
+	for i, want := range []string{
+		"✅ heartbeat: 3 verified heartbeats (1.5s)",
+		"❌ observations: no observations received (15s)",
+		"ℹ️  rest: --url not defined, skipping web checks",
+	} {
+		if lines[i] != want {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want)
+		}
+	}
+	if !strings.Contains(text.String(), "ethereum (2)") || !strings.Contains(text.String(), "❌ 1900 blocks behind") {
+		t.Errorf("no chain table in:\n%s", text.String())
+	}
+
+	var js bytes.Buffer
+	if err := writeCheckReport(&js, outputJSON, r); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON %s: %v", js.String(), err)
+	}
+	checks, _ := decoded["checks"].([]any)
+	if decoded["guardian"] != guardian || decoded["healthy"] != false || len(checks) != 3 {
+		t.Fatalf("report = %s", js.String())
+	}
+	want := []map[string]any{
+		{"name": "heartbeat", "status": "pass", "detail": "3 verified heartbeats", "duration": 1.5},
+		{"name": "observations", "status": "fail", "detail": "no observations received", "duration": 15.0},
+		{"name": "rest", "status": "skip", "detail": "--url not defined, skipping web checks", "duration": 0.0},
+	}
+	for i, w := range want {
+		if fmt.Sprint(checks[i]) != fmt.Sprint(w) {
+			t.Errorf("check %d = %v, want %v", i, checks[i], w)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/common"
+	publicrpcv1 "github.com/certusone/wormhole/node/pkg/proto/publicrpc/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
+	"go.uber.org/zap"
+)
+
+var (
+	checkStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "healthcheck_check_status",
+		Help: "Result of the last evaluation of a check of a target, 1 if it passed and 0 if it failed. Skipped checks are left out",
+	}, []string{"target", "check"})
+	checkDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "healthcheck_check_duration_seconds",
+		Help: "How long a check took, or for gossip checks the time until the first matching message of the interval",
+	}, []string{"target", "check"})
+	targetHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "healthcheck_target_healthy",
+		Help: "1 if every check of a guardian, REST API or gRPC API passed in the last evaluation, 0 otherwise",
+	}, []string{"target", "kind"})
+	chainBehind = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "healthcheck_chain_behind_blocks",
+		Help: "How many blocks the height of a chain in the last heartbeat of a guardian is behind the other guardians",
+	}, []string{"target", "chain"})
+	lastEvaluation = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "healthcheck_last_evaluation_timestamp_seconds",
+		Help: "Time of the last evaluation",
+	})
+)
+
+// Kinds of targets.
+const (
+	targetGuardian = "guardian"
+	targetREST     = "rest"
+	targetGRPC     = "grpc"
+)
+
+// daemonReport is the result of one evaluation, served on /healthz.
+type daemonReport struct {
+	Time    time.Time     `json:"time"`
+	Healthy bool          `json:"healthy"`
+	Targets []checkReport `json:"targets"`
+	// GuardianSet is set with --all.
+	GuardianSet      []guardianReport `json:"guardian_set,omitempty"`
+	GuardianSetIndex *uint32          `json:"guardian_set_index,omitempty"`
+}
+
+// daemon keeps one gossip session open and evaluates the configured guardians and APIs every interval,
+// over the gossip received since the previous evaluation.
+type daemon struct {
+	logger   *zap.Logger
+	interval time.Duration
+	// guardians are from --pubKey, named after the registry.
+	guardians []guardianInfo
+	// others are the guardians the chain heights are compared with.
+	others    []eth_common.Address
+	urls      []string
+	grpcAddrs []string
+	vaaID     *publicrpcv1.MessageID
+	// guardianSet is checked as a whole with --all.
+	guardianSet []guardianInfo
+	gsIndex     *uint32
+	// apiGuardianSet is the current guardian set the APIs are compared with, nil if it could not be loaded.
+	apiGuardianSet      []eth_common.Address
+	apiGuardianSetIndex uint32
+	s                   *session
+
+	// series are the label values each gauge vector was set with by the last evaluation.
+	series map[*prometheus.GaugeVec]map[[2]string]bool
+
+	mu   sync.Mutex
+	last *daemonReport
+}
+
+// runDaemon evaluates the targets every --interval until the context is cancelled.
+func runDaemon(ctx context.Context, logger *zap.Logger, env common.Environment) {
+	if interval <= 0 {
+		logger.Fatal("--interval must be positive", zap.Duration("interval", interval))
+	}
+	known := knownGuardians(logger, env)
+	d := &daemon{
+		logger:    logger,
+		interval:  interval,
+		others:    addresses(known),
+		urls:      splitList(url),
+		grpcAddrs: splitList(grpcAddr),
+	}
+	for _, key := range splitList(pubKey) {
+		addr, err := parseGuardianKey(key)
+		if err != nil {
+			logger.Fatal("Failed to decode guardian public key, should be a 20 byte hex address", zap.String("pubKey", key), zap.Error(err))
+		}
+		g := guardianInfo{name: addr.Hex(), addr: addr}
+		for _, k := range known {
+			if k.addr == addr {
+				g.name = k.name
+			}
+		}
+		d.guardians = append(d.guardians, g)
+	}
+	for _, u := range d.urls {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			logger.Fatal("url must start with http:// or https://", zap.String("url", u))
+		}
+	}
+	var err error
+	if d.vaaID, err = parseVAAIDFlag(); err != nil {
+		logger.Fatal("Invalid value for --vaaID", zap.String("val", vaaID), zap.Error(err))
+	}
+	if all {
+		rpcUrl, coreBridgeAddr := guardianSetRPC(env)
+		if d.guardianSet, d.gsIndex, err = loadGuardianSet(env, guardianSetSource, rpcUrl, coreBridgeAddr); err != nil {
+			logger.Fatal("Failed to load the guardian set", zap.Error(err))
+		}
+	}
+	if len(d.urls) > 0 || len(d.grpcAddrs) > 0 {
+		if all {
+			d.apiGuardianSet, d.apiGuardianSetIndex = addresses(d.guardianSet), *d.gsIndex
+		} else {
+			d.apiGuardianSet, d.apiGuardianSetIndex = currentGuardianSet(logger, env)
+		}
+	}
+	if len(d.guardians) == 0 && len(d.urls) == 0 && len(d.grpcAddrs) == 0 && !all {
+		logger.Fatal("--daemon needs at least one of --pubKey, --url, --grpc or --all")
+	}
+
+	if err := metrics.Start(ctx, logger, metricsConfig, "healthcheck", map[string]http.Handler{"/healthz": d}); err != nil {
+		logger.Fatal("Failed to start the metrics server", zap.Error(err))
+	}
+	if len(d.guardians) > 0 || all {
+		d.s = startGossip(ctx, logger)
+		defer d.s.close()
+	}
+
+	logger.Info("Running as a daemon", zap.Duration("interval", interval), zap.Int("guardians", len(d.guardians)),
+		zap.Strings("urls", d.urls), zap.Strings("grpc", d.grpcAddrs), zap.Bool("all", all))
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.evaluate(ctx)
+		}
+	}
+}
+
+func (d *daemon) evaluate(ctx context.Context) {
+	r := &daemonReport{Healthy: true}
+	var w *window
+	if d.s != nil {
+		w = d.s.collect()
+	}
+
+	for _, g := range d.guardians {
+		results, hb := guardianChecks(d.s, w, g.addr, d.others)
+		r.Targets = append(r.Targets, d.targetReport(checkReport{Guardian: g.addr.Hex(), Name: g.name, Checks: results, Heartbeat: hb}))
+	}
+	// The APIs are attributed to the guardian when only one is configured.
+	var guardian *eth_common.Address
+	if len(d.guardians) == 1 {
+		guardian = &d.guardians[0].addr
+	}
+	for _, u := range d.urls {
+		st := d.probeState(guardian, w)
+		r.Targets = append(r.Targets, d.targetReport(checkReport{URL: u, Checks: probeREST(ctx, d.logger, u, st)}))
+	}
+	for _, addr := range d.grpcAddrs {
+		st := d.probeState(guardian, w)
+		r.Targets = append(r.Targets, d.targetReport(checkReport{GRPC: addr, Checks: probeGRPC(ctx, d.logger, addr, st)}))
+	}
+	if d.guardianSet != nil {
+		r.GuardianSet, r.GuardianSetIndex = checkGuardianSet(d.s, d.guardianSet, w.guardians), d.gsIndex
+	}
+	r.Time = time.Now()
+
+	next := map[*prometheus.GaugeVec]map[[2]string]bool{}
+	set := func(vec *prometheus.GaugeVec, target, label string, v float64) {
+		vec.WithLabelValues(target, label).Set(v)
+		if next[vec] == nil {
+			next[vec] = map[[2]string]bool{}
+		}
+		next[vec][[2]string{target, label}] = true
+	}
+	for _, t := range r.Targets {
+		target, kind := t.target()
+		for _, c := range t.Checks {
+			if c.Status == statusSkip {
+				continue
+			}
+			set(checkStatus, target, c.Name, boolToFloat(c.Status == statusPass))
+			set(checkDuration, target, c.Name, c.Duration)
+		}
+		set(targetHealthy, target, kind, boolToFloat(t.Healthy))
+		if t.Heartbeat != nil {
+			for _, c := range t.Heartbeat.Chains {
+				set(chainBehind, target, c.Chain, float64(c.Behind))
+			}
+		}
+		if !t.Healthy {
+			r.Healthy = false
+			d.logger.Warn("target unhealthy", zap.String("target", target), zap.String("kind", kind), zap.Strings("failed", failedChecks(t.Checks)))
+		}
+	}
+	for _, g := range r.GuardianSet {
+		set(targetHealthy, g.Name, targetGuardian, boolToFloat(g.Healthy))
+		if !g.Healthy {
+			r.Healthy = false
+		}
+	}
+	// The series that were not set again are only deleted now, so that scrapes during the evaluation don't miss any.
+	for vec, prev := range d.series {
+		for labels := range prev {
+			if !next[vec][labels] {
+				vec.DeleteLabelValues(labels[0], labels[1])
+			}
+		}
+	}
+	d.series = next
+	lastEvaluation.Set(float64(r.Time.Unix()))
+	d.logger.Info("evaluated", zap.Bool("healthy", r.Healthy), zap.Int("targets", len(r.Targets)), zap.Int("guardian_set", len(r.GuardianSet)))
+
+	d.mu.Lock()
+	d.last = r
+	d.mu.Unlock()
+}
+
+func (d *daemon) probeState(guardian *eth_common.Address, w *window) *probeState {
+	return &probeState{guardian: guardian, gossip: w, vaaID: d.vaaID, guardianSet: d.apiGuardianSet, guardianSetIndex: d.apiGuardianSetIndex}
+}
+
+func (d *daemon) targetReport(r checkReport) checkReport {
+	r.Healthy = exitCode(r.Checks) == 0
+	return r
+}
+
+// ServeHTTP serves the last evaluation, with status 503 if a target is unhealthy or the evaluation is stale.
+func (d *daemon) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	d.mu.Lock()
+	last := d.last
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case last == nil:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]any{"healthy": false, "error": "no evaluation yet"})
+		return
+	case time.Since(last.Time) > 3*d.interval:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case !last.Healthy:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(last)
+}
+
+// target returns the label of the report in metrics and its kind.
+func (r checkReport) target() (string, string) {
+	switch {
+	case r.URL != "":
+		return r.URL, targetREST
+	case r.GRPC != "":
+		return r.GRPC, targetGRPC
+	case r.Name != "":
+		return r.Name, targetGuardian
+	}
+	return r.Guardian, targetGuardian
+}
+
+func failedChecks(results []checkResult) []string {
+	var names []string
+	for _, c := range results {
+		if c.Status == statusFail {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
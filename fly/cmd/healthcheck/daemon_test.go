@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"go.uber.org/zap"
+)
+
+// gaugeSeries returns the values of the series of a gauge vector, by their target and second label.
+func gaugeSeries(t *testing.T, name string) map[[2]string]float64 {
+	t.Helper()
+	series, err := gatherGauge(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return series
+}
+
+func gatherGauge(name string) (map[[2]string]float64, error) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	series := map[[2]string]float64{}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			var labels [2]string
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "target" {
+					labels[0] = l.GetValue()
+				} else {
+					labels[1] = l.GetValue()
+				}
+			}
+			series[labels] = m.GetGauge().GetValue()
+		}
+	}
+	return series, nil
+}
+
+func healthz(t *testing.T, d *daemon) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid body %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestDaemon(t *testing.T) {
+	setTimeout(t, 5*time.Second)
+	for _, vec := range []*prometheus.GaugeVec{checkStatus, checkDuration, targetHealthy, chainBehind} {
+		vec.Reset()
+	}
+	g := gossiptest.NewGuardian(t)
+	healthy, unhealthy := restServer(t, &fakeAPI{guardian: g}, nil), restServer(t, &fakeAPI{guardian: g, fail: "tokenList"}, nil)
+	d := &daemon{logger: zap.NewNop(), interval: time.Minute, urls: []string{healthy}, vaaID: testVAAID}
+
+	if code, body := healthz(t, d); code != http.StatusServiceUnavailable || body["error"] != "no evaluation yet" {
+		t.Errorf("before the first evaluation: %d %v, want 503 with no evaluation yet", code, body)
+	}
+
+	d.evaluate(context.Background())
+	if code, body := healthz(t, d); code != http.StatusOK || body["healthy"] != true {
+		t.Errorf("healthy: %d %v, want 200", code, body)
+	}
+	if got := gaugeSeries(t, "healthcheck_target_healthy"); len(got) != 1 || got[[2]string{healthy, targetREST}] != 1 {
+		t.Errorf("target health = %v, want only the healthy API", got)
+	}
+
+	// Scrapes during the following evaluations always see the healthy API, which stays configured until the end.
+	stop, missed := make(chan struct{}), make(chan int)
+	go func() {
+		n := 0
+		for {
+			select {
+			case <-stop:
+				missed <- n
+				return
+			default:
+			}
+			if got, err := gatherGauge("healthcheck_target_healthy"); err != nil || got[[2]string{healthy, targetREST}] != 1 {
+				n++
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		if n := <-missed; n > 0 {
+			t.Errorf("%d scrapes missed the health of the healthy API", n)
+		}
+	}()
+
+	d.urls = append(d.urls, unhealthy)
+	d.evaluate(context.Background())
+	if code, body := healthz(t, d); code != http.StatusServiceUnavailable || body["healthy"] != false {
+		t.Errorf("unhealthy: %d %v, want 503", code, body)
+	}
+	if got := gaugeSeries(t, "healthcheck_target_healthy"); len(got) != 2 || got[[2]string{healthy, targetREST}] != 1 || got[[2]string{unhealthy, targetREST}] != 0 {
+		t.Errorf("target health = %v, want both APIs", got)
+	}
+	status := gaugeSeries(t, "healthcheck_check_status")
+	if len(status) != 2*len(apiProbes) || status[[2]string{unhealthy, "rest/governor_token_list"}] != 0 || status[[2]string{healthy, "rest/governor_token_list"}] != 1 {
+		t.Errorf("check status = %v, want every probe of both APIs", status)
+	}
+
+	// The series of a target that is gone are deleted.
+	d.urls = []string{healthy}
+	d.evaluate(context.Background())
+	if got := gaugeSeries(t, "healthcheck_target_healthy"); len(got) != 1 || got[[2]string{healthy, targetREST}] != 1 {
+		t.Errorf("target health = %v, want only the healthy API", got)
+	}
+	for _, name := range []string{"healthcheck_check_status", "healthcheck_check_duration_seconds"} {
+		for labels := range gaugeSeries(t, name) {
+			if labels[0] != healthy {
+				t.Errorf("%s still has a series of %s", name, labels[0])
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.last.Time = d.last.Time.Add(-3*d.interval - time.Second)
+	d.mu.Unlock()
+	if code, body := healthz(t, d); code != http.StatusServiceUnavailable || body["healthy"] != true {
+		t.Errorf("stale: %d %v, want 503 with the last, healthy, evaluation", code, body)
+	}
+}
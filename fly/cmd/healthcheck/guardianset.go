@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/utils"
+)
+
+// Sources of the guardian set.
+const (
+	guardianSetContract = "contract"
+	guardianSetRegistry = "registry"
+)
+
+type guardianInfo struct {
+	index int
+	name  string
+	addr  eth_common.Address
+}
+
+// loadGuardianSet reads the current guardian set from the core bridge contract, or from the registry of known
+// guardians of the environment. Guardians are named after the registry.
+func loadGuardianSet(env node_common.Environment, source, rpcUrl, coreBridgeAddr string) ([]guardianInfo, *uint32, error) {
+	var known []common.GuardianEntry
+	switch env {
+	case node_common.MainNet:
+		known = common.MainnetGuardians
+	case node_common.TestNet:
+		known = common.TestnetGuardians
+	case node_common.UnsafeDevNet:
+		known = common.DevnetGuardians
+	}
+
+	var index *uint32
+	var keys []eth_common.Address
+	switch source {
+	case guardianSetContract:
+		idx, gs, err := utils.FetchCurrentGuardianSet(rpcUrl, coreBridgeAddr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch the guardian set: %w", err)
+		}
+		index, keys = &idx, gs.Keys
+	case guardianSetRegistry:
+		idx, gs, err := utils.StaticGuardianSet(env)
+		if err != nil {
+			return nil, nil, err
+		}
+		index, keys = &idx, gs.Keys
+	default:
+		return nil, nil, fmt.Errorf("unknown guardian set source %q", source)
+	}
+
+	guardians := make([]guardianInfo, len(keys))
+	for i, key := range keys {
+		guardians[i] = guardianInfo{index: i, name: key.Hex(), addr: key}
+		for _, g := range known {
+			if strings.EqualFold(g.Address, key.Hex()) {
+				guardians[i].name = g.Name
+			}
+		}
+	}
+	return guardians, index, nil
+}
+
+func addresses(guardians []guardianInfo) []eth_common.Address {
+	addrs := make([]eth_common.Address, len(guardians))
+	for i, g := range guardians {
+		addrs[i] = g.addr
+	}
+	return addrs
+}
+
+// guardianReport is the result of checking one guardian of the set.
+type guardianReport struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Healthy bool   `json:"healthy"`
+	// Heartbeats counts the verified heartbeats.
+	Heartbeats         int `json:"heartbeats"`
+	InvalidHeartbeats  int `json:"invalid_heartbeats"`
+	ObservationBatches int `json:"observation_batches"`
+	// InvalidObservationBatches claimed the guardian's address but failed verification.
+	InvalidObservationBatches int      `json:"invalid_observation_batches"`
+	PeerID                    string   `json:"peer_id,omitempty"`
+	PeerAddrs                 []string `json:"peer_addrs,omitempty"`
+	Version                   string   `json:"version,omitempty"`
+	// LagSeconds is how long after its timestamp the last heartbeat was received, which includes any clock skew.
+	LagSeconds float64 `json:"lag_seconds"`
+}
+
+// checkGuardianSet reports on every guardian. A guardian is healthy if it sent a verified heartbeat and observations.
+func checkGuardianSet(s *session, guardians []guardianInfo, activity map[eth_common.Address]*guardianActivity) []guardianReport {
+	reports := make([]guardianReport, len(guardians))
+	for i, g := range guardians {
+		r := guardianReport{Index: g.index, Name: g.name, Address: g.addr.Hex()}
+		if a, ok := activity[g.addr]; ok {
+			r.Heartbeats = len(a.heartbeats)
+			r.InvalidHeartbeats = a.invalidHeartbeats
+			r.ObservationBatches = a.observationBatches
+			r.InvalidObservationBatches = a.invalidObservationBatches
+			if last, ok := a.lastHeartbeat(); ok {
+				r.PeerID = last.from.String()
+				for _, addr := range s.peerInfo(last.from).Addrs {
+					r.PeerAddrs = append(r.PeerAddrs, addr.String())
+				}
+				r.Version = last.hb.Version
+				r.LagSeconds = last.receivedAt.Sub(time.Unix(0, last.hb.Timestamp)).Seconds()
+			}
+		}
+		r.Healthy = r.Heartbeats > 0 && r.ObservationBatches > 0
+		reports[i] = r
+	}
+	return reports
+}
+
+func writeGuardianSetReport(w io.Writer, output string, gsIndex *uint32, reports []guardianReport) error {
+	if output == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			GuardianSetIndex *uint32          `json:"guardian_set_index,omitempty"`
+			Guardians        []guardianReport `json:"guardians"`
+		}{gsIndex, reports})
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"#", "Guardian", "Status", "Heartbeats", "Observation Batches", "Version", "Lag", "Peer"})
+	failed := 0
+	for _, r := range reports {
+		status := "✅"
+		if !r.Healthy {
+			status = "❌"
+			failed++
+		}
+		heartbeats := fmt.Sprint(r.Heartbeats)
+		if r.InvalidHeartbeats > 0 {
+			heartbeats += fmt.Sprintf(" (%d invalid)", r.InvalidHeartbeats)
+		}
+		batches := fmt.Sprint(r.ObservationBatches)
+		if r.InvalidObservationBatches > 0 {
+			batches += fmt.Sprintf(" (%d invalid)", r.InvalidObservationBatches)
+		}
+		lag := ""
+		if r.Heartbeats > 0 {
+			lag = time.Duration(r.LagSeconds * float64(time.Second)).Round(time.Millisecond).String()
+		}
+		peerAddr := r.PeerID
+		if len(r.PeerAddrs) > 0 {
+			peerAddr = r.PeerAddrs[0] + "/p2p/" + r.PeerID
+		}
+		t.AppendRow(table.Row{r.Index, r.Name, status, heartbeats, batches, r.Version, lag, peerAddr})
+	}
+	set := "registry"
+	if gsIndex != nil {
+		set = fmt.Sprintf("guardian set %d", *gsIndex)
+	}
+	t.AppendFooter(table.Row{"", set, fmt.Sprintf("%d/%d failed", failed, len(reports))})
+	t.Render()
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+// behindDiff is how many blocks a chain may be behind the highest height reported by the other guardians,
+// as on the dashboard.
+const behindDiff = 1000
+
+func behindDiffForChain(id vaa.ChainID) int64 {
+	switch id {
+	case vaa.ChainIDPolygon, vaa.ChainIDArbitrum, vaa.ChainIDOptimism:
+		return 2 * behindDiff
+	}
+	return behindDiff
+}
+
+// maxClockSkew is how far the timestamp of a heartbeat may be from the time it was received.
+const maxClockSkew = time.Minute
+
+// heartbeatReport is the content of the heartbeats of a guardian during the gossip window.
+type heartbeatReport struct {
+	NodeName   string    `json:"node_name"`
+	Version    string    `json:"version"`
+	BootTime   time.Time `json:"boot_time"`
+	Heartbeats int       `json:"heartbeats"`
+	// FirstCounter and LastCounter are the counters of the first and last heartbeats of the window.
+	FirstCounter int64 `json:"first_counter"`
+	LastCounter  int64 `json:"last_counter"`
+	// Restarted is set if the guardian booted again during the window.
+	Restarted bool          `json:"restarted"`
+	Chains    []chainReport `json:"chains"`
+}
+
+// chainReport compares the height of a chain in the last heartbeat of a guardian with the other guardians.
+type chainReport struct {
+	ChainID uint32 `json:"chain_id"`
+	Chain   string `json:"chain"`
+	Height  int64  `json:"height"`
+	// Highest is the highest height of the chain in the last heartbeats of the other guardians, 0 if none reports it.
+	Highest    int64  `json:"highest"`
+	Behind     int64  `json:"behind"`
+	ErrorCount uint64 `json:"error_count"`
+	// ErrorCountRise is how much the error count rose during the window.
+	ErrorCountRise uint64   `json:"error_count_rise"`
+	Problems       []string `json:"problems,omitempty"`
+}
+
+// checkHeartbeatContent validates the heartbeats of guardian and compares its chains with the guardians of others,
+// which are the only guardians trusted to report heights. It returns nil results if there is no heartbeat to check.
+func checkHeartbeatContent(guardian eth_common.Address, w *window, others []eth_common.Address) (*heartbeatReport, []checkResult) {
+	a, ok := w.guardians[guardian]
+	if !ok || len(a.heartbeats) == 0 {
+		return nil, []checkResult{
+			skip("heartbeat_content", "no verified heartbeat"),
+			skip("chains", "no verified heartbeat"),
+		}
+	}
+	first, last := a.heartbeats[0], a.heartbeats[len(a.heartbeats)-1]
+	r := &heartbeatReport{
+		NodeName:     last.hb.NodeName,
+		Version:      last.hb.Version,
+		BootTime:     time.Unix(0, last.hb.BootTimestamp),
+		Heartbeats:   len(a.heartbeats),
+		FirstCounter: first.hb.Counter,
+		LastCounter:  last.hb.Counter,
+	}
+
+	var problems []string
+	if last.hb.Version == "" {
+		problems = append(problems, "no version")
+	}
+	if last.hb.BootTimestamp <= 0 || last.hb.BootTimestamp > last.hb.Timestamp {
+		problems = append(problems, fmt.Sprintf("invalid boot time %d", last.hb.BootTimestamp))
+	}
+	if skew := last.receivedAt.Sub(time.Unix(0, last.hb.Timestamp)); skew > maxClockSkew || skew < -maxClockSkew {
+		problems = append(problems, fmt.Sprintf("timestamp %s off", skew.Round(time.Second)))
+	}
+	for i := 1; i < len(a.heartbeats); i++ {
+		prev, hb := a.heartbeats[i-1].hb, a.heartbeats[i].hb
+		switch {
+		case hb.BootTimestamp != prev.BootTimestamp:
+			r.Restarted = true
+		case hb.Counter <= prev.Counter:
+			problems = append(problems, fmt.Sprintf("counter went from %d to %d without a restart", prev.Counter, hb.Counter))
+		}
+	}
+	var content checkResult
+	if len(problems) > 0 {
+		content = fail("heartbeat_content", exitHeartbeatContent, strings.Join(problems, ", "), 0)
+	} else {
+		detail := fmt.Sprintf("%s version %s, up %s, counter %d to %d over %d heartbeats", r.NodeName, r.Version,
+			last.receivedAt.Sub(r.BootTime).Round(time.Second), r.FirstCounter, r.LastCounter, r.Heartbeats)
+		if r.Restarted {
+			detail += ", restarted"
+		}
+		content = pass("heartbeat_content", detail, 0)
+	}
+
+	r.Chains = compareChains(first.hb, last.hb, w, guardian, others)
+	var flagged []string
+	for _, c := range r.Chains {
+		if len(c.Problems) > 0 {
+			flagged = append(flagged, fmt.Sprintf("%s (%s)", c.Chain, strings.Join(c.Problems, ", ")))
+		}
+	}
+	var chains checkResult
+	if len(flagged) > 0 {
+		chains = fail("chains", exitChains, fmt.Sprintf("%d of %d chains flagged: %s", len(flagged), len(r.Chains), strings.Join(flagged, "; ")), 0)
+	} else {
+		chains = pass("chains", fmt.Sprintf("%d chains", len(r.Chains)), 0)
+	}
+	return r, []checkResult{content, chains}
+}
+
+// compareChains flags the chains of the last heartbeat that are at height 0, too far behind the other guardians,
+// not advancing while the others are ahead, or whose error count rose since the first heartbeat. Chains a quorum of
+// the other guardians report but the last heartbeat doesn't are flagged as missing.
+func compareChains(first, last *gossipv1.Heartbeat, w *window, guardian eth_common.Address, others []eth_common.Address) []chainReport {
+	highest := map[uint32]int64{}
+	reporters := map[uint32]int{}
+	reporting := 0
+	for _, addr := range others {
+		if addr == guardian {
+			continue
+		}
+		a, ok := w.guardians[addr]
+		if !ok {
+			continue
+		}
+		if hb, ok := a.lastHeartbeat(); ok {
+			reporting++
+			for _, n := range hb.hb.Networks {
+				highest[n.Id] = max(highest[n.Id], n.Height)
+				reporters[n.Id]++
+			}
+		}
+	}
+	initial := map[uint32]*gossipv1.Heartbeat_Network{}
+	for _, n := range first.Networks {
+		initial[n.Id] = n
+	}
+
+	chains := make([]chainReport, 0, len(last.Networks))
+	for _, n := range last.Networks {
+		c := chainReport{
+			ChainID:    n.Id,
+			Chain:      vaa.ChainID(n.Id).String(),
+			Height:     n.Height,
+			Highest:    highest[n.Id],
+			ErrorCount: n.ErrorCount,
+		}
+		if c.Highest > 0 {
+			c.Behind = max(c.Highest-c.Height, 0)
+		}
+		switch {
+		case n.Height == 0:
+			c.Problems = append(c.Problems, "height 0")
+		case c.Behind > behindDiffForChain(vaa.ChainID(n.Id)):
+			c.Problems = append(c.Problems, fmt.Sprintf("%d blocks behind", c.Behind))
+		}
+		if prev, ok := initial[n.Id]; ok && first != last {
+			if n.Height != 0 && n.Height == prev.Height && c.Behind > 0 {
+				c.Problems = append(c.Problems, "stale")
+			}
+			if n.ErrorCount > prev.ErrorCount {
+				c.ErrorCountRise = n.ErrorCount - prev.ErrorCount
+				c.Problems = append(c.Problems, fmt.Sprintf("%d new errors", c.ErrorCountRise))
+			}
+		}
+		chains = append(chains, c)
+	}
+	reported := map[uint32]bool{}
+	for _, n := range last.Networks {
+		reported[n.Id] = true
+	}
+	for id, n := range reporters {
+		if !reported[id] && n >= vaa.CalculateQuorum(reporting) {
+			chains = append(chains, chainReport{ChainID: id, Chain: vaa.ChainID(id).String(), Highest: highest[id], Problems: []string{"missing"}})
+		}
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].ChainID < chains[j].ChainID })
+	return chains
+}
+
+func writeChainTable(w io.Writer, chains []chainReport) {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Chain", "Height", "Highest", "Behind", "Errors", "Status"})
+	for _, c := range chains {
+		status := "✅"
+		if len(c.Problems) > 0 {
+			status = "❌ " + strings.Join(c.Problems, ", ")
+		}
+		errors := fmt.Sprint(c.ErrorCount)
+		if c.ErrorCountRise > 0 {
+			errors += fmt.Sprintf(" (+%d)", c.ErrorCountRise)
+		}
+		t.AppendRow(table.Row{fmt.Sprintf("%s (%d)", c.Chain, c.ChainID), c.Height, c.Highest, c.Behind, errors, status})
+	}
+	t.Render()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	eth_crypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+func networks(heights map[vaa.ChainID]int64) []*gossipv1.Heartbeat_Network {
+	var ns []*gossipv1.Heartbeat_Network
+	for id, h := range heights {
+		ns = append(ns, &gossipv1.Heartbeat_Network{Id: uint32(id), Height: h})
+	}
+	return ns
+}
+
+func TestCheckHeartbeatContent(t *testing.T) {
+	g, o1, o2, o3 := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t), gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	others := []eth_common.Address{g.Addr, o1.Addr, o2.Addr, o3.Addr}
+	start := time.Now()
+	boot := start.Add(-time.Hour).UnixNano()
+	heartbeat := func(counter int64, at time.Time, heights map[vaa.ChainID]int64) *gossipv1.Heartbeat {
+		return &gossipv1.Heartbeat{NodeName: "g", Counter: counter, Timestamp: at.UnixNano(), BootTimestamp: boot, Version: "v2.24.0", Networks: networks(heights)}
+	}
+	peers := map[vaa.ChainID]int64{vaa.ChainIDEthereum: 20_000, vaa.ChainIDPolygon: 50_000, vaa.ChainIDSolana: 90_000}
+
+	tests := []struct {
+		name string
+		// heartbeats of g, received every 15s from the start.
+		heartbeats []*gossipv1.Heartbeat
+		// content is the failure of heartbeat_content, if any.
+		content string
+		// problems are the problems of each flagged chain.
+		problems map[string]string
+	}{
+		{
+			name:       "healthy",
+			heartbeats: []*gossipv1.Heartbeat{heartbeat(1, start, map[vaa.ChainID]int64{vaa.ChainIDEthereum: 19_500, vaa.ChainIDPolygon: 49_000, vaa.ChainIDSolana: 90_000})},
+		},
+		{
+			name:       "stale timestamp",
+			heartbeats: []*gossipv1.Heartbeat{heartbeat(1, start.Add(-5*time.Minute), peers)},
+			content:    "timestamp 5m0s off",
+		},
+		{
+			name:       "timestamp ahead",
+			heartbeats: []*gossipv1.Heartbeat{heartbeat(1, start.Add(2*time.Minute), peers)},
+			content:    "timestamp -2m0s off",
+		},
+		{
+			name: "counter went back",
+			heartbeats: []*gossipv1.Heartbeat{
+				heartbeat(5, start, peers),
+				heartbeat(4, start.Add(15*time.Second), peers),
+			},
+			content: "counter went from 5 to 4 without a restart",
+		},
+		{
+			name:       "behind",
+			heartbeats: []*gossipv1.Heartbeat{heartbeat(1, start, map[vaa.ChainID]int64{vaa.ChainIDEthereum: 18_999, vaa.ChainIDPolygon: 48_000, vaa.ChainIDSolana: 89_000})},
+			// Exactly the allowed difference is fine, and Polygon is allowed twice as much.
+			problems: map[string]string{"ethereum": "1001 blocks behind"},
+		},
+		{
+			name:       "height 0",
+			heartbeats: []*gossipv1.Heartbeat{heartbeat(1, start, map[vaa.ChainID]int64{vaa.ChainIDEthereum: 0, vaa.ChainIDPolygon: 50_000, vaa.ChainIDSolana: 90_000})},
+			problems:   map[string]string{"ethereum": "height 0"},
+		},
+		{
+			name:       "missing chain",
+			heartbeats: []*gossipv1.Heartbeat{heartbeat(1, start, map[vaa.ChainID]int64{vaa.ChainIDEthereum: 20_000, vaa.ChainIDSolana: 90_000})},
+			problems:   map[string]string{"polygon": "missing"},
+		},
+		{
+			name: "not advancing",
+			heartbeats: []*gossipv1.Heartbeat{
+				heartbeat(1, start, map[vaa.ChainID]int64{vaa.ChainIDEthereum: 19_900, vaa.ChainIDPolygon: 50_000, vaa.ChainIDSolana: 90_000}),
+				heartbeat(2, start.Add(15*time.Second), map[vaa.ChainID]int64{vaa.ChainIDEthereum: 19_900, vaa.ChainIDPolygon: 50_000, vaa.ChainIDSolana: 90_000}),
+			},
+			problems: map[string]string{"ethereum": "stale"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{logger: zap.NewNop(), w: newWindow()}
+			// Only o3 reports a fourth chain, which is not enough for it to be missing.
+			for i, o := range []gossiptest.Guardian{o1, o2, o3} {
+				heights := map[vaa.ChainID]int64{}
+				for id, h := range peers {
+					heights[id] = h - int64(i)
+				}
+				if o == o3 {
+					heights[vaa.ChainIDArbitrum] = 1000
+				}
+				s.handle(context.Background(), gossiptest.Envelope(t, o.Peer, "control", start, o.Heartbeat(t, heartbeat(1, start, heights))))
+			}
+			for i, hb := range tt.heartbeats {
+				at := start.Add(time.Duration(i) * 15 * time.Second)
+				s.handle(context.Background(), gossiptest.Envelope(t, g.Peer, "control", at, g.Heartbeat(t, hb)))
+			}
+
+			r, results := checkHeartbeatContent(g.Addr, s.collect(), others)
+			if r == nil || len(results) != 2 {
+				t.Fatalf("report %+v with %d results, want a report and 2 results", r, len(results))
+			}
+			content, chains := results[0], results[1]
+			if tt.content == "" && content.Status != statusPass {
+				t.Errorf("heartbeat_content = %+v, want it to pass", content)
+			}
+			if tt.content != "" && (content.Status != statusFail || content.exitCode != exitHeartbeatContent || !strings.Contains(content.Detail, tt.content)) {
+				t.Errorf("heartbeat_content = %+v, want it to fail with %q", content, tt.content)
+			}
+
+			flagged := map[string]string{}
+			for _, c := range r.Chains {
+				if len(c.Problems) > 0 {
+					flagged[c.Chain] = strings.Join(c.Problems, ", ")
+				}
+			}
+			if len(flagged) != len(tt.problems) {
+				t.Errorf("flagged chains %v, want %v", flagged, tt.problems)
+			}
+			for chain, want := range tt.problems {
+				if flagged[chain] != want {
+					t.Errorf("%s: problems %q, want %q", chain, flagged[chain], want)
+				}
+			}
+			if (len(tt.problems) == 0) != (chains.Status == statusPass) {
+				t.Errorf("chains = %+v, want it to pass only if no chain is flagged", chains)
+			}
+			if len(tt.problems) > 0 && chains.exitCode != exitChains {
+				t.Errorf("chains exit code %d, want %d", chains.exitCode, exitChains)
+			}
+		})
+	}
+}
+
+func TestCheckHeartbeatContentBehind(t *testing.T) {
+	g, o := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	now := time.Now()
+	s := &session{logger: zap.NewNop(), w: newWindow()}
+	s.handle(context.Background(), gossiptest.Envelope(t, o.Peer, "control", now, o.Heartbeat(t, &gossipv1.Heartbeat{
+		Counter: 1, Timestamp: now.UnixNano(), Networks: networks(map[vaa.ChainID]int64{vaa.ChainIDEthereum: 5000, vaa.ChainIDSolana: 100}),
+	})))
+	s.handle(context.Background(), gossiptest.Envelope(t, g.Peer, "control", now, g.Heartbeat(t, &gossipv1.Heartbeat{
+		Counter: 1, Timestamp: now.UnixNano(), Networks: networks(map[vaa.ChainID]int64{vaa.ChainIDEthereum: 4200, vaa.ChainIDSolana: 150}),
+	})))
+
+	r, _ := checkHeartbeatContent(g.Addr, s.collect(), []eth_common.Address{o.Addr})
+	want := []chainReport{
+		{ChainID: uint32(vaa.ChainIDSolana), Chain: "solana", Height: 150, Highest: 100},
+		{ChainID: uint32(vaa.ChainIDEthereum), Chain: "ethereum", Height: 4200, Highest: 5000, Behind: 800},
+	}
+	if len(r.Chains) != len(want) {
+		t.Fatalf("chains = %+v, want %+v", r.Chains, want)
+	}
+	for i, w := range want {
+		c := r.Chains[i]
+		if c.ChainID != w.ChainID || c.Chain != w.Chain || c.Height != w.Height || c.Highest != w.Highest || c.Behind != w.Behind || len(c.Problems) != 0 {
+			t.Errorf("chain %d = %+v, want %+v", i, c, w)
+		}
+	}
+}
+
+// TestHeartbeatOfWrongGuardian checks that a heartbeat whose content claims another guardian is not verified,
+// and so not checked.
+func TestHeartbeatOfWrongGuardian(t *testing.T) {
+	g, other := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	now := time.Now()
+	b, err := proto.Marshal(&gossipv1.Heartbeat{NodeName: "g", Counter: 1, Timestamp: now.UnixNano(), GuardianAddr: other.Addr.Hex()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := eth_crypto.Sign(eth_crypto.Keccak256Hash(append([]byte("heartbeat|"), b...)).Bytes(), g.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedHeartbeat{SignedHeartbeat: &gossipv1.SignedHeartbeat{
+		Heartbeat: b, Signature: sig, GuardianAddr: g.Addr.Bytes(),
+	}}}
+
+	s := &session{logger: zap.NewNop(), w: newWindow()}
+	s.handle(context.Background(), gossiptest.Envelope(t, g.Peer, "control", now, msg))
+	w := s.collect()
+	if a := w.guardians[g.Addr]; a == nil || a.invalidHeartbeats != 1 || len(a.heartbeats) != 0 {
+		t.Fatalf("activity = %+v, want one invalid heartbeat", a)
+	}
+	if _, ok := w.guardians[other.Addr]; ok {
+		t.Error("the heartbeat was credited to the guardian it claims")
+	}
+	r, results := checkHeartbeatContent(g.Addr, w, nil)
+	if r != nil {
+		t.Errorf("report = %+v, want none", r)
+	}
+	for _, res := range results {
+		if res.Status != statusSkip {
+			t.Errorf("%s = %+v, want it skipped", res.Name, res)
+		}
+	}
+}
@@ -1,49 +1,79 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/certusone/wormhole/node/pkg/common"
 	"github.com/certusone/wormhole/node/pkg/p2p"
-	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	publicrpcv1 "github.com/certusone/wormhole/node/pkg/proto/publicrpc/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
 
 	ipfslog "github.com/ipfs/go-log/v2"
-	pubsub "github.com/libp2p/go-libp2p-pubsub"
-	"github.com/libp2p/go-libp2p/core/peer"
 	"go.uber.org/zap"
-	"google.golang.org/protobuf/proto"
 )
 
 var (
-	pubKey       string
-	url          string
-	timeout      time.Duration
-	p2pNetworkID string
-	p2pBootstrap string
-	p2pPort      uint
-	nodeKeyPath  string
-	logLevel     string
+	pubKey            string
+	url               string
+	grpcAddr          string
+	grpcTLS           bool
+	vaaID             string
+	timeout           time.Duration
+	envStr            string
+	p2pNetworkID      string
+	p2pBootstrap      string
+	p2pPort           uint
+	nodeKeyPath       string
+	logLevel          string
+	all               bool
+	guardianSetSource string
+	ethRPC            string
+	ethContract       string
+	output            string
+	daemonMode        bool
+	interval          time.Duration
+	metricsConfig     metrics.Config
 )
 
+// Output formats.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// Without --all, the exit code is 0 if every check passed, or the code of the first failed check (see checks.go).
 func main() {
 
 	flag.StringVar(&pubKey, "pubKey", "", "A guardian public key")
-	flag.StringVar(&url, "url", "", "The public web url of a guardian")
+	flag.StringVar(&url, "url", "", "The public web url of a guardian, whose REST API is probed")
+	flag.StringVar(&grpcAddr, "grpc", "", "The host:port of the public gRPC API of a guardian, which is probed like the REST API")
+	flag.BoolVar(&grpcTLS, "grpcTLS", true, "Use TLS to connect to --grpc")
+	flag.StringVar(&vaaID, "vaaID", "", "A signed VAA the API probes fetch, as chain/emitter/sequence (default is the first VAA seen on gossip with --pubKey)")
 	flag.DurationVar(&timeout, "timeout", 15*time.Second, "The duration to wait for a heartbeat and observations")
-	flag.StringVar(&p2pNetworkID, "network", p2p.MainnetNetworkId, "P2P network identifier")
-	flag.StringVar(&p2pBootstrap, "bootstrap", p2p.MainnetBootstrapPeers, "The list of bootstrap peers (comma-separate) to connect to for gossip network tests. This can be useful to test a particular bootstrap peer.")
+	flag.StringVar(&envStr, "env", "mainnet", `The environment, which sets the defaults of the network, bootstrap peers and guardian set (may be "mainnet", "testnet" or "devnet")`)
+	flag.StringVar(&p2pNetworkID, "network", "", "P2P network identifier (default is based on env)")
+	flag.StringVar(&p2pBootstrap, "bootstrap", "", "The list of bootstrap peers (comma-separate) to connect to for gossip network tests. This can be useful to test a particular bootstrap peer. (default is based on env)")
 	flag.UintVar(&p2pPort, "port", p2p.DefaultPort, "P2P UDP listener port")
 	flag.StringVar(&nodeKeyPath, "nodeKeyPath", "/tmp/health_check.key", "A libp2p node key. Will be created if it does not exist.")
 	flag.StringVar(&logLevel, "logLevel", "error", "The logging level. Valid values are error, warn, info, and debug.")
+	flag.BoolVar(&all, "all", false, "Check every guardian of the current guardian set in one gossip session instead of --pubKey. The exit code is the number of guardians that failed. A --timeout of at least 30s is recommended.")
+	flag.StringVar(&guardianSetSource, "guardianSet", guardianSetContract, `Where --all and the API probes read the current guardian set from, "contract" (the core bridge on Ethereum) or "registry" (the known guardians of the environment)`)
+	flag.StringVar(&ethRPC, "ethRPC", "", "Ethereum RPC for fetching the current guardian set (default is based on env)")
+	flag.StringVar(&ethContract, "ethContract", "", "Ethereum core bridge address for fetching the current guardian set (default is based on env)")
+	flag.StringVar(&output, "output", outputText, `Output format, "text" or "json"`)
+	flag.BoolVar(&daemonMode, "daemon", false, "Keep running and evaluate the checks every --interval over one gossip session, exporting the results as metrics and on /healthz next to /metrics. --pubKey, --url and --grpc may then be comma separated lists, and --timeout only applies to the API probes.")
+	flag.DurationVar(&interval, "interval", time.Minute, "How often --daemon evaluates the checks, which is also the window gossip is checked over")
+	metricsConfig.RegisterFlags(flag.CommandLine, ":2112")
 	flag.Parse()
 
 	lvl, err := ipfslog.LevelFromString(logLevel)
@@ -56,167 +86,237 @@ func main() {
 	rootCtx, rootCtxCancel := context.WithCancel(context.Background())
 	defer rootCtxCancel()
 
-	if pubKey != "" {
-		priv, err := common.GetOrCreateNodeKey(logger, nodeKeyPath)
-		if err != nil {
-			logger.Fatal("Failed to load node key", zap.Error(err))
-		}
-		guardianPubKey, err := hex.DecodeString(strings.TrimPrefix(pubKey, "0x"))
-		if err != nil {
-			logger.Fatal("Failed to decode guardian public key", zap.Error(err))
-		}
-		logger.Info("Connecting to bootstrap peer(s)", zap.String("p2pBootstrap", p2pBootstrap))
-		localContext, localCancel := context.WithCancel(rootCtx)
-		defer localCancel()
-		hbReceived := false
-		var addrInfo peer.AddrInfo
-		observationBatchesReceived := 0
-		components := p2p.DefaultComponents()
-		components.Port = p2pPort
-		host, err := p2p.NewHost(logger, localContext, p2pNetworkID, p2pBootstrap, components, priv)
+	env, err := common.ParseEnvironment(envStr)
+	if err != nil || (env != common.UnsafeDevNet && env != common.TestNet && env != common.MainNet) {
+		logger.Fatal("Invalid value for --env, should be devnet, testnet or mainnet", zap.String("val", envStr))
+	}
+	if p2pNetworkID == "" {
+		p2pNetworkID = p2p.GetNetworkId(env)
+	}
+	if p2pBootstrap == "" {
+		p2pBootstrap, err = p2p.GetBootstrapPeers(env)
 		if err != nil {
-			logger.Fatal("failed to create host", zap.String("p2pBootstrap", p2pBootstrap), zap.Error(err))
+			logger.Fatal("failed to determine the bootstrap peers from the environment", zap.String("env", string(env)), zap.Error(err))
 		}
+	}
+	if output != outputText && output != outputJSON {
+		logger.Fatal("Invalid value for --output, should be text or json", zap.String("val", output))
+	}
 
-		ps, err := pubsub.NewGossipSub(localContext, host)
-		if err != nil {
-			logger.Fatal("failed to create subscription", zap.String("p2pBootstrap", p2pBootstrap), zap.Error(err))
-		}
+	if daemonMode {
+		ctx, stop := signal.NotifyContext(rootCtx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		runDaemon(ctx, logger, env)
+		return
+	}
+	if all {
+		os.Exit(runGuardianSet(rootCtx, logger, env))
+	}
 
-		topicControl := fmt.Sprintf("%s/%s", p2pNetworkID, "control")
-		topicAttestation := fmt.Sprintf("%s/%s", p2pNetworkID, "attestation")
-		topicControlHandle, err := ps.Join(topicControl)
-		if err != nil {
-			logger.Fatal("failed to join control topic", zap.String("p2pBootstrap", p2pBootstrap), zap.Error(err))
-		}
-		topicAttestationHandle, err := ps.Join(topicAttestation)
-		if err != nil {
-			logger.Fatal("failed to join attestation topic", zap.String("p2pBootstrap", p2pBootstrap), zap.Error(err))
-		}
-		subControl, err := topicControlHandle.Subscribe()
-		if err != nil {
-			logger.Fatal("failed to subscribe to control topic", zap.String("p2pBootstrap", p2pBootstrap), zap.Error(err))
-		}
-		subAttestation, err := topicAttestationHandle.Subscribe()
+	code := runGuardian(rootCtx, logger, env)
+	rootCtxCancel()
+	logger.Info("root context cancelled, exiting...")
+	os.Exit(code)
+}
+
+// runGuardian runs the checks of a single guardian, writes the report and returns the exit code.
+func runGuardian(ctx context.Context, logger *zap.Logger, env common.Environment) int {
+	var guardianAddr *eth_common.Address
+	if pubKey != "" {
+		addr, err := parseGuardianKey(pubKey)
 		if err != nil {
-			logger.Fatal("failed to subscribe to attestation topic", zap.String("p2pBootstrap", p2pBootstrap), zap.Error(err))
+			logger.Fatal("Failed to decode guardian public key, should be a 20 byte hex address", zap.String("pubKey", pubKey), zap.Error(err))
 		}
-		go func() {
-			for {
-				envelope, err := subControl.Next(localContext)
-				if err != nil {
-					logger.Info("failed to receive pubsub message", zap.Error(err))
-					break
-				}
-				var msg gossipv1.GossipMessage
-				err = proto.Unmarshal(envelope.Data, &msg)
-				if err != nil {
-					logger.Info("received invalid message",
-						zap.Binary("data", envelope.Data),
-						zap.String("from", envelope.GetFrom().String()))
-					continue
-				}
-				switch m := msg.Message.(type) {
-				case *gossipv1.GossipMessage_SignedHeartbeat:
-					logger.Debug("received heartbeat")
-					if bytes.Equal(m.SignedHeartbeat.GuardianAddr, guardianPubKey) {
-						addrInfo = host.Peerstore().PeerInfo(envelope.GetFrom())
-						if !hbReceived {
-							hbReceived = true
-						}
-					}
-				}
-			}
-			subControl.Cancel()
-		}()
-		go func() {
-			for {
-				envelope, err := subAttestation.Next(localContext)
-				if err != nil {
-					logger.Info("failed to receive pubsub message", zap.Error(err))
-					break
-				}
-				var msg gossipv1.GossipMessage
-				err = proto.Unmarshal(envelope.Data, &msg)
-				if err != nil {
-					logger.Info("received invalid message",
-						zap.Binary("data", envelope.Data),
-						zap.String("from", envelope.GetFrom().String()))
-					continue
-				}
-				switch m := msg.Message.(type) {
-				case *gossipv1.GossipMessage_SignedObservationBatch:
-					logger.Debug("received observation batch")
-					if bytes.Equal(m.SignedObservationBatch.Addr, guardianPubKey) {
-						observationBatchesReceived++
-					}
-				}
-			}
-			subAttestation.Cancel()
-		}()
+		guardianAddr = &addr
+	}
+	id, err := parseVAAIDFlag()
+	if err != nil {
+		logger.Fatal("Invalid value for --vaaID", zap.String("val", vaaID), zap.Error(err))
+	}
+
+	var results []checkResult
+	var hbReport *heartbeatReport
+	st := &probeState{guardian: guardianAddr, vaaID: id}
+	if url != "" || grpcAddr != "" {
+		st.guardianSet, st.guardianSetIndex = currentGuardianSet(logger, env)
+	}
+	if guardianAddr != nil {
+		sessionCtx, sessionCancel := context.WithCancel(ctx)
+		s := startGossip(sessionCtx, logger)
 		time.Sleep(timeout)
-		// Cancel local context to break out of sub.Next()
-		localCancel()
-		logger.Debug("local context cancelled")
-		// Start shutdown
+		st.gossip = s.collect()
+		var guardianResults []checkResult
+		guardianResults, hbReport = guardianChecks(s, st.gossip, *guardianAddr, addresses(knownGuardians(logger, env)))
+		results = append(results, guardianResults...)
+		sessionCancel()
 		logger.Info("Shutting down...")
-		if err := topicControlHandle.Close(); err != nil {
-			logger.Debug("Error closing the control topic", zap.Error(err))
-		}
-		if err := topicAttestationHandle.Close(); err != nil {
-			logger.Debug("Error closing the attestation topic", zap.Error(err))
-		}
-		if err := host.Close(); err != nil {
-			logger.Info("Error closing the host", zap.Error(err))
-		}
-		// End shutdown
-		if hbReceived {
-			fmt.Println("✅ guardian heartbeat received", addrInfo.String())
-		} else {
-			fmt.Println("❌ NO HEARTBEAT RECEIVED")
-		}
-		if observationBatchesReceived > 0 {
-			fmt.Printf("✅ %d observationBatches received\n", observationBatchesReceived)
-		} else {
-			fmt.Println("❌ NO OBSERVATIONS RECEIVED")
-		}
+		s.close()
 	} else {
-		fmt.Println("ℹ️  --pubKey not defined, skipping gossip checks")
+		results = append(results, skip("gossip", "--pubKey not defined, skipping gossip checks"))
 	}
 
 	if url != "" {
-		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-			logger.Fatal("url must start with http:// or https://")
-		}
-		hbSuccess := false
-		url = strings.TrimSuffix(url, "/")
-		logger.Info("Testing http services")
-		res, err := http.Get(fmt.Sprintf("%s/v1/heartbeats", url))
-		if err != nil {
-			logger.Info("error fetching heartbeats", zap.Error(err))
-		} else {
-			if res.StatusCode == 200 {
-				body, err := io.ReadAll(res.Body)
-				if err != nil {
-					logger.Info("error reading body", zap.Error(err))
-				} else {
-					if string(body[:10]) == "{\"entries\"" {
-						hbSuccess = true
-					}
-				}
-			} else {
-				logger.Info("bad status fetching heartbeats", zap.Int("status", res.StatusCode))
-			}
-		}
-		if hbSuccess {
-			fmt.Println("✅ /v1/heartbeats")
-		} else {
-			fmt.Println("❌ /v1/heartbeats")
-		}
+		results = append(results, probeREST(ctx, logger, url, st)...)
+	} else {
+		results = append(results, skip("rest", "--url not defined, skipping web checks"))
+	}
+	if grpcAddr != "" {
+		results = append(results, probeGRPC(ctx, logger, grpcAddr, st)...)
 	} else {
-		fmt.Println("ℹ️  --url not defined, skipping web checks")
+		results = append(results, skip("grpc", "--grpc not defined, skipping gRPC checks"))
 	}
 
-	rootCtxCancel()
-	logger.Info("root context cancelled, exiting...")
+	code := exitCode(results)
+	report := checkReport{Guardian: pubKey, URL: url, GRPC: grpcAddr, Healthy: code == 0, Checks: results, Heartbeat: hbReport}
+	if err := writeCheckReport(os.Stdout, output, report); err != nil {
+		logger.Fatal("Failed to write the report", zap.Error(err))
+	}
+	return code
+}
+
+func parseGuardianKey(s string) (eth_common.Address, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return eth_common.Address{}, err
+	}
+	if len(key) != eth_common.AddressLength {
+		return eth_common.Address{}, fmt.Errorf("expected %d bytes, got %d", eth_common.AddressLength, len(key))
+	}
+	return eth_common.BytesToAddress(key), nil
+}
+
+func parseVAAIDFlag() (*publicrpcv1.MessageID, error) {
+	if vaaID == "" {
+		return nil, nil
+	}
+	return parseVAAID(vaaID)
+}
+
+// startGossip starts a gossip session with the node key, which lasts until the context is cancelled.
+func startGossip(ctx context.Context, logger *zap.Logger) *session {
+	priv, err := common.GetOrCreateNodeKey(logger, nodeKeyPath)
+	if err != nil {
+		logger.Fatal("Failed to load node key", zap.Error(err))
+	}
+	logger.Info("Connecting to bootstrap peer(s)", zap.String("p2pBootstrap", p2pBootstrap))
+	s, err := startSession(ctx, logger, gossip.ListenerConfig{
+		NetworkID: p2pNetworkID,
+		Bootstrap: p2pBootstrap,
+		Port:      p2pPort,
+		Priv:      priv,
+	})
+	if err != nil {
+		logger.Fatal("Failed to start the gossip session", zap.String("p2pBootstrap", p2pBootstrap), zap.Error(err))
+	}
+	return s
+}
+
+// knownGuardians are the guardians of the registry, the only ones trusted to report the heights a guardian is compared with.
+func knownGuardians(logger *zap.Logger, env common.Environment) []guardianInfo {
+	known, _, err := loadGuardianSet(env, guardianSetRegistry, "", "")
+	if err != nil {
+		logger.Fatal("Failed to load the known guardians", zap.Error(err))
+	}
+	return known
+}
+
+// currentGuardianSet loads the current guardian set from --guardianSet for the API probes. It returns nil if it
+// could not be loaded, which only skips the comparisons with it.
+func currentGuardianSet(logger *zap.Logger, env common.Environment) ([]eth_common.Address, uint32) {
+	rpcUrl, coreBridgeAddr := guardianSetRPC(env)
+	guardians, index, err := loadGuardianSet(env, guardianSetSource, rpcUrl, coreBridgeAddr)
+	if err != nil {
+		logger.Warn("Failed to load the guardian set, the APIs are not compared with it", zap.Error(err))
+		return nil, 0
+	}
+	return addresses(guardians), *index
+}
+
+// guardianChecks checks what the guardian sent on gossip during the window: verified heartbeats, observations,
+// and the content of its heartbeats.
+func guardianChecks(s *session, w *window, guardianAddr eth_common.Address, others []eth_common.Address) ([]checkResult, *heartbeatReport) {
+	elapsed := time.Since(w.since)
+	a, ok := w.guardians[guardianAddr]
+	if !ok {
+		a = &guardianActivity{}
+	}
+
+	var heartbeat checkResult
+	if last, ok := a.lastHeartbeat(); ok {
+		heartbeat = pass("heartbeat", fmt.Sprintf("%d verified heartbeats received from %s", len(a.heartbeats), s.peerInfo(last.from).String()), a.heartbeats[0].receivedAt.Sub(w.since))
+	} else if a.invalidHeartbeats > 0 {
+		heartbeat = fail("heartbeat", exitHeartbeat, fmt.Sprintf("%d heartbeats failed verification", a.invalidHeartbeats), elapsed)
+	} else {
+		heartbeat = fail("heartbeat", exitHeartbeat, "no heartbeat received", elapsed)
+	}
+	var observations checkResult
+	if a.observationBatches > 0 {
+		observations = pass("observations", fmt.Sprintf("%d observation batches received", a.observationBatches), a.firstObservationAt.Sub(w.since))
+	} else if a.invalidObservationBatches > 0 {
+		observations = fail("observations", exitObservations, fmt.Sprintf("%d observation batches failed verification", a.invalidObservationBatches), elapsed)
+	} else {
+		observations = fail("observations", exitObservations, "no observations received", elapsed)
+	}
+
+	hbReport, contentResults := checkHeartbeatContent(guardianAddr, w, others)
+	return append([]checkResult{heartbeat, observations}, contentResults...), hbReport
+}
+
+func probeREST(ctx context.Context, logger *zap.Logger, url string, st *probeState) []checkResult {
+	logger.Info("Probing the REST API", zap.String("url", url))
+	return runProbes(ctx, "rest", exitREST, newRESTAPI(url, timeout), st)
+}
+
+func probeGRPC(ctx context.Context, logger *zap.Logger, addr string, st *probeState) []checkResult {
+	logger.Info("Probing the gRPC API", zap.String("addr", addr))
+	api, err := newGRPCAPI(addr, grpcTLS)
+	if err != nil {
+		return []checkResult{fail("grpc", exitGRPC, fmt.Sprintf("failed to create the client: %v", err), 0)}
+	}
+	defer api.close()
+	return runProbes(ctx, "grpc", exitGRPC, api, st)
+}
+
+// guardianSetRPC returns the Ethereum RPC and core bridge the guardian set is fetched from, defaulting from the environment.
+func guardianSetRPC(env common.Environment) (string, string) {
+	rpcUrl, coreBridgeAddr := ethRPC, ethContract
+	switch env {
+	case common.MainNet:
+		rpcUrl, coreBridgeAddr = withDefault(rpcUrl, "https://ethereum-rpc.publicnode.com"), withDefault(coreBridgeAddr, "0x98f3c9e6E3fAce36bAAd05FE09d375Ef1464288B")
+	case common.TestNet:
+		rpcUrl, coreBridgeAddr = withDefault(rpcUrl, "https://ethereum-holesky-rpc.publicnode.com"), withDefault(coreBridgeAddr, "0xa10f2eF61dE1f19f586ab8B6F2EbA89bACE63F7a")
+	case common.UnsafeDevNet:
+		rpcUrl, coreBridgeAddr = withDefault(rpcUrl, "http://localhost:8545"), withDefault(coreBridgeAddr, "0xC89Ce4735882C9F0f0FE26686c53074E09B0D550")
+	}
+	return rpcUrl, coreBridgeAddr
+}
+
+// runGuardianSet checks every guardian of the set and returns the number of guardians that failed.
+func runGuardianSet(ctx context.Context, logger *zap.Logger, env common.Environment) int {
+	rpcUrl, coreBridgeAddr := guardianSetRPC(env)
+	guardians, gsIndex, err := loadGuardianSet(env, guardianSetSource, rpcUrl, coreBridgeAddr)
+	if err != nil {
+		logger.Fatal("Failed to load the guardian set", zap.Error(err))
+	}
+
+	sessionCtx, sessionCancel := context.WithCancel(ctx)
+	defer sessionCancel()
+	s := startGossip(sessionCtx, logger)
+	logger.Info("Listening to gossip", zap.Int("guardians", len(guardians)), zap.Duration("timeout", timeout))
+	time.Sleep(timeout)
+	reports := checkGuardianSet(s, guardians, s.collect().guardians)
+	sessionCancel()
+	s.close()
+
+	if err := writeGuardianSetReport(os.Stdout, output, gsIndex, reports); err != nil {
+		logger.Fatal("Failed to write the report", zap.Error(err))
+	}
+	return guardianSetExitCode(reports)
+}
+
+func withDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
 }
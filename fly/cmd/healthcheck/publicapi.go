@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	publicrpcv1 "github.com/certusone/wormhole/node/pkg/proto/publicrpc/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// publicAPI is the part of the guardian public API that is probed. It is served over REST and gRPC.
+type publicAPI interface {
+	lastHeartbeats(ctx context.Context) (*publicrpcv1.GetLastHeartbeatsResponse, error)
+	currentGuardianSet(ctx context.Context) (*publicrpcv1.GetCurrentGuardianSetResponse, error)
+	availableNotional(ctx context.Context) (*publicrpcv1.GovernorGetAvailableNotionalByChainResponse, error)
+	enqueuedVAAs(ctx context.Context) (*publicrpcv1.GovernorGetEnqueuedVAAsResponse, error)
+	tokenList(ctx context.Context) (*publicrpcv1.GovernorGetTokenListResponse, error)
+	signedVAA(ctx context.Context, id *publicrpcv1.MessageID) (*publicrpcv1.GetSignedVAAResponse, error)
+}
+
+// maxResponseBytes bounds the REST responses, the token list being the largest.
+const maxResponseBytes = 16 << 20
+
+// restAPI is the REST gateway of the public API, e.g. https://guardian.example.com.
+type restAPI struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newRESTAPI(baseURL string, timeout time.Duration) *restAPI {
+	return &restAPI{baseURL: strings.TrimSuffix(baseURL, "/"), client: &http.Client{Timeout: timeout}}
+}
+
+// get fetches path and decodes the response into m. Unknown fields are allowed so newer guardians can be probed.
+func (a *restAPI) get(ctx context.Context, path string, m proto.Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read the response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status %d: %s", res.StatusCode, truncate(string(body), 200))
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, m); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+func (a *restAPI) lastHeartbeats(ctx context.Context) (*publicrpcv1.GetLastHeartbeatsResponse, error) {
+	var res publicrpcv1.GetLastHeartbeatsResponse
+	return &res, a.get(ctx, "/v1/heartbeats", &res)
+}
+
+func (a *restAPI) currentGuardianSet(ctx context.Context) (*publicrpcv1.GetCurrentGuardianSetResponse, error) {
+	var res publicrpcv1.GetCurrentGuardianSetResponse
+	return &res, a.get(ctx, "/v1/guardianset/current", &res)
+}
+
+func (a *restAPI) availableNotional(ctx context.Context) (*publicrpcv1.GovernorGetAvailableNotionalByChainResponse, error) {
+	var res publicrpcv1.GovernorGetAvailableNotionalByChainResponse
+	return &res, a.get(ctx, "/v1/governor/available_notional_by_chain", &res)
+}
+
+func (a *restAPI) enqueuedVAAs(ctx context.Context) (*publicrpcv1.GovernorGetEnqueuedVAAsResponse, error) {
+	var res publicrpcv1.GovernorGetEnqueuedVAAsResponse
+	return &res, a.get(ctx, "/v1/governor/enqueued_vaas", &res)
+}
+
+func (a *restAPI) tokenList(ctx context.Context) (*publicrpcv1.GovernorGetTokenListResponse, error) {
+	var res publicrpcv1.GovernorGetTokenListResponse
+	return &res, a.get(ctx, "/v1/governor/token_list", &res)
+}
+
+func (a *restAPI) signedVAA(ctx context.Context, id *publicrpcv1.MessageID) (*publicrpcv1.GetSignedVAAResponse, error) {
+	var res publicrpcv1.GetSignedVAAResponse
+	return &res, a.get(ctx, fmt.Sprintf("/v1/signed_vaa/%d/%s/%d", id.EmitterChain, id.EmitterAddress, id.Sequence), &res)
+}
+
+// grpcAPI is the gRPC service of the public API, e.g. guardian.example.com:443.
+type grpcAPI struct {
+	conn   *grpc.ClientConn
+	client publicrpcv1.PublicRPCServiceClient
+}
+
+func newGRPCAPI(addr string, tlsEnabled bool) (*grpcAPI, error) {
+	creds := insecure.NewCredentials()
+	if tlsEnabled {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcAPI{conn: conn, client: publicrpcv1.NewPublicRPCServiceClient(conn)}, nil
+}
+
+func (a *grpcAPI) close() {
+	a.conn.Close()
+}
+
+func (a *grpcAPI) lastHeartbeats(ctx context.Context) (*publicrpcv1.GetLastHeartbeatsResponse, error) {
+	return a.client.GetLastHeartbeats(ctx, &publicrpcv1.GetLastHeartbeatsRequest{})
+}
+
+func (a *grpcAPI) currentGuardianSet(ctx context.Context) (*publicrpcv1.GetCurrentGuardianSetResponse, error) {
+	return a.client.GetCurrentGuardianSet(ctx, &publicrpcv1.GetCurrentGuardianSetRequest{})
+}
+
+func (a *grpcAPI) availableNotional(ctx context.Context) (*publicrpcv1.GovernorGetAvailableNotionalByChainResponse, error) {
+	return a.client.GovernorGetAvailableNotionalByChain(ctx, &publicrpcv1.GovernorGetAvailableNotionalByChainRequest{})
+}
+
+func (a *grpcAPI) enqueuedVAAs(ctx context.Context) (*publicrpcv1.GovernorGetEnqueuedVAAsResponse, error) {
+	return a.client.GovernorGetEnqueuedVAAs(ctx, &publicrpcv1.GovernorGetEnqueuedVAAsRequest{})
+}
+
+func (a *grpcAPI) tokenList(ctx context.Context) (*publicrpcv1.GovernorGetTokenListResponse, error) {
+	return a.client.GovernorGetTokenList(ctx, &publicrpcv1.GovernorGetTokenListRequest{})
+}
+
+func (a *grpcAPI) signedVAA(ctx context.Context, id *publicrpcv1.MessageID) (*publicrpcv1.GetSignedVAAResponse, error) {
+	return a.client.GetSignedVAA(ctx, &publicrpcv1.GetSignedVAARequest{MessageId: id})
+}
+
+// heartbeatCounterSlack is how many heartbeats the API may be behind gossip, as the guardian may not have
+// received the heartbeats we just did.
+const heartbeatCounterSlack = 2
+
+// probeState is shared by the probes of one API. Probes run in order, so later probes can use what earlier ones learned.
+type probeState struct {
+	// guardian is the probed guardian, if --pubKey is set.
+	guardian *eth_common.Address
+	// gossip is the activity seen during the gossip checks, if any.
+	gossip *window
+	// vaaID is the VAA to fetch from --vaaID, which takes precedence over the VAAs seen on gossip.
+	vaaID *publicrpcv1.MessageID
+	// guardianSet is the current guardian set from loadGuardianSet, which the guardian set of the API is compared with
+	// and signed VAAs are verified against. It is nil if the guardian set could not be loaded.
+	guardianSet      []eth_common.Address
+	guardianSetIndex uint32
+}
+
+// errSkipped is returned by a probe that has nothing to check.
+type errSkipped string
+
+func (e errSkipped) Error() string {
+	return string(e)
+}
+
+type apiProbe struct {
+	name string
+	run  func(ctx context.Context, api publicAPI, st *probeState) (string, error)
+}
+
+// apiProbes run in this order. The exit code of a failed probe is the base exit code of the API plus its index.
+var apiProbes = []apiProbe{
+	{"heartbeats", probeHeartbeats},
+	{"guardianset", probeGuardianSet},
+	{"governor_available_notional", probeAvailableNotional},
+	{"governor_enqueued_vaas", probeEnqueuedVAAs},
+	{"governor_token_list", probeTokenList},
+	{"signed_vaa", probeSignedVAA},
+}
+
+// runProbes runs every probe against api. Check names are prefixed, e.g. "rest/heartbeats".
+func runProbes(ctx context.Context, prefix string, baseExitCode int, api publicAPI, st *probeState) []checkResult {
+	results := make([]checkResult, 0, len(apiProbes))
+	for i, p := range apiProbes {
+		name := prefix + "/" + p.name
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		detail, err := p.run(probeCtx, api, st)
+		latency := time.Since(start)
+		cancel()
+		var skipped errSkipped
+		switch {
+		case errors.As(err, &skipped):
+			results = append(results, skip(name, skipped.Error()))
+		case err != nil:
+			results = append(results, fail(name, baseExitCode+i, err.Error(), latency))
+		default:
+			results = append(results, pass(name, detail, latency))
+		}
+	}
+	return results
+}
+
+func probeHeartbeats(ctx context.Context, api publicAPI, st *probeState) (string, error) {
+	res, err := api.lastHeartbeats(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(res.Entries) == 0 {
+		return "", errors.New("no heartbeats")
+	}
+	counters := map[eth_common.Address]int64{}
+	for _, e := range res.Entries {
+		hb := e.RawHeartbeat
+		switch {
+		case !eth_common.IsHexAddress(e.VerifiedGuardianAddr):
+			return "", fmt.Errorf("invalid guardian address %q", e.VerifiedGuardianAddr)
+		case hb == nil:
+			return "", fmt.Errorf("heartbeat of %s is missing", e.VerifiedGuardianAddr)
+		case hb.Counter <= 0 || hb.Timestamp <= 0 || hb.NodeName == "":
+			return "", fmt.Errorf("heartbeat of %s is incomplete", e.VerifiedGuardianAddr)
+		}
+		addr := eth_common.HexToAddress(e.VerifiedGuardianAddr)
+		counters[addr] = max(counters[addr], hb.Counter)
+	}
+	if st.guardian != nil {
+		if _, ok := counters[*st.guardian]; !ok {
+			return "", fmt.Errorf("no heartbeat of the guardian itself among %d", len(res.Entries))
+		}
+	}
+	detail := fmt.Sprintf("%d heartbeats", len(res.Entries))
+	if st.gossip == nil {
+		return detail, nil
+	}
+
+	// The API must not be behind the heartbeats received on gossip.
+	compared := 0
+	var stale []string
+	for addr, a := range st.gossip.guardians {
+		last, ok := a.lastHeartbeat()
+		counter, known := counters[addr]
+		if !ok || !known {
+			continue
+		}
+		compared++
+		if counter < last.hb.Counter-heartbeatCounterSlack {
+			stale = append(stale, fmt.Sprintf("%s (%d < %d)", last.hb.NodeName, counter, last.hb.Counter))
+		}
+	}
+	if len(stale) > 0 {
+		return "", fmt.Errorf("counters behind gossip for %s", strings.Join(stale, ", "))
+	}
+	return fmt.Sprintf("%s, %d counters consistent with gossip", detail, compared), nil
+}
+
+func probeGuardianSet(ctx context.Context, api publicAPI, st *probeState) (string, error) {
+	res, err := api.currentGuardianSet(ctx)
+	if err != nil {
+		return "", err
+	}
+	gs := res.GuardianSet
+	if gs == nil || len(gs.Addresses) == 0 {
+		return "", errors.New("empty guardian set")
+	}
+	keys := make([]eth_common.Address, len(gs.Addresses))
+	seen := map[eth_common.Address]bool{}
+	for i, s := range gs.Addresses {
+		if !eth_common.IsHexAddress(s) {
+			return "", fmt.Errorf("invalid guardian address %q", s)
+		}
+		keys[i] = eth_common.HexToAddress(s)
+		if seen[keys[i]] {
+			return "", fmt.Errorf("duplicate guardian %s", s)
+		}
+		seen[keys[i]] = true
+	}
+	if st.guardian != nil && !seen[*st.guardian] {
+		return "", fmt.Errorf("guardian %s is not in guardian set %d", st.guardian.Hex(), gs.Index)
+	}
+
+	detail := fmt.Sprintf("guardian set %d of %d guardians", gs.Index, len(keys))
+	if st.guardianSet == nil {
+		return detail, nil
+	}
+	if gs.Index != st.guardianSetIndex {
+		return "", fmt.Errorf("guardian set %d, but the current one is %d", gs.Index, st.guardianSetIndex)
+	}
+	if !slices.Equal(keys, st.guardianSet) {
+		return "", fmt.Errorf("guardian set %d differs from the current one", gs.Index)
+	}
+	return detail + ", current", nil
+}
+
+func probeAvailableNotional(ctx context.Context, api publicAPI, _ *probeState) (string, error) {
+	res, err := api.availableNotional(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(res.Entries) == 0 {
+		return "", errors.New("no governed chains")
+	}
+	seen := map[uint32]bool{}
+	for _, e := range res.Entries {
+		switch {
+		case e.ChainId == 0 || e.ChainId > math.MaxUint16:
+			return "", fmt.Errorf("invalid chain %d", e.ChainId)
+		case seen[e.ChainId]:
+			return "", fmt.Errorf("duplicate chain %d", e.ChainId)
+		case e.RemainingAvailableNotional > e.NotionalLimit:
+			return "", fmt.Errorf("chain %d has %d available, above its limit of %d", e.ChainId, e.RemainingAvailableNotional, e.NotionalLimit)
+		}
+		seen[e.ChainId] = true
+	}
+	return fmt.Sprintf("%d chains", len(res.Entries)), nil
+}
+
+func probeEnqueuedVAAs(ctx context.Context, api publicAPI, _ *probeState) (string, error) {
+	res, err := api.enqueuedVAAs(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range res.Entries {
+		switch {
+		case e.EmitterChain == 0 || e.EmitterChain > math.MaxUint16:
+			return "", fmt.Errorf("invalid emitter chain %d", e.EmitterChain)
+		case !isHexAddress32(e.EmitterAddress):
+			return "", fmt.Errorf("invalid emitter address %q", e.EmitterAddress)
+		case e.ReleaseTime == 0:
+			return "", fmt.Errorf("%d/%s/%d has no release time", e.EmitterChain, e.EmitterAddress, e.Sequence)
+		case e.TxHash == "":
+			return "", fmt.Errorf("%d/%s/%d has no transaction hash", e.EmitterChain, e.EmitterAddress, e.Sequence)
+		}
+	}
+	return fmt.Sprintf("%d enqueued VAAs", len(res.Entries)), nil
+}
+
+func probeTokenList(ctx context.Context, api publicAPI, _ *probeState) (string, error) {
+	res, err := api.tokenList(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(res.Entries) == 0 {
+		return "", errors.New("no governed tokens")
+	}
+	for _, e := range res.Entries {
+		switch {
+		case e.OriginChainId == 0 || e.OriginChainId > math.MaxUint16:
+			return "", fmt.Errorf("invalid origin chain %d", e.OriginChainId)
+		case e.OriginAddress == "":
+			return "", fmt.Errorf("token of chain %d has no address", e.OriginChainId)
+		case math.IsNaN(float64(e.Price)) || e.Price < 0:
+			return "", fmt.Errorf("token %d/%s has an invalid price %v", e.OriginChainId, e.OriginAddress, e.Price)
+		}
+	}
+	return fmt.Sprintf("%d tokens", len(res.Entries)), nil
+}
+
+func probeSignedVAA(ctx context.Context, api publicAPI, st *probeState) (string, error) {
+	id := st.vaaID
+	if id == nil && st.gossip != nil && st.gossip.vaas.first != nil {
+		v := st.gossip.vaas.first
+		id = &publicrpcv1.MessageID{
+			EmitterChain:   publicrpcv1.ChainID(v.EmitterChain),
+			EmitterAddress: hex.EncodeToString(v.EmitterAddress[:]),
+			Sequence:       v.Sequence,
+		}
+	}
+	if id == nil {
+		return "", errSkipped("no --vaaID and no VAA seen on gossip")
+	}
+	name := fmt.Sprintf("%d/%s/%d", id.EmitterChain, id.EmitterAddress, id.Sequence)
+
+	res, err := api.signedVAA(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	v, err := vaa.Unmarshal(res.VaaBytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid VAA: %w", name, err)
+	}
+	if uint32(v.EmitterChain) != uint32(id.EmitterChain) || hex.EncodeToString(v.EmitterAddress[:]) != strings.ToLower(id.EmitterAddress) || v.Sequence != id.Sequence {
+		return "", fmt.Errorf("%s: got VAA %s instead", name, v.MessageID())
+	}
+	// VAAs signed by a previous guardian set cannot be verified against the current one.
+	if st.guardianSet == nil || v.GuardianSetIndex != st.guardianSetIndex {
+		return fmt.Sprintf("%s signed by guardian set %d, not verified", name, v.GuardianSetIndex), nil
+	}
+	if err := v.Verify(st.guardianSet); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return fmt.Sprintf("%s verified, %d signatures", name, len(v.Signatures)), nil
+}
+
+// parseVAAID parses a VAA ID of the form chain/emitter/sequence, e.g. 2/0000000000000000000000003ee18b2214aff97000d974cf647e7c347e8fa585/1.
+func parseVAAID(s string) (*publicrpcv1.MessageID, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected chain/emitter/sequence, got %q", s)
+	}
+	chain, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain: %w", err)
+	}
+	if !isHexAddress32(parts[1]) {
+		return nil, fmt.Errorf("invalid emitter address %q, should be 32 bytes of hex", parts[1])
+	}
+	seq, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sequence: %w", err)
+	}
+	return &publicrpcv1.MessageID{
+		EmitterChain:   publicrpcv1.ChainID(chain),
+		EmitterAddress: strings.ToLower(parts[1]),
+		Sequence:       seq,
+	}, nil
+}
+
+// isHexAddress32 reports whether s is a 32 byte address in hex, without prefix, as emitters are in the API.
+func isHexAddress32(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	publicrpcv1 "github.com/certusone/wormhole/node/pkg/proto/publicrpc/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// restServer serves api over REST like the gateway of a guardian. Paths in bodies are served as is instead.
+func restServer(t *testing.T, api *fakeAPI, bodies map[string]string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, ok := bodies[r.URL.Path]; ok {
+			if body == "" {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		ctx := r.Context()
+		var m proto.Message
+		var err error
+		switch r.URL.Path {
+		case "/v1/heartbeats":
+			m, err = api.lastHeartbeats(ctx)
+		case "/v1/guardianset/current":
+			m, err = api.currentGuardianSet(ctx)
+		case "/v1/governor/available_notional_by_chain":
+			m, err = api.availableNotional(ctx)
+		case "/v1/governor/enqueued_vaas":
+			m, err = api.enqueuedVAAs(ctx)
+		case "/v1/governor/token_list":
+			m, err = api.tokenList(ctx)
+		case fmt.Sprintf("/v1/signed_vaa/%d/%s/%d", testVAAID.EmitterChain, testVAAID.EmitterAddress, testVAAID.Sequence):
+			m, err = api.signedVAA(ctx, testVAAID)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		b, err := protojson.Marshal(m)
+		if err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// grpcServer serves api over gRPC.
+type grpcServer struct {
+	publicrpcv1.UnimplementedPublicRPCServiceServer
+	api *fakeAPI
+}
+
+func (s *grpcServer) GetLastHeartbeats(ctx context.Context, _ *publicrpcv1.GetLastHeartbeatsRequest) (*publicrpcv1.GetLastHeartbeatsResponse, error) {
+	return orNil(s.api.lastHeartbeats(ctx))
+}
+
+func (s *grpcServer) GetCurrentGuardianSet(ctx context.Context, _ *publicrpcv1.GetCurrentGuardianSetRequest) (*publicrpcv1.GetCurrentGuardianSetResponse, error) {
+	return orNil(s.api.currentGuardianSet(ctx))
+}
+
+func (s *grpcServer) GovernorGetAvailableNotionalByChain(ctx context.Context, _ *publicrpcv1.GovernorGetAvailableNotionalByChainRequest) (*publicrpcv1.GovernorGetAvailableNotionalByChainResponse, error) {
+	return orNil(s.api.availableNotional(ctx))
+}
+
+func (s *grpcServer) GovernorGetEnqueuedVAAs(ctx context.Context, _ *publicrpcv1.GovernorGetEnqueuedVAAsRequest) (*publicrpcv1.GovernorGetEnqueuedVAAsResponse, error) {
+	return orNil(s.api.enqueuedVAAs(ctx))
+}
+
+func (s *grpcServer) GovernorGetTokenList(ctx context.Context, _ *publicrpcv1.GovernorGetTokenListRequest) (*publicrpcv1.GovernorGetTokenListResponse, error) {
+	return orNil(s.api.tokenList(ctx))
+}
+
+func (s *grpcServer) GetSignedVAA(ctx context.Context, req *publicrpcv1.GetSignedVAARequest) (*publicrpcv1.GetSignedVAAResponse, error) {
+	return orNil(s.api.signedVAA(ctx, req.MessageId))
+}
+
+// orNil drops the response of a failed call, as gRPC handlers must.
+func orNil[T any](res *T, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func startGRPCServer(t *testing.T, api *fakeAPI) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	publicrpcv1.RegisterPublicRPCServiceServer(srv, &grpcServer{api: api})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// probeResults indexes the results of runProbes by probe name.
+func probeResults(results []checkResult) map[string]checkResult {
+	byName := map[string]checkResult{}
+	for _, r := range results {
+		_, name, _ := strings.Cut(r.Name, "/")
+		byName[name] = r
+	}
+	return byName
+}
+
+func TestProbeREST(t *testing.T) {
+	setTimeout(t, 5*time.Second)
+	g := gossiptest.NewGuardian(t)
+	addr := g.Addr.Hex()
+	signedVAAPath := fmt.Sprintf("/v1/signed_vaa/%d/%s/%d", testVAAID.EmitterChain, testVAAID.EmitterAddress, testVAAID.Sequence)
+	tests := []struct {
+		name   string
+		bodies map[string]string
+		// failed is the probe that fails and its error.
+		failed, detail string
+	}{
+		{name: "healthy"},
+		{"truncated", map[string]string{"/v1/heartbeats": `{"entries":[`}, "heartbeats", "invalid response"},
+		{"bad address", map[string]string{"/v1/heartbeats": `{"entries":[{"verifiedGuardianAddr":"nope"}]}`}, "heartbeats", `invalid guardian address "nope"`},
+		{"incomplete heartbeat", map[string]string{"/v1/heartbeats": fmt.Sprintf(`{"entries":[{"verifiedGuardianAddr":%q,"rawHeartbeat":{"nodeName":"g0"}}]}`, addr)}, "heartbeats", "incomplete"},
+		{"wrong type", map[string]string{"/v1/guardianset/current": `{"guardianSet":{"index":"four"}}`}, "guardianset", "invalid response"},
+		{"duplicate guardian", map[string]string{"/v1/guardianset/current": fmt.Sprintf(`{"guardianSet":{"index":4,"addresses":[%q,%q]}}`, addr, addr)}, "guardianset", "duplicate guardian"},
+		{"above limit", map[string]string{"/v1/governor/available_notional_by_chain": `{"entries":[{"chainId":2,"remainingAvailableNotional":"30","notionalLimit":"20"}]}`}, "governor_available_notional", "above its limit"},
+		{"server error", map[string]string{"/v1/governor/enqueued_vaas": ""}, "governor_enqueued_vaas", "bad status 500"},
+		{"no tokens", map[string]string{"/v1/governor/token_list": `{}`}, "governor_token_list", "no governed tokens"},
+		{"invalid VAA", map[string]string{signedVAAPath: `{"vaaBytes":"AAEC"}`}, "signed_vaa", "invalid VAA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := restServer(t, &fakeAPI{guardian: g}, tt.bodies)
+			st := &probeState{guardian: &g.Addr, vaaID: testVAAID, guardianSet: []eth_common.Address{g.Addr}, guardianSetIndex: 4}
+			results := probeResults(runProbes(context.Background(), "rest", exitREST, newRESTAPI(url+"/", timeout), st))
+			for i, p := range apiProbes {
+				r := results[p.name]
+				if p.name != tt.failed {
+					if r.Status != statusPass {
+						t.Errorf("%s: %+v, want it to pass", p.name, r)
+					}
+					continue
+				}
+				if r.Status != statusFail || r.exitCode != exitREST+i || !strings.Contains(r.Detail, tt.detail) {
+					t.Errorf("%s: %+v, want it to fail with exit code %d and %q", p.name, r, exitREST+i, tt.detail)
+				}
+			}
+			if tt.failed == "" && !strings.HasSuffix(results["signed_vaa"].Detail, "verified, 1 signatures") {
+				t.Errorf("signed_vaa: %q, want the VAA verified", results["signed_vaa"].Detail)
+			}
+		})
+	}
+}
+
+func TestProbeGRPC(t *testing.T) {
+	setTimeout(t, 5*time.Second)
+	g, other := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	current := []eth_common.Address{g.Addr}
+	tests := []struct {
+		name        string
+		api         *fakeAPI
+		guardianSet []eth_common.Address
+		index       uint32
+		// failed is the probe that fails and its error.
+		failed, detail string
+	}{
+		{name: "healthy", api: &fakeAPI{guardian: g}, guardianSet: current, index: 4},
+		{name: "no guardian set loaded", api: &fakeAPI{guardian: g}},
+		{"unavailable", &fakeAPI{guardian: g, fail: "tokenList"}, current, 4, "governor_token_list", "tokenList unavailable"},
+		{"old guardian set", &fakeAPI{guardian: g}, current, 5, "guardianset", "guardian set 4, but the current one is 5"},
+		{"other guardians", &fakeAPI{guardian: g, guardianSet: &publicrpcv1.GuardianSet{Index: 4, Addresses: []string{g.Addr.Hex(), other.Addr.Hex()}}},
+			current, 4, "guardianset", "differs from the current one"},
+		{"empty guardian set", &fakeAPI{guardian: g, guardianSet: &publicrpcv1.GuardianSet{Index: 4}}, current, 4, "guardianset", "empty guardian set"},
+		// The VAA is signed by g, which is not in the current guardian set.
+		{"unverified VAA", &fakeAPI{guardian: g, guardianSet: &publicrpcv1.GuardianSet{Index: 4, Addresses: []string{other.Addr.Hex()}}},
+			[]eth_common.Address{other.Addr}, 4, "signed_vaa", "bad signatures"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, err := newGRPCAPI(startGRPCServer(t, tt.api), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer api.close()
+			st := &probeState{vaaID: testVAAID, guardianSet: tt.guardianSet, guardianSetIndex: tt.index}
+			results := probeResults(runProbes(context.Background(), "grpc", exitGRPC, api, st))
+			for i, p := range apiProbes {
+				r := results[p.name]
+				if p.name != tt.failed {
+					if r.Status != statusPass {
+						t.Errorf("%s: %+v, want it to pass", p.name, r)
+					}
+					continue
+				}
+				if r.Status != statusFail || r.exitCode != exitGRPC+i || !strings.Contains(r.Detail, tt.detail) {
+					t.Errorf("%s: %+v, want it to fail with exit code %d and %q", p.name, r, exitGRPC+i, tt.detail)
+				}
+			}
+			if tt.guardianSet == nil && !strings.HasSuffix(results["signed_vaa"].Detail, "not verified") {
+				t.Errorf("signed_vaa: %q, want it unverified without a guardian set", results["signed_vaa"].Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+)
+
+// heartbeatSample is a verified heartbeat.
+type heartbeatSample struct {
+	receivedAt time.Time
+	from       peer.ID
+	hb         *gossipv1.Heartbeat
+}
+
+// guardianActivity is what a session saw of a guardian during a window.
+type guardianActivity struct {
+	// heartbeats are in the order they were received.
+	heartbeats []heartbeatSample
+	// invalidHeartbeats claimed to be from the guardian but failed verification.
+	invalidHeartbeats  int
+	observationBatches int
+	// invalidObservationBatches claimed to be from the guardian but their first observation failed verification.
+	invalidObservationBatches int
+	firstObservationAt        time.Time
+}
+
+func (a *guardianActivity) lastHeartbeat() (heartbeatSample, bool) {
+	if len(a.heartbeats) == 0 {
+		return heartbeatSample{}, false
+	}
+	return a.heartbeats[len(a.heartbeats)-1], true
+}
+
+// vaaActivity is what a session saw on the vaa topic during a window.
+type vaaActivity struct {
+	// first is the first VAA received that guardians are expected to store, which excludes Pythnet.
+	first *vaa.VAA
+}
+
+// window is the activity seen by a session between two collections.
+type window struct {
+	since     time.Time
+	guardians map[eth_common.Address]*guardianActivity
+	vaas      vaaActivity
+}
+
+func newWindow() *window {
+	return &window{since: time.Now(), guardians: map[eth_common.Address]*guardianActivity{}}
+}
+
+// session listens to the control, attestation and vaa topics and records the activity of every guardian,
+// so any number of guardians can be checked from one gossip session.
+type session struct {
+	logger   *zap.Logger
+	listener *gossip.Listener
+
+	mu sync.Mutex
+	w  *window
+}
+
+func startSession(ctx context.Context, logger *zap.Logger, cfg gossip.ListenerConfig) (*session, error) {
+	cfg.Topics = []string{"control", "attestation", "vaa"}
+	l, err := gossip.NewListener(ctx, logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{logger: logger, listener: l, w: newWindow()}
+	go l.Run(ctx, s.handle)
+	return s, nil
+}
+
+// activity must be called with s.mu held.
+func (s *session) activity(addr eth_common.Address) *guardianActivity {
+	a, ok := s.w.guardians[addr]
+	if !ok {
+		a = &guardianActivity{}
+		s.w.guardians[addr] = a
+	}
+	return a
+}
+
+func (s *session) handle(_ context.Context, e *gossip.Envelope) {
+	if e.Msg == nil {
+		return
+	}
+	switch m := e.Msg.Message.(type) {
+	case *gossipv1.GossipMessage_SignedHeartbeat:
+		addr := eth_common.BytesToAddress(m.SignedHeartbeat.GuardianAddr)
+		hb, err := gossip.VerifyHeartbeat(m.SignedHeartbeat, nil, e.From)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			s.logger.Debug("invalid heartbeat", zap.String("addr", addr.Hex()), zap.String("from", e.From.String()), zap.Error(err))
+			s.activity(addr).invalidHeartbeats++
+			return
+		}
+		a := s.activity(addr)
+		a.heartbeats = append(a.heartbeats, heartbeatSample{receivedAt: e.ReceivedAt, from: e.From, hb: hb})
+	case *gossipv1.GossipMessage_SignedObservationBatch:
+		// The batch address is only authenticated by the signatures of the observations. Checking the first one is
+		// enough to tell the guardian's batches apart from batches claiming its address, and bounds the work per batch.
+		batch := m.SignedObservationBatch
+		addr := eth_common.BytesToAddress(batch.Addr)
+		err := errors.New("empty observation batch")
+		if len(batch.Observations) > 0 {
+			err = gossip.VerifyObservation(batch.Addr, batch.Observations[0])
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			s.logger.Debug("invalid observation batch", zap.String("addr", addr.Hex()), zap.String("from", e.From.String()), zap.Error(err))
+			s.activity(addr).invalidObservationBatches++
+			return
+		}
+		a := s.activity(addr)
+		if a.observationBatches == 0 {
+			a.firstObservationAt = e.ReceivedAt
+		}
+		a.observationBatches++
+	case *gossipv1.GossipMessage_SignedVaaWithQuorum:
+		v, err := vaa.Unmarshal(m.SignedVaaWithQuorum.Vaa)
+		if err != nil {
+			s.logger.Debug("invalid VAA", zap.String("from", e.From.String()), zap.Error(err))
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.w.vaas.first == nil && v.EmitterChain != vaa.ChainIDPythNet {
+			s.w.vaas.first = v
+		}
+	}
+}
+
+// collect returns the activity seen since the previous collection, or the start of the session, and starts a new window.
+func (s *session) collect() *window {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.w
+	s.w = newWindow()
+	return w
+}
+
+func (s *session) peerInfo(id peer.ID) peer.AddrInfo {
+	return s.listener.Host().Peerstore().PeerInfo(id)
+}
+
+func (s *session) close() {
+	s.listener.Close()
+}
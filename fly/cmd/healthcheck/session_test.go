@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"go.uber.org/zap"
+)
+
+// TestObservationBatchesAreVerified checks that batches only count for the guardian whose address they claim
+// when their observations are signed by it.
+func TestObservationBatchesAreVerified(t *testing.T) {
+	g, impostor := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	s := &session{logger: zap.NewNop(), w: newWindow()}
+	at := time.Now()
+	hash := make([]byte, 32)
+	forged := g.ObservationBatch(impostor.Observation(t, "1/0000000000000000000000000000000000000000000000000000000000000001/1", hash))
+	for _, msg := range []*gossipv1.GossipMessage{
+		forged,
+		g.ObservationBatch(),
+		g.ObservationBatch(g.Observation(t, "1/0000000000000000000000000000000000000000000000000000000000000001/1", hash)),
+	} {
+		s.handle(context.Background(), gossiptest.Envelope(t, impostor.Peer, "attestation", at, msg))
+		at = at.Add(time.Second)
+	}
+
+	w := s.collect()
+	a := w.guardians[g.Addr]
+	if a == nil {
+		t.Fatal("no activity recorded for the guardian")
+	}
+	if a.observationBatches != 1 || a.invalidObservationBatches != 2 {
+		t.Errorf("observation batches = %d, invalid = %d, want 1 and 2", a.observationBatches, a.invalidObservationBatches)
+	}
+	if want := at.Add(-time.Second); !a.firstObservationAt.Equal(want) {
+		t.Errorf("first observation at %s, want the valid batch at %s", a.firstObservationAt, want)
+	}
+	if _, ok := w.guardians[impostor.Addr]; ok {
+		t.Error("the impostor was credited with a batch")
+	}
+
+	// Forged batches alone don't make the guardian look healthy.
+	s.handle(context.Background(), gossiptest.Envelope(t, impostor.Peer, "attestation", at, forged))
+	results, _ := guardianChecks(s, s.collect(), g.Addr, nil)
+	for _, r := range results {
+		if r.Name == "observations" && r.Status != statusFail {
+			t.Errorf("observations check passed on forged batches: %+v", r)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/ttlset"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+)
+
+type gossipMsgType int16
+
+const (
+	GSM_signedObservationInBatch gossipMsgType = iota
+	GSM_signedObservationBatch
+	GSM_tbObservation
+	GSM_signedHeartbeat
+	GSM_signedVaaWithQuorum
+	GSM_signedObservationRequest
+	GSM_signedChainGovernorConfig
+	GSM_signedChainGovernorStatus
+	GSM_maxTypeVal
+)
+
+var gossipMsgTypeNames = [GSM_maxTypeVal]string{
+	GSM_signedObservationInBatch:  "observation",
+	GSM_signedObservationBatch:    "observation_batch",
+	GSM_tbObservation:             "token_bridge_observation",
+	GSM_signedHeartbeat:           "heartbeat",
+	GSM_signedVaaWithQuorum:       "vaa",
+	GSM_signedObservationRequest:  "observation_request",
+	GSM_signedChainGovernorConfig: "gov_config",
+	GSM_signedChainGovernorStatus: "gov_status",
+}
+
+var (
+	gossipMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "heartbeats_gossip_messages_total",
+		Help: "The number of gossip messages received, by type",
+	}, []string{"type"})
+	chainHealthyGuardians = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "heartbeats_chain_healthy_guardians",
+		Help: "The number of guardians whose latest height for the chain is within 1000 blocks of the highest",
+	}, []string{"chain_name"})
+)
+
+// inputs are the channels the aggregator consumes. In normal operation p2p.Run writes to them,
+// but any other producer (such as a fake message source) can be plugged in instead.
+type inputs struct {
+	batchObsvC <-chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]
+	obsvReqC   <-chan *gossipv1.ObservationRequest
+	signedInC  <-chan *gossipv1.SignedVAAWithQuorum
+	heartbeatC <-chan *gossipv1.Heartbeat
+	govConfigC <-chan *gossipv1.SignedChainGovernorConfig
+	govStatusC <-chan *gossipv1.SignedChainGovernorStatus
+}
+
+type heartbeat struct {
+	bootTimestamp time.Time
+	counter       string
+	features      []string
+	guardianAddr  string
+	networks      []*gossipv1.Heartbeat_Network
+	nodeName      string
+	timestamp     time.Time
+	version       string
+}
+
+type guardianRow struct {
+	index int
+	addr  eth_common.Address
+	seen  bool
+	hb    heartbeat
+}
+
+type chainRow struct {
+	id      uint32
+	status  string
+	healthy int
+	highest int64
+}
+
+type obsvRateRow struct {
+	guardianIndex uint
+	guardianName  string
+	// obsvCount and share are for the last complete bucket.
+	obsvCount uint
+	share     float64
+	spark     string
+}
+
+type obsvChainRow struct {
+	chain  vaa.ChainID
+	total  uint
+	median float64
+	spark  string
+	under  []underObserver
+}
+
+type underObserver struct {
+	guardianIndex int
+	guardianName  string
+	count         uint
+	pctOfMedian   float64
+}
+
+// snapshot is a point-in-time copy of the aggregated state. It is safe to read from any goroutine.
+type snapshot struct {
+	// version is bumped every time the aggregator state changes, so the renderer can skip identical frames.
+	version       uint64
+	guardians     []guardianRow
+	chains        []chainRow
+	gossipCounter [][]int
+	obsvRate      []obsvRateRow
+	obsvChains    []obsvChainRow
+}
+
+// aggregator is the single owner of all the state displayed by the TUI.
+// Only the goroutine executing run touches its fields; everybody else asks for a snapshot.
+type aggregator struct {
+	logger      *zap.Logger
+	keys        []eth_common.Address
+	loadTesting bool
+	now         func() time.Time
+
+	version       uint64
+	hbByGuardian  map[string]heartbeat
+	chains        []chainRow
+	gossipCounter [][]int
+	// uniqueObs and uniqueVAAs are only used when load testing.
+	uniqueObs  *ttlset.Set
+	uniqueVAAs *ttlset.Set
+
+	obsv *obsvHistory
+	// The number of most recent buckets, and the fraction of the median, used to flag under-observing guardians.
+	underObsvWindow int
+	underObsvRatio  float64
+
+	snapReqC chan chan *snapshot
+}
+
+func newAggregator(logger *zap.Logger, keys []eth_common.Address, loadTesting bool, dedupTTL time.Duration, dedupMaxSize int, underObsvWindow time.Duration, underObsvRatio float64) *aggregator {
+	// The extra row is for the totals
+	numRows := numGuardians + 1
+	if loadTesting {
+		// The extra row is for the count of unique keys.
+		numRows += 1
+	}
+	gossipCounter := make([][]int, numRows)
+	for idx := range gossipCounter {
+		gossipCounter[idx] = make([]int, GSM_maxTypeVal)
+	}
+
+	a := &aggregator{
+		logger:          logger,
+		keys:            keys,
+		loadTesting:     loadTesting,
+		now:             time.Now,
+		hbByGuardian:    make(map[string]heartbeat, len(keys)),
+		gossipCounter:   gossipCounter,
+		obsv:            newObsvHistory(numGuardians, time.Now()),
+		underObsvWindow: int(underObsvWindow / obsvBucketWidth),
+		underObsvRatio:  underObsvRatio,
+		snapReqC:        make(chan chan *snapshot),
+	}
+	if loadTesting {
+		a.uniqueObs = ttlset.New("unique_observations", dedupTTL, dedupMaxSize)
+		a.uniqueVAAs = ttlset.New("unique_vaas", dedupTTL, dedupMaxSize)
+	}
+	return a
+}
+
+// run consumes the inputs until the context is cancelled.
+func (a *aggregator) run(ctx context.Context, in inputs) {
+	if a.loadTesting {
+		go a.uniqueObs.Run(ctx, time.Minute)
+		go a.uniqueVAAs.Run(ctx, time.Minute)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case replyC := <-a.snapReqC:
+			// Taking a snapshot does not change the state, only the messages below do.
+			replyC <- a.buildSnapshot()
+			continue
+		case batch := <-in.batchObsvC:
+			a.handleObservationBatch(batch.Msg)
+		case <-in.obsvReqC:
+			// There is no guardian address in the observation request
+			a.countTotal(GSM_signedObservationRequest)
+		case m := <-in.signedInC:
+			a.handleSignedVAA(m)
+		case hb := <-in.heartbeatC:
+			a.handleHeartbeat(hb)
+		case g := <-in.govConfigC:
+			a.count(g.GuardianAddr, GSM_signedChainGovernorConfig)
+		case g := <-in.govStatusC:
+			a.count(g.GuardianAddr, GSM_signedChainGovernorStatus)
+		}
+		a.version++
+	}
+}
+
+// snapshot returns a copy of the current state, or nil if the context is cancelled first.
+func (a *aggregator) snapshot(ctx context.Context) *snapshot {
+	replyC := make(chan *snapshot, 1)
+	select {
+	case <-ctx.Done():
+		return nil
+	case a.snapReqC <- replyC:
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case s := <-replyC:
+		return s
+	}
+}
+
+func (a *aggregator) buildSnapshot() *snapshot {
+	// The history ages even when no observations arrive.
+	if a.obsv.advance(a.now()) {
+		a.version++
+	}
+	s := &snapshot{
+		version:       a.version,
+		guardians:     make([]guardianRow, len(a.keys)),
+		chains:        make([]chainRow, len(a.chains)),
+		gossipCounter: make([][]int, len(a.gossipCounter)),
+		obsvRate:      a.obsv.guardianRows(),
+		obsvChains:    a.obsv.chainRows(a.underObsvWindow, a.underObsvRatio),
+	}
+	for idx, g := range a.keys {
+		info, ok := a.hbByGuardian[g.String()]
+		s.guardians[idx] = guardianRow{index: idx, addr: g, seen: ok, hb: info}
+	}
+	copy(s.chains, a.chains)
+	for idx, r := range a.gossipCounter {
+		s.gossipCounter[idx] = append([]int(nil), r...)
+	}
+	return s
+}
+
+// countTotal bumps the totals row, and the exported counter, of the given message type.
+func (a *aggregator) countTotal(msgType gossipMsgType) {
+	a.gossipCounter[totalsRow][msgType]++
+	gossipMessages.WithLabelValues(gossipMsgTypeNames[msgType]).Inc()
+}
+
+// count bumps the counter of the given message type for the sending guardian and the totals row.
+func (a *aggregator) count(guardianAddr []byte, msgType gossipMsgType) int {
+	addr := "0x" + hex.EncodeToString(guardianAddr)
+	idx, found := guardianIndexMap[strings.ToLower(addr)]
+	if found {
+		a.gossipCounter[idx][msgType]++
+	} else {
+		idx = -1
+	}
+	a.countTotal(msgType)
+	return idx
+}
+
+func (a *aggregator) handleObservationBatch(batch *gossipv1.SignedObservationBatch) {
+	idx := a.count(batch.Addr, GSM_signedObservationBatch)
+	for _, o := range batch.Observations {
+		spl := strings.Split(o.MessageId, "/")
+		if len(spl) > 1 && knownEmitters[strings.ToLower(spl[1])] {
+			if idx >= 0 {
+				a.gossipCounter[idx][GSM_tbObservation]++
+			}
+			a.countTotal(GSM_tbObservation)
+		}
+		chain := vaa.ChainIDUnset
+		if c, err := strconv.ParseUint(spl[0], 10, 16); err == nil {
+			chain = vaa.ChainID(c)
+		}
+		a.obsv.add(a.now(), idx, chain)
+		if idx >= 0 {
+			a.gossipCounter[idx][GSM_signedObservationInBatch]++
+		}
+		a.countTotal(GSM_signedObservationInBatch)
+
+		if a.loadTesting {
+			if a.uniqueObs.Add(hex.EncodeToString(o.Hash)) {
+				a.gossipCounter[uniqueRow][GSM_signedObservationInBatch]++
+			}
+		}
+	}
+}
+
+func (a *aggregator) handleSignedVAA(m *gossipv1.SignedVAAWithQuorum) {
+	// This only has VAABytes. It doesn't have the guardian address
+	a.countTotal(GSM_signedVaaWithQuorum)
+
+	if a.loadTesting {
+		v, err := vaa.Unmarshal(m.Vaa)
+		if err != nil {
+			a.logger.Warn("received invalid VAA in SignedVAAWithQuorum message", zap.Error(err), zap.Any("message", m))
+			return
+		}
+		if a.uniqueVAAs.Add(v.HexDigest()) {
+			a.gossipCounter[uniqueRow][GSM_signedVaaWithQuorum]++
+		}
+	}
+}
+
+func (a *aggregator) handleHeartbeat(hb *gossipv1.Heartbeat) {
+	a.hbByGuardian[hb.GuardianAddr] = heartbeat{
+		bootTimestamp: time.Unix(hb.BootTimestamp/1000000000, 0),
+		counter:       strconv.FormatInt(hb.Counter, 10),
+		features:      hb.Features,
+		guardianAddr:  hb.GuardianAddr,
+		networks:      hb.Networks,
+		nodeName:      hb.NodeName,
+		timestamp:     time.Unix(hb.Timestamp/1000000000, 0),
+		version:       hb.Version,
+	}
+	if idx, found := guardianIndexMap[strings.ToLower(hb.GuardianAddr)]; found {
+		a.gossipCounter[idx][GSM_signedHeartbeat]++
+	}
+	a.countTotal(GSM_signedHeartbeat)
+	a.updateChains()
+}
+
+// updateChains recomputes the per chain health from the latest heartbeat of every guardian.
+func (a *aggregator) updateChains() {
+	chainIdsToHeartbeats := make(map[uint32][]*gossipv1.Heartbeat_Network)
+	for _, g := range a.keys {
+		info, ok := a.hbByGuardian[g.String()]
+		if !ok {
+			continue
+		}
+		for _, network := range info.networks {
+			chainIdsToHeartbeats[network.Id] = append(chainIdsToHeartbeats[network.Id], network)
+		}
+	}
+
+	a.chains = a.chains[:0]
+	for chainId, heartbeats := range chainIdsToHeartbeats {
+		highest := int64(0)
+		for _, heartbeat := range heartbeats {
+			if heartbeat.Height > highest {
+				highest = heartbeat.Height
+			}
+		}
+		healthyCount := 0
+		for _, heartbeat := range heartbeats {
+			if heartbeat.Height != 0 && highest-heartbeat.Height <= 1000 {
+				healthyCount++
+			}
+		}
+		status := "green"
+		if healthyCount < vaa.CalculateQuorum(len(a.keys)) {
+			status = "red"
+		} else if healthyCount < len(a.keys)-1 {
+			status = "yellow"
+		}
+		a.chains = append(a.chains, chainRow{id: chainId, status: status, healthy: healthyCount, highest: highest})
+		chainHealthyGuardians.WithLabelValues(vaa.ChainID(chainId).String()).Set(float64(healthyCount))
+	}
+	sort.Slice(a.chains, func(i, j int) bool { return a.chains[i].id < a.chains[j].id })
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// fakeSource feeds the aggregator in place of p2p.Run.
+type fakeSource struct {
+	batchObsvC chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]
+	obsvReqC   chan *gossipv1.ObservationRequest
+	signedInC  chan *gossipv1.SignedVAAWithQuorum
+	heartbeatC chan *gossipv1.Heartbeat
+	govConfigC chan *gossipv1.SignedChainGovernorConfig
+	govStatusC chan *gossipv1.SignedChainGovernorStatus
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		batchObsvC: make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]),
+		obsvReqC:   make(chan *gossipv1.ObservationRequest),
+		signedInC:  make(chan *gossipv1.SignedVAAWithQuorum),
+		heartbeatC: make(chan *gossipv1.Heartbeat),
+		govConfigC: make(chan *gossipv1.SignedChainGovernorConfig),
+		govStatusC: make(chan *gossipv1.SignedChainGovernorStatus),
+	}
+}
+
+func (f *fakeSource) inputs() inputs {
+	return inputs{
+		batchObsvC: f.batchObsvC,
+		obsvReqC:   f.obsvReqC,
+		signedInC:  f.signedInC,
+		heartbeatC: f.heartbeatC,
+		govConfigC: f.govConfigC,
+		govStatusC: f.govStatusC,
+	}
+}
+
+var testKeys = []eth_common.Address{
+	eth_common.HexToAddress("0x58CC3AE5C097b213cE3c81979e1B9f9570746AA5"),
+	eth_common.HexToAddress("0xfF6CB952589BDE862c25Ef4392132fb9D4A42157"),
+}
+
+// testAggregator starts an aggregator for testKeys with a frozen clock, so snapshots never rotate the history.
+func testAggregator(t *testing.T) (*aggregator, *fakeSource, context.Context) {
+	t.Helper()
+	src := newFakeSource()
+	a, ctx := startAggregator(t, testKeys, src.inputs())
+	return a, src, ctx
+}
+
+// startAggregator sets up the guardian globals the way main does, and runs an aggregator over in until the test ends.
+func startAggregator(t *testing.T, keys []eth_common.Address, in inputs) (*aggregator, context.Context) {
+	t.Helper()
+	prevNum, prevTotals, prevIndex, prevNames := numGuardians, totalsRow, guardianIndexMap, guardianIndexToNameMap
+	t.Cleanup(func() {
+		numGuardians, totalsRow, guardianIndexMap, guardianIndexToNameMap = prevNum, prevTotals, prevIndex, prevNames
+	})
+	numGuardians, totalsRow = len(keys), uint(len(keys))
+	guardianIndexMap, guardianIndexToNameMap = map[string]int{}, map[int]string{}
+	for i, k := range keys {
+		guardianIndexMap[strings.ToLower(k.Hex())] = i
+		guardianIndexToNameMap[i] = fmt.Sprintf("guardian-%d", i)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	a := newAggregator(zap.NewNop(), keys, false, time.Minute, 100, 5*time.Minute, 0.5)
+	a.now = func() time.Time { return now }
+	a.obsv = newObsvHistory(numGuardians, now)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go a.run(ctx, in)
+	return a, ctx
+}
+
+func TestAggregatorCountsAndVersions(t *testing.T) {
+	a, src, ctx := testAggregator(t)
+
+	for i := 0; i < 3; i++ {
+		src.heartbeatC <- &gossipv1.Heartbeat{GuardianAddr: testKeys[0].Hex(), NodeName: "g0", Counter: int64(i + 1)}
+	}
+	src.batchObsvC <- &node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]{
+		Msg: &gossipv1.SignedObservationBatch{
+			Addr: testKeys[1].Bytes(),
+			Observations: []*gossipv1.Observation{
+				{MessageId: "2/0000000000000000000000000000000000000000000000000000000000000001/1"},
+				{MessageId: "2/0000000000000000000000000000000000000000000000000000000000000001/2"},
+			},
+		},
+		Timestamp: a.now(),
+	}
+	src.obsvReqC <- &gossipv1.ObservationRequest{}
+	src.govStatusC <- &gossipv1.SignedChainGovernorStatus{GuardianAddr: testKeys[1].Bytes()}
+
+	// Concurrent snapshots must neither race with the aggregator nor change the version.
+	const readers = 8
+	versions := make([]uint64, readers)
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				versions[i] = a.snapshot(ctx).version
+			}
+		}()
+	}
+	wg.Wait()
+	for i, v := range versions {
+		if v != 6 {
+			t.Errorf("reader %d: version = %d, want 6, one per message", i, v)
+		}
+	}
+
+	s := a.snapshot(ctx)
+	if got := s.gossipCounter[0][GSM_signedHeartbeat]; got != 3 {
+		t.Errorf("heartbeats of guardian 0 = %d, want 3", got)
+	}
+	if got := s.gossipCounter[1][GSM_signedObservationBatch]; got != 1 {
+		t.Errorf("observation batches of guardian 1 = %d, want 1", got)
+	}
+	if got := s.gossipCounter[1][GSM_signedObservationInBatch]; got != 2 {
+		t.Errorf("observations of guardian 1 = %d, want 2", got)
+	}
+	if got := s.gossipCounter[1][GSM_signedChainGovernorStatus]; got != 1 {
+		t.Errorf("governor statuses of guardian 1 = %d, want 1", got)
+	}
+	if got := s.gossipCounter[totalsRow][GSM_signedObservationRequest]; got != 1 {
+		t.Errorf("total observation requests = %d, want 1", got)
+	}
+	if !s.guardians[0].seen || s.guardians[0].hb.counter != "3" {
+		t.Errorf("guardian 0 = %+v, want seen with the last heartbeat", s.guardians[0])
+	}
+	if s.guardians[1].seen {
+		t.Errorf("guardian 1 has no heartbeat but is seen")
+	}
+}
+
+func TestAggregatorSnapshotIsACopy(t *testing.T) {
+	a, src, ctx := testAggregator(t)
+	src.heartbeatC <- &gossipv1.Heartbeat{GuardianAddr: testKeys[0].Hex(), Counter: 1}
+	before := a.snapshot(ctx)
+	src.heartbeatC <- &gossipv1.Heartbeat{GuardianAddr: testKeys[0].Hex(), Counter: 2}
+	after := a.snapshot(ctx)
+
+	if before.gossipCounter[0][GSM_signedHeartbeat] != 1 || after.gossipCounter[0][GSM_signedHeartbeat] != 2 {
+		t.Errorf("heartbeat counts = %d then %d, want 1 then 2",
+			before.gossipCounter[0][GSM_signedHeartbeat], after.gossipCounter[0][GSM_signedHeartbeat])
+	}
+	if after.version != before.version+1 {
+		t.Errorf("versions = %d then %d, want one bump", before.version, after.version)
+	}
+}
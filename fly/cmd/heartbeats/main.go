@@ -2,30 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	tm "github.com/buger/goterm"
 	node_common "github.com/certusone/wormhole/node/pkg/common"
 	"github.com/certusone/wormhole/node/pkg/p2p"
 	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
 	"github.com/certusone/wormhole/node/pkg/supervisor"
 	"github.com/eiannone/keyboard"
 	ipfslog "github.com/ipfs/go-log/v2"
-	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/wormhole-foundation/wormhole-monitor/fly/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
 	"github.com/wormhole-foundation/wormhole-monitor/fly/utils"
 	"github.com/wormhole-foundation/wormhole/sdk"
-	"github.com/wormhole-foundation/wormhole/sdk/vaa"
 
 	"go.uber.org/zap"
 )
@@ -40,6 +38,14 @@ var (
 	ethRPC       = flag.String("ethRPC", "", "Ethereum RPC for fetching current guardian set (default is based on env)")
 	ethContract  = flag.String("ethContract", "", "Ethereum core bridge address for fetching current guardian set (default is based on env)")
 	loadTesting  = flag.Bool("loadTesting", false, "Should extra load testing analysis be performed)")
+	dedupTTL     = flag.Duration("dedupTTL", time.Hour, "When load testing, how long observation hashes and VAA digests are remembered to count unique messages")
+	dedupMaxSize = flag.Int("dedupMaxSize", 1_000_000, "When load testing, maximum number of observation hashes, and of VAA digests, remembered (0 for no limit)")
+	refresh      = flag.Duration("refresh", 250*time.Millisecond, "How often the display is redrawn")
+	underWindow  = flag.Duration("underObsvWindow", 10*time.Minute, "Time window used to compare each guardian's per chain observations to the median")
+	underRatio   = flag.Float64("underObsvRatio", 0.5, "Guardians observing less than this fraction of the median on a chain are flagged")
+	replayFiles  = flag.String("replay", "", "Comma separated recordings (or glob patterns) to replay instead of connecting to the gossip network")
+	replaySpeed  = flag.Float64("replaySpeed", 1, "Replay speed multiplier (0 replays as fast as possible)")
+	httpAddr     = flag.String("http", "", "Serve the web UI on this address (e.g. :8080) instead of drawing in the terminal")
 )
 
 var (
@@ -61,33 +67,11 @@ var (
 
 	// The known token bridge emitters
 	knownEmitters = map[string]bool{}
-
-	lastTime = time.Now()
 )
 
-type heartbeat struct {
-	bootTimestamp time.Time
-	counter       string
-	features      []string
-	guardianAddr  string
-	networks      []*gossipv1.Heartbeat_Network
-	nodeName      string
-	timestamp     time.Time
-	version       string
-}
-
-type obsvRateRow struct {
-	guardianIndex uint
-	guardianName  string
-	obsvCount     uint
-	percents      [10]string
-}
-
-var currentObsvData map[uint]uint
-var currentObsvTable map[uint]uint
-var obsvRateRows []obsvRateRow
-
 func main() {
+	var metricsConfig metrics.Config
+	metricsConfig.RegisterFlags(flag.CommandLine, "")
 	flag.Parse()
 
 	// Set up the logger.
@@ -144,7 +128,6 @@ func main() {
 
 	numGuardians = len(guardianIndexToNameMap)
 	totalsRow = uint(numGuardians)
-	obsvRateRows = make([]obsvRateRow, numGuardians)
 
 	if *loadTesting {
 		uniqueRow = uint(numGuardians + 1)
@@ -172,28 +155,12 @@ func main() {
 		coreBridgeAddr = *ethContract
 	}
 
-	initObsvTableData(true)
-
 	// ctx := context.Background()
 
 	// Node's main lifecycle context.
-	rootCtx, rootCtxCancel = context.WithCancel(context.Background())
+	rootCtx, rootCtxCancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer rootCtxCancel()
 
-	type GossipMsgType int16
-
-	const (
-		GSM_signedObservationInBatch GossipMsgType = iota
-		GSM_signedObservationBatch
-		GSM_tbObservation
-		GSM_signedHeartbeat
-		GSM_signedVaaWithQuorum
-		GSM_signedObservationRequest
-		GSM_signedChainGovernorConfig
-		GSM_signedChainGovernorStatus
-		GSM_maxTypeVal
-	)
-
 	// Inbound observations
 	batchObsvC := make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch], 20000)
 
@@ -215,7 +182,8 @@ func main() {
 	// Governor status
 	govStatusC := make(chan *gossipv1.SignedChainGovernorStatus, 20000)
 	// Bootstrap guardian set, otherwise heartbeats would be skipped
-	idx, sgs, err := utils.FetchCurrentGuardianSet(rpcUrl, coreBridgeAddr)
+	// Replays have to work offline, so they use the known guardians for the environment instead of querying the chain.
+	idx, sgs, err := utils.GuardianSet(env, *replayFiles != "", rpcUrl, coreBridgeAddr)
 	if err != nil {
 		logger.Fatal("Failed to fetch guardian set", zap.Error(err))
 	}
@@ -226,448 +194,141 @@ func main() {
 	}
 	gst.Set(&gs)
 
-	hbByGuardian := make(map[string]heartbeat, len(gs.Keys))
-
-	// Keep a counter of all gossip message types by guardian.
-	// Creating a 2 dimensional array:
-	// First dimension = guardian id
-	// Second dimension = gossip message type
-	// Value = count
 	if len(gs.Keys) != numGuardians {
 		logger.Error("Invalid number of guardians.", zap.Int("found", len(gs.Keys)), zap.Int("expected", numGuardians))
 		return
 	}
 
-	var gossipLock sync.Mutex
-	// The extra row is for the totals
-	numRows := numGuardians + 1
-	if *loadTesting {
-		// The extra row is for the count of unique keys.
-		numRows += 1
-	}
-	gossipCounter := make([][]int, numRows)
-	for idx := range gossipCounter {
-		gossipCounter[idx] = make([]int, GSM_maxTypeVal)
+	if err := metrics.Start(rootCtx, logger, metricsConfig, "heartbeats", nil); err != nil {
+		logger.Fatal("Failed to start metrics", zap.Error(err))
 	}
 
-	activeTable := 1 // 0 = chains, 1 = guardians, 2 = message counts, 3 = obsv rate
-
-	resetTerm(true)
-
-	chainTable := table.NewWriter()
-	chainTable.SetOutputMirror(os.Stdout)
-	chainTable.AppendHeader(table.Row{"ID", "Chain", "Status", "Healthy", "Highest"})
-	chainTable.SetStyle(table.StyleColoredDark)
-	chainTable.SortBy([]table.SortBy{
-		{Name: "ID", Mode: table.AscNumeric},
+	// All the displayed state is owned by the aggregator. The renderer (or the web UI) periodically takes a snapshot and redraws it.
+	agg := newAggregator(logger, gs.Keys, *loadTesting, *dedupTTL, *dedupMaxSize, *underWindow, *underRatio)
+	go agg.run(rootCtx, inputs{
+		batchObsvC: batchObsvC,
+		obsvReqC:   obsvReqC,
+		signedInC:  signedInC,
+		heartbeatC: heartbeatC,
+		govConfigC: govConfigC,
+		govStatusC: govStatusC,
 	})
-
-	gossipMsgTable := table.NewWriter()
-	gossipMsgTable.SetOutputMirror(os.Stdout)
-	gossipMsgTable.AppendHeader(table.Row{"#", "Guardian", "ObsvInB", "ObsvB", "TB_OBsv", "HB", "VAA", "Obsv_Req", "Chain_Gov_Cfg", "Chain_Gov_Status"})
-	gossipMsgTable.SetStyle(table.StyleColoredDark)
-
-	obsvRateTable := table.NewWriter()
-	obsvRateTable.SetOutputMirror(os.Stdout)
-	obsvRateTable.AppendHeader(table.Row{"#", "Guardian", "1%", "2%", "3%", "4%", "5%", "6%", "7%", "8%", "9%", "10%"})
-	obsvRateTable.SetStyle(table.StyleColoredDark)
-
-	guardianTable := table.NewWriter()
-	guardianTable.SetOutputMirror(os.Stdout)
-	guardianTable.AppendHeader(table.Row{"#", "Guardian", "Version", "Features", "Counter", "Boot", "Timestamp", "Address"})
-	for idx, g := range gs.Keys {
-		guardianTable.AppendRow(table.Row{idx, "", "", "", "", "", "", g})
-	}
-	guardianTable.SetStyle(table.StyleColoredDark)
-	guardianTable.Render()
-	prompt()
-
-	// Keyboard handler
-	if err := keyboard.Open(); err != nil {
-		panic(err)
-	}
-	defer func() {
-		keyboard.Close()
-		resetTerm(true)
-	}()
-	go func() {
-		for {
-			char, key, err := keyboard.GetKey()
-			if err != nil {
-				logger.Fatal("error getting key", zap.Error(err))
+	if *httpAddr != "" {
+		// The web UI can be shared by any number of viewers, so it runs headless.
+		web := newWebServer(logger, agg, *refresh)
+		go func() {
+			if err := web.run(rootCtx, *httpAddr); err != nil {
+				logger.Error("Web UI failed", zap.Error(err))
+				rootCtxCancel()
 			}
-			wantsOut := false
-			if key == keyboard.KeyCtrlC {
-				wantsOut = true
-			} else {
-				switch string(char) {
-				case "q":
-					wantsOut = true
-				case "c":
-					activeTable = 0
-					resetTerm(true)
-					chainTable.Render()
-					prompt()
-				case "g":
-					activeTable = 1
-					resetTerm(true)
-					guardianTable.Render()
-					prompt()
-				case "m":
-					gossipLock.Lock()
-					activeTable = 2
-					resetTerm(true)
-					gossipMsgTable.Render()
-					gossipLock.Unlock()
-					prompt()
-				case "o":
-					activeTable = 3
-					resetTerm(true)
-					obsvRateTable.Render()
-					prompt()
-				}
-			}
-			if wantsOut {
-				break
-			}
-		}
-		rootCtxCancel()
-	}()
-
-	// Just count observations
-	go func() {
-		uniqueObsInBatch := map[string]struct{}{}
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case batch := <-batchObsvC:
-				addr := "0x" + string(hex.EncodeToString(batch.Msg.Addr))
-				idx := guardianIndexMap[strings.ToLower(addr)]
-				gossipCounter[idx][GSM_signedObservationBatch]++
-				gossipCounter[totalsRow][GSM_signedObservationBatch]++
-				for _, o := range batch.Msg.Observations {
-					spl := strings.Split(o.MessageId, "/")
-					emitter := strings.ToLower(spl[1])
-					if knownEmitters[emitter] {
-						gossipCounter[idx][GSM_tbObservation]++
-						gossipCounter[totalsRow][GSM_tbObservation]++
-					}
-					if handleObsv(uint(idx)) {
-						obsvRateTable.ResetRows()
-						for i := 0; i < numGuardians; i++ {
-							obsvRateTable.AppendRow(table.Row{i, obsvRateRows[int(i)].guardianName, obsvRateRows[int(i)].obsvCount,
-								obsvRateRows[uint(i)].percents[0], obsvRateRows[uint(i)].percents[1], obsvRateRows[uint(i)].percents[2],
-								obsvRateRows[uint(i)].percents[3], obsvRateRows[uint(i)].percents[4], obsvRateRows[uint(i)].percents[5],
-								obsvRateRows[uint(i)].percents[6], obsvRateRows[uint(i)].percents[7], obsvRateRows[uint(i)].percents[8],
-								obsvRateRows[uint(i)].percents[9]})
-						}
-					}
-					gossipCounter[idx][GSM_signedObservationInBatch]++
-					gossipCounter[totalsRow][GSM_signedObservationInBatch]++
-
-					if *loadTesting {
-						uniqueObsInBatch[hex.EncodeToString(o.Hash)] = struct{}{}
-						gossipCounter[uniqueRow][GSM_signedObservationInBatch] = len(uniqueObsInBatch)
-					}
-
-					gossipLock.Lock()
-					gossipMsgTable.ResetRows()
-					for idx, r := range gossipCounter {
-						gossipMsgTable.AppendRow(table.Row{idx, guardianIndexToNameMap[idx], r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]})
-					}
-					gossipLock.Unlock()
-				}
-			}
-		}
-	}()
-
-	// Count observation requests
-	// Note: without this, the whole program hangs on observation requests
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case <-obsvReqC:
-				// There is no guardian address in the observation request
-				// gossipCounter[idx][GSM_signedObservationRequest]++
-				gossipCounter[totalsRow][GSM_signedObservationRequest]++
-				gossipLock.Lock()
-				gossipMsgTable.ResetRows()
-				for idx, r := range gossipCounter {
-					gossipMsgTable.AppendRow(table.Row{idx, guardianIndexToNameMap[idx], r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]})
-				}
-				gossipLock.Unlock()
-			}
-		}
-	}()
-
-	// Just count signed VAAs
-	go func() {
-		uniqueVAAs := map[string]struct{}{}
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case m := <-signedInC:
-				// This only has VAABytes. It doesn't have the guardian address
-				gossipCounter[totalsRow][GSM_signedVaaWithQuorum]++
-
-				if *loadTesting {
-					v, err := vaa.Unmarshal(m.Vaa)
-					if err != nil {
-						logger.Warn("received invalid VAA in SignedVAAWithQuorum message", zap.Error(err), zap.Any("message", m))
-						os.Exit(0)
-					} else {
-						uniqueVAAs[v.HexDigest()] = struct{}{}
-						gossipCounter[uniqueRow][GSM_signedVaaWithQuorum] = len(uniqueVAAs)
-					}
-				}
+		}()
+	} else {
+		rndr := newRenderer(agg, *refresh)
 
-				gossipLock.Lock()
-				gossipMsgTable.ResetRows()
-				for idx, r := range gossipCounter {
-					gossipMsgTable.AppendRow(table.Row{idx, guardianIndexToNameMap[idx], r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]})
-				}
-				gossipLock.Unlock()
-			}
+		// Keyboard handler
+		if err := keyboard.Open(); err != nil {
+			panic(err)
 		}
-	}()
-
-	// Handle heartbeats
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case hb := <-heartbeatC:
-				id := hb.GuardianAddr
-				hbByGuardian[id] = heartbeat{
-					bootTimestamp: time.Unix(hb.BootTimestamp/1000000000, 0),
-					counter:       strconv.FormatInt(hb.Counter, 10),
-					features:      hb.Features,
-					guardianAddr:  hb.GuardianAddr,
-					networks:      hb.Networks,
-					nodeName:      hb.NodeName,
-					timestamp:     time.Unix(hb.Timestamp/1000000000, 0),
-					version:       hb.Version,
-				}
-				chainTable.ResetRows()
-				guardianTable.ResetRows()
-				idx := guardianIndexMap[strings.ToLower(hb.GuardianAddr)]
-				gossipCounter[idx][GSM_signedHeartbeat]++
-				gossipCounter[totalsRow][GSM_signedHeartbeat]++
-				chainIdsToHeartbeats := make(map[uint32][]*gossipv1.Heartbeat_Network)
-				for idx, g := range gs.Keys {
-					info, ok := hbByGuardian[g.String()]
-					if ok {
-						guardianTable.AppendRow(table.Row{idx, info.nodeName, info.version, strings.Join(info.features, ", "), info.counter, info.bootTimestamp, info.timestamp, g})
-						for _, network := range info.networks {
-							if _, ok := chainIdsToHeartbeats[network.Id]; !ok {
-								chainIdsToHeartbeats[network.Id] = make([]*gossipv1.Heartbeat_Network, len(gs.Keys))
-							}
-							chainIdsToHeartbeats[network.Id] = append(chainIdsToHeartbeats[network.Id], network)
-						}
-					} else {
-						guardianTable.AppendRow(table.Row{idx, "", "", "", "", "", "", g})
-					}
-				}
-				for chainId, heartbeats := range chainIdsToHeartbeats {
-					highest := int64(0)
-					for _, heartbeat := range heartbeats {
-						if heartbeat != nil && heartbeat.Height > highest {
-							highest = heartbeat.Height
-						}
-					}
-					healthyCount := 0
-					for _, heartbeat := range heartbeats {
-						if heartbeat != nil && heartbeat.Height != 0 && highest-heartbeat.Height <= 1000 {
-							healthyCount++
-						}
-					}
-					status := "green"
-					if healthyCount < vaa.CalculateQuorum(len(gs.Keys)) {
-						status = "red"
-					} else if healthyCount < len(gs.Keys)-1 {
-						status = "yellow"
-					}
-					chainTable.AppendRow(table.Row{chainId, vaa.ChainID(chainId), status, healthyCount, highest})
-				}
-				gossipLock.Lock()
-				gossipMsgTable.ResetRows()
-				for idx, r := range gossipCounter {
-					gossipMsgTable.AppendRow(table.Row{idx, guardianIndexToNameMap[idx], r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]})
-				}
-				gossipLock.Unlock()
-				if activeTable == 0 {
-					resetTerm(false)
-					chainTable.Render()
-				} else if activeTable == 1 {
-					resetTerm(false)
-					guardianTable.Render()
-				} else if activeTable == 2 {
-					resetTerm(false)
-					gossipMsgTable.Render()
-				} else {
-					resetTerm(false)
-					obsvRateTable.Render()
+		defer func() {
+			keyboard.Close()
+			resetTerm(true)
+		}()
+		go func() {
+			for {
+				char, key, err := keyboard.GetKey()
+				if err != nil {
+					logger.Fatal("error getting key", zap.Error(err))
 				}
-				prompt()
-			}
-		}
-	}()
-
-	// Count govConfigs
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case g := <-govConfigC:
-				addr := "0x" + string(hex.EncodeToString(g.GuardianAddr))
-				idx := guardianIndexMap[strings.ToLower(addr)]
-				gossipCounter[idx][GSM_signedChainGovernorConfig]++
-				gossipCounter[totalsRow][GSM_signedChainGovernorConfig]++
-				gossipLock.Lock()
-				gossipMsgTable.ResetRows()
-				for idx, r := range gossipCounter {
-					gossipMsgTable.AppendRow(table.Row{idx, guardianIndexToNameMap[idx], r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]})
+				if key == keyboard.KeyCtrlC || char == 'q' {
+					break
 				}
-				gossipLock.Unlock()
-			}
-		}
-	}()
-
-	// Count govStatus
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case g := <-govStatusC:
-				addr := "0x" + string(hex.EncodeToString(g.GuardianAddr))
-				idx := guardianIndexMap[strings.ToLower(addr)]
-				gossipCounter[idx][GSM_signedChainGovernorStatus]++
-				gossipCounter[totalsRow][GSM_signedChainGovernorStatus]++
-				gossipLock.Lock()
-				gossipMsgTable.ResetRows()
-				for idx, r := range gossipCounter {
-					gossipMsgTable.AppendRow(table.Row{idx, guardianIndexToNameMap[idx], r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]})
+				switch char {
+				case 'c':
+					rndr.setView(viewChains)
+				case 'g':
+					rndr.setView(viewGuardians)
+				case 'm':
+					rndr.setView(viewMessageCounts)
+				case 'o':
+					rndr.setView(viewObsvRate)
+				case 'i':
+					rndr.setView(viewObsvByChain)
 				}
-				gossipLock.Unlock()
 			}
-		}
-	}()
+			rootCtxCancel()
+		}()
 
-	// Load p2p private key
-	var priv crypto.PrivKey
-	priv, err = node_common.GetOrCreateNodeKey(logger, *nodeKeyPath)
-	if err != nil {
-		logger.Fatal("Failed to load node key", zap.Error(err))
-	}
-
-	// Run supervisor.
-	components := p2p.DefaultComponents()
-	components.Port = *p2pPort
-
-	params, err := p2p.NewRunParams(
-		*p2pBootstrap,
-		*p2pNetworkID,
-		priv,
-		gst,
-		rootCtxCancel,
-		p2p.WithComponents(components),
-		p2p.WithSignedObservationBatchListener(batchObsvC),
-		p2p.WithSignedVAAListener(signedInC),
-		p2p.WithObservationRequestListener(obsvReqC),
-		p2p.WithChainGovernorConfigListener(govConfigC),
-		p2p.WithChainGovernorStatusListener(govStatusC),
-	)
-	if err != nil {
-		logger.Fatal("Failed to create RunParams", zap.Error(err))
+		go rndr.run(rootCtx)
 	}
 
-	supervisor.New(rootCtx, logger, func(ctx context.Context) error {
-		if err := supervisor.Run(ctx,
-			"p2p",
-			p2p.Run(params)); err != nil {
-			return err
+	if *replayFiles != "" {
+		files, err := gossip.ExpandRecordings(*replayFiles)
+		if err != nil {
+			logger.Fatal("Invalid --replay", zap.Error(err))
 		}
-
-		logger.Info("Started internal services")
-
-		<-ctx.Done()
-		return nil
-	},
-		// It's safer to crash and restart the process in case we encounter a panic,
-		// rather than attempting to reschedule the runnable.
-		supervisor.WithPropagatePanic)
-
-	<-rootCtx.Done()
-	logger.Info("root context cancelled, exiting...")
-}
-
-func resetTerm(clear bool) {
-	if clear {
-		tm.Clear()
-	}
-	tm.MoveCursor(1, 1)
-	tm.Flush()
-}
-
-func initObsvTableData(startup bool) {
-	if startup {
-		currentObsvData = make(map[uint]uint)
-		currentObsvTable = make(map[uint]uint)
-		for i := 0; i < numGuardians; i++ {
-			obsvRateRows[i].guardianIndex = uint(i)
-			obsvRateRows[i].guardianName = guardianIndexToNameMap[i]
-			obsvRateRows[i].obsvCount = 0
-			for j := 0; j < 10; j++ {
-				obsvRateRows[i].percents[j] = " "
-			}
+		sinks := &gossip.Sinks{
+			Logger:     logger,
+			Gst:        gst,
+			ObsvBatchC: batchObsvC,
+			ObsvReqC:   obsvReqC,
+			SignedVAAC: signedInC,
+			GovConfigC: govConfigC,
+			GovStatusC: govStatusC,
 		}
-	}
-	for i := 0; i < numGuardians+1; i++ {
-		currentObsvData[uint(i)] = 0
-		if startup {
-			currentObsvTable[uint(i)] = 0
+		go func() {
+			if err := gossip.Replay(rootCtx, logger, files, *replaySpeed, sinks.Dispatch); err != nil && rootCtx.Err() == nil {
+				logger.Error("Replay failed", zap.Error(err))
+			}
+			logger.Info("Replay finished")
+		}()
+	} else {
+		// Load p2p private key
+		var priv crypto.PrivKey
+		priv, err = node_common.GetOrCreateNodeKey(logger, *nodeKeyPath)
+		if err != nil {
+			logger.Fatal("Failed to load node key", zap.Error(err))
 		}
-	}
-}
 
-func handleObsv(idx uint) bool {
-	needToRender := false
-	now := time.Now()
-	if now.Sub(lastTime) > time.Minute {
-		lastTime = now
-		for idx, r := range currentObsvData {
-			currentObsvTable[idx] = r
+		// Run supervisor.
+		components := p2p.DefaultComponents()
+		components.Port = *p2pPort
+
+		params, err := p2p.NewRunParams(
+			*p2pBootstrap,
+			*p2pNetworkID,
+			priv,
+			gst,
+			rootCtxCancel,
+			p2p.WithComponents(components),
+			p2p.WithSignedObservationBatchListener(batchObsvC),
+			p2p.WithSignedVAAListener(signedInC),
+			p2p.WithObservationRequestListener(obsvReqC),
+			p2p.WithChainGovernorConfigListener(govConfigC),
+			p2p.WithChainGovernorStatusListener(govStatusC),
+		)
+		if err != nil {
+			logger.Fatal("Failed to create RunParams", zap.Error(err))
 		}
-		for i := 0; i < numGuardians; i++ {
-			obsvRateRows[i].obsvCount = currentObsvTable[uint(i)]
-			if currentObsvTable[totalsRow] != 0 {
-				pct := currentObsvTable[uint(i)] * 100 / currentObsvTable[totalsRow]
-				for j := 0; j < 10; j++ {
-					if pct >= uint(j+1) {
-						obsvRateRows[i].percents[j] = "="
-					} else {
-						obsvRateRows[i].percents[j] = " "
-					}
-				}
+
+		supervisor.New(rootCtx, logger, func(ctx context.Context) error {
+			if err := supervisor.Run(ctx,
+				"p2p",
+				p2p.Run(params)); err != nil {
+				return err
 			}
-		}
-		initObsvTableData(false)
-		needToRender = true
+
+			logger.Info("Started internal services")
+
+			<-ctx.Done()
+			return nil
+		},
+			// It's safer to crash and restart the process in case we encounter a panic,
+			// rather than attempting to reschedule the runnable.
+			supervisor.WithPropagatePanic)
 	}
-	currentObsvData[idx]++
-	currentObsvData[totalsRow]++
-	return needToRender
-}
 
-func prompt() {
-	fmt.Print("[C]hains, [G]uardians, [M]essage Counts, [O]bsv Rate, [Q]uit: ")
+	<-rootCtx.Done()
+	logger.Info("root context cancelled, exiting...")
 }
 
 func getGaugeValue(gauge prometheus.Gauge) (float64, error) {
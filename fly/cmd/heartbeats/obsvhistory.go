@@ -0,0 +1,221 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+const (
+	// obsvHistoryLen is the number of buckets kept in the observation history.
+	obsvHistoryLen = 60
+	// obsvBucketWidth is the time span covered by one bucket.
+	obsvBucketWidth = time.Minute
+)
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// obsvBucket holds the observation counts for one bucket.
+type obsvBucket struct {
+	start time.Time
+	// byGuardian is indexed by guardian index, the last entry is the total.
+	byGuardian []uint
+	// byChain holds, per chain, the counts indexed by guardian index, the last entry is the total.
+	byChain map[vaa.ChainID][]uint
+}
+
+// obsvHistory is a ring of fixed width buckets counting observations per guardian and per chain.
+// It is owned by the aggregator and not safe for concurrent use.
+type obsvHistory struct {
+	numGuardians int
+	buckets      [obsvHistoryLen]obsvBucket
+	// head is the index of the bucket currently being filled.
+	head int
+}
+
+func newObsvHistory(numGuardians int, now time.Time) *obsvHistory {
+	h := &obsvHistory{numGuardians: numGuardians}
+	for i := range h.buckets {
+		h.buckets[i] = obsvBucket{
+			byGuardian: make([]uint, numGuardians+1),
+			byChain:    map[vaa.ChainID][]uint{},
+		}
+	}
+	h.buckets[0].start = now.Truncate(obsvBucketWidth)
+	return h
+}
+
+// advance rotates the ring so that the head bucket covers now. It returns true if any bucket was rotated.
+func (h *obsvHistory) advance(now time.Time) bool {
+	start := now.Truncate(obsvBucketWidth)
+	cur := h.buckets[h.head].start
+	if !start.After(cur) {
+		return false
+	}
+	steps := int(start.Sub(cur) / obsvBucketWidth)
+	if steps > obsvHistoryLen {
+		steps = obsvHistoryLen
+	}
+	for i := 0; i < steps; i++ {
+		h.head = (h.head + 1) % obsvHistoryLen
+		b := &h.buckets[h.head]
+		clear(b.byGuardian)
+		clear(b.byChain)
+	}
+	h.buckets[h.head].start = start
+	return true
+}
+
+// add counts one observation of the given chain by the guardian at idx (-1 if unknown).
+func (h *obsvHistory) add(now time.Time, idx int, chain vaa.ChainID) {
+	h.advance(now)
+	b := &h.buckets[h.head]
+	counts, ok := b.byChain[chain]
+	if !ok {
+		counts = make([]uint, h.numGuardians+1)
+		b.byChain[chain] = counts
+	}
+	if idx >= 0 {
+		b.byGuardian[idx]++
+		counts[idx]++
+	}
+	b.byGuardian[h.numGuardians]++
+	counts[h.numGuardians]++
+}
+
+// bucket returns the bucket that is age buckets older than the head.
+func (h *obsvHistory) bucket(age int) *obsvBucket {
+	return &h.buckets[(h.head-age+obsvHistoryLen)%obsvHistoryLen]
+}
+
+// guardianRows summarizes the history of every guardian. The sparkline shows, oldest to newest,
+// each guardian's count relative to the busiest guardian in the same bucket.
+func (h *obsvHistory) guardianRows() []obsvRateRow {
+	rows := make([]obsvRateRow, h.numGuardians)
+	for i := range rows {
+		rows[i].guardianIndex = uint(i)
+		rows[i].guardianName = guardianIndexToNameMap[i]
+	}
+
+	// The head bucket is still being filled, so the "last minute" figures come from the one before.
+	last := h.bucket(1)
+	for i := range rows {
+		rows[i].obsvCount = last.byGuardian[i]
+		if total := last.byGuardian[h.numGuardians]; total != 0 {
+			rows[i].share = float64(last.byGuardian[i]) * 100 / float64(total)
+		}
+	}
+
+	var sb strings.Builder
+	for i := range rows {
+		sb.Reset()
+		for age := obsvHistoryLen - 1; age >= 0; age-- {
+			b := h.bucket(age)
+			sb.WriteRune(sparkRune(b.byGuardian[i], maxUint(b.byGuardian[:h.numGuardians])))
+		}
+		rows[i].spark = sb.String()
+	}
+	return rows
+}
+
+// chainRows summarizes the history of every chain seen in the last obsvHistoryLen buckets. Guardians
+// whose count over the last window buckets is below ratio times the median of all guardians are
+// reported as under-observing.
+func (h *obsvHistory) chainRows(window int, ratio float64) []obsvChainRow {
+	if window < 1 {
+		window = 1
+	}
+	if window > obsvHistoryLen {
+		window = obsvHistoryLen
+	}
+
+	chains := map[vaa.ChainID]bool{}
+	for i := range h.buckets {
+		for c := range h.buckets[i].byChain {
+			chains[c] = true
+		}
+	}
+
+	rows := make([]obsvChainRow, 0, len(chains))
+	var sb strings.Builder
+	for chain := range chains {
+		row := obsvChainRow{chain: chain}
+
+		// Chain total over the whole history as a sparkline, relative to the busiest bucket.
+		totals := make([]uint, obsvHistoryLen)
+		for age := obsvHistoryLen - 1; age >= 0; age-- {
+			if counts, ok := h.bucket(age).byChain[chain]; ok {
+				totals[obsvHistoryLen-1-age] = counts[h.numGuardians]
+				row.total += counts[h.numGuardians]
+			}
+		}
+		sb.Reset()
+		peak := maxUint(totals)
+		for _, t := range totals {
+			sb.WriteRune(sparkRune(t, peak))
+		}
+		row.spark = sb.String()
+
+		// Per guardian counts over the comparison window.
+		perGuardian := make([]uint, h.numGuardians)
+		for age := 0; age < window; age++ {
+			if counts, ok := h.bucket(age).byChain[chain]; ok {
+				for i := 0; i < h.numGuardians; i++ {
+					perGuardian[i] += counts[i]
+				}
+			}
+		}
+		row.median = medianUint(perGuardian)
+		if row.median > 0 {
+			for i, c := range perGuardian {
+				if float64(c) < ratio*row.median {
+					row.under = append(row.under, underObserver{
+						guardianIndex: i,
+						guardianName:  guardianIndexToNameMap[i],
+						count:         c,
+						pctOfMedian:   float64(c) * 100 / row.median,
+					})
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].chain < rows[j].chain })
+	return rows
+}
+
+func sparkRune(v, peak uint) rune {
+	if peak == 0 {
+		return ' '
+	}
+	if v == 0 {
+		return '·'
+	}
+	i := int(v * uint(len(sparkChars)-1) / peak)
+	return sparkChars[i]
+}
+
+func maxUint(vals []uint) uint {
+	m := uint(0)
+	for _, v := range vals {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
+
+func medianUint(vals []uint) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	s := append([]uint(nil), vals...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	mid := len(s) / 2
+	if len(s)%2 == 0 {
+		return float64(s[mid-1]+s[mid]) / 2
+	}
+	return float64(s[mid])
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+var historyStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestChainRows(t *testing.T) {
+	tests := []struct {
+		name string
+		// counts holds, per bucket age, the observations of chain 2 by each of four guardians.
+		counts    map[int][]uint
+		window    int
+		ratio     float64
+		wantTotal uint
+		wantMed   float64
+		wantUnder []int
+	}{
+		{
+			name:      "one guardian under half the median",
+			counts:    map[int][]uint{0: {10, 10, 8, 2}},
+			window:    1,
+			ratio:     0.5,
+			wantTotal: 30,
+			wantMed:   9,
+			wantUnder: []int{3},
+		},
+		{
+			name:      "odd counts with no one under",
+			counts:    map[int][]uint{0: {5, 4, 6, 5}},
+			window:    1,
+			ratio:     0.5,
+			wantTotal: 20,
+			wantMed:   5,
+		},
+		{
+			name:      "the window sums over buckets",
+			counts:    map[int][]uint{0: {3, 3, 0, 3}, 1: {3, 3, 3, 0}},
+			window:    2,
+			ratio:     0.8,
+			wantTotal: 18,
+			wantMed:   4.5,
+			wantUnder: []int{2, 3},
+		},
+		{
+			name:      "buckets outside the window only count towards the total",
+			counts:    map[int][]uint{2: {7, 7, 0, 7}},
+			window:    1,
+			ratio:     0.5,
+			wantTotal: 21,
+			wantMed:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newObsvHistory(4, historyStart)
+			for age := obsvHistoryLen - 1; age >= 0; age-- {
+				now := historyStart.Add(time.Duration(obsvHistoryLen-1-age) * obsvBucketWidth)
+				h.advance(now)
+				for idx, n := range tt.counts[age] {
+					for i := uint(0); i < n; i++ {
+						h.add(now, idx, vaa.ChainIDEthereum)
+					}
+				}
+			}
+
+			rows := h.chainRows(tt.window, tt.ratio)
+			if len(rows) != 1 || rows[0].chain != vaa.ChainIDEthereum {
+				t.Fatalf("rows = %+v, want one row for chain 2", rows)
+			}
+			row := rows[0]
+			if row.total != tt.wantTotal || row.median != tt.wantMed {
+				t.Errorf("total %d and median %v, want %d and %v", row.total, row.median, tt.wantTotal, tt.wantMed)
+			}
+			var under []int
+			for _, u := range row.under {
+				under = append(under, u.guardianIndex)
+				if want := float64(u.count) * 100 / row.median; u.pctOfMedian != want {
+					t.Errorf("guardian %d at %v%% of the median, want %v%%", u.guardianIndex, u.pctOfMedian, want)
+				}
+			}
+			if len(under) != len(tt.wantUnder) {
+				t.Fatalf("under-observing guardians = %v, want %v", under, tt.wantUnder)
+			}
+			for i := range under {
+				if under[i] != tt.wantUnder[i] {
+					t.Errorf("under-observing guardians = %v, want %v", under, tt.wantUnder)
+				}
+			}
+		})
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	h := newObsvHistory(2, historyStart)
+	h.add(historyStart, 0, vaa.ChainIDSolana)
+	h.add(historyStart.Add(30*time.Second), -1, vaa.ChainIDSolana)
+
+	if h.advance(historyStart.Add(59 * time.Second)) {
+		t.Error("advance rotated within the same minute")
+	}
+	if h.advance(historyStart.Add(-time.Minute)) {
+		t.Error("advance rotated backwards")
+	}
+
+	// Idle minutes leave empty buckets behind.
+	if !h.advance(historyStart.Add(3 * time.Minute)) {
+		t.Fatal("advance did not rotate after three minutes")
+	}
+	if b := h.bucket(3); b.byGuardian[0] != 1 || b.byGuardian[2] != 2 || b.byChain[vaa.ChainIDSolana][2] != 2 {
+		t.Errorf("first bucket = %+v, want one observation by guardian 0 out of two", b)
+	}
+	for age := 0; age < 3; age++ {
+		if b := h.bucket(age); b.byGuardian[2] != 0 || len(b.byChain) != 0 {
+			t.Errorf("bucket %d = %+v, want empty", age, b)
+		}
+	}
+	if got := h.bucket(0).start; !got.Equal(historyStart.Add(3 * time.Minute)) {
+		t.Errorf("head starts at %v", got)
+	}
+
+	// A whole idle history clears every bucket, including those about to be reused.
+	h.advance(historyStart.Add(3*time.Minute + 2*obsvHistoryLen*obsvBucketWidth))
+	for age := 0; age < obsvHistoryLen; age++ {
+		if b := h.bucket(age); b.byGuardian[2] != 0 || len(b.byChain) != 0 {
+			t.Fatalf("bucket %d = %+v after a long idle period, want empty", age, b)
+		}
+	}
+	if rows := h.chainRows(5, 0.5); len(rows) != 0 {
+		t.Errorf("chain rows = %+v after a long idle period, want none", rows)
+	}
+}
+
+func TestGuardianRows(t *testing.T) {
+	h := newObsvHistory(2, historyStart)
+	for i := 0; i < 3; i++ {
+		h.add(historyStart, 0, vaa.ChainIDEthereum)
+	}
+	h.add(historyStart, 1, vaa.ChainIDEthereum)
+	// The head bucket is still being filled and is left out of the last minute figures.
+	next := historyStart.Add(obsvBucketWidth)
+	h.add(next, 1, vaa.ChainIDEthereum)
+
+	rows := h.guardianRows()
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v, want 2", rows)
+	}
+	if rows[0].obsvCount != 3 || rows[0].share != 75 || rows[1].obsvCount != 1 || rows[1].share != 25 {
+		t.Errorf("rows = %+v, want 3 (75%%) and 1 (25%%)", rows)
+	}
+	// Each bucket is scaled to its busiest guardian, and buckets without observations are blank.
+	for i, want := range []string{"█·", "▃█"} {
+		spark := []rune(rows[i].spark)
+		if len(spark) != obsvHistoryLen {
+			t.Fatalf("sparkline of guardian %d has %d buckets, want %d", i, len(spark), obsvHistoryLen)
+		}
+		if spark[0] != ' ' {
+			t.Errorf("sparkline of guardian %d starts with %q, want a blank", i, spark[0])
+		}
+		if got := string(spark[obsvHistoryLen-2:]); got != want {
+			t.Errorf("sparkline of guardian %d ends with %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSparkRune(t *testing.T) {
+	tests := []struct {
+		v, peak uint
+		want    rune
+	}{
+		{v: 0, peak: 0, want: ' '},
+		{v: 0, peak: 5, want: '·'},
+		{v: 5, peak: 5, want: '█'},
+		{v: 1, peak: 7, want: '▂'},
+		{v: 1, peak: 8, want: '▁'},
+		{v: 4, peak: 8, want: '▄'},
+	}
+	for _, tt := range tests {
+		if got := sparkRune(tt.v, tt.peak); got != tt.want {
+			t.Errorf("sparkRune(%d, %d) = %q, want %q", tt.v, tt.peak, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tm "github.com/buger/goterm"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+type view int
+
+const (
+	viewChains view = iota
+	viewGuardians
+	viewMessageCounts
+	viewObsvRate
+	viewObsvByChain
+)
+
+// renderer redraws the active view from aggregator snapshots at a fixed frame rate.
+// Frames are skipped when neither the state nor the active view has changed since the last draw.
+type renderer struct {
+	agg      *aggregator
+	interval time.Duration
+	viewC    chan view
+
+	active      view
+	lastVersion uint64
+	drawn       bool
+}
+
+func newRenderer(agg *aggregator, interval time.Duration) *renderer {
+	return &renderer{
+		agg:      agg,
+		interval: interval,
+		viewC:    make(chan view, 1),
+		active:   viewGuardians,
+	}
+}
+
+// setView switches the active view. The next frame clears the screen and is always drawn.
+func (r *renderer) setView(v view) {
+	select {
+	case r.viewC <- v:
+	default:
+		// A view change is already pending. Replace it with the latest one.
+		select {
+		case <-r.viewC:
+		default:
+		}
+		r.viewC <- v
+	}
+}
+
+func (r *renderer) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	resetTerm(true)
+	r.draw(ctx, false)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v := <-r.viewC:
+			r.active = v
+			resetTerm(true)
+			r.draw(ctx, true)
+		case <-ticker.C:
+			r.draw(ctx, false)
+		}
+	}
+}
+
+func (r *renderer) draw(ctx context.Context, force bool) {
+	s := r.agg.snapshot(ctx)
+	if s == nil {
+		return
+	}
+	if r.drawn && !force && s.version == r.lastVersion {
+		return
+	}
+	r.lastVersion = s.version
+	r.drawn = true
+
+	var t table.Writer
+	switch r.active {
+	case viewChains:
+		t = chainTable(s)
+	case viewGuardians:
+		t = guardianTable(s)
+	case viewMessageCounts:
+		t = gossipMsgTable(s)
+	case viewObsvRate:
+		t = obsvRateTable(s)
+	default:
+		t = obsvChainTable(s)
+	}
+	resetTerm(false)
+	t.Render()
+	prompt()
+}
+
+func newTable(header table.Row) table.Writer {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(header)
+	t.SetStyle(table.StyleColoredDark)
+	return t
+}
+
+func chainTable(s *snapshot) table.Writer {
+	t := newTable(table.Row{"ID", "Chain", "Status", "Healthy", "Highest"})
+	for _, c := range s.chains {
+		t.AppendRow(table.Row{c.id, vaa.ChainID(c.id), c.status, c.healthy, c.highest})
+	}
+	return t
+}
+
+func guardianTable(s *snapshot) table.Writer {
+	t := newTable(table.Row{"#", "Guardian", "Version", "Features", "Counter", "Boot", "Timestamp", "Address"})
+	for _, g := range s.guardians {
+		if g.seen {
+			t.AppendRow(table.Row{g.index, g.hb.nodeName, g.hb.version, strings.Join(g.hb.features, ", "), g.hb.counter, g.hb.bootTimestamp, g.hb.timestamp, g.addr})
+		} else {
+			t.AppendRow(table.Row{g.index, "", "", "", "", "", "", g.addr})
+		}
+	}
+	return t
+}
+
+func gossipMsgTable(s *snapshot) table.Writer {
+	t := newTable(table.Row{"#", "Guardian", "ObsvInB", "ObsvB", "TB_OBsv", "HB", "VAA", "Obsv_Req", "Chain_Gov_Cfg", "Chain_Gov_Status"})
+	for idx, r := range s.gossipCounter {
+		t.AppendRow(table.Row{idx, guardianIndexToNameMap[idx], r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]})
+	}
+	return t
+}
+
+func obsvRateTable(s *snapshot) table.Writer {
+	t := newTable(table.Row{"#", "Guardian", "Last Min", "Share", fmt.Sprintf("Last %d min (relative to busiest guardian)", obsvHistoryLen)})
+	for i, r := range s.obsvRate {
+		t.AppendRow(table.Row{i, r.guardianName, r.obsvCount, fmt.Sprintf("%.1f%%", r.share), r.spark})
+	}
+	return t
+}
+
+func obsvChainTable(s *snapshot) table.Writer {
+	t := newTable(table.Row{"ID", "Chain", "Obsv", "Median", fmt.Sprintf("Last %d min", obsvHistoryLen), "Under-observing"})
+	for _, c := range s.obsvChains {
+		under := make([]string, 0, len(c.under))
+		for _, u := range c.under {
+			under = append(under, fmt.Sprintf("%s (%.0f%%)", u.guardianName, u.pctOfMedian))
+		}
+		t.AppendRow(table.Row{uint16(c.chain), c.chain, c.total, c.median, c.spark, strings.Join(under, ", ")})
+	}
+	return t
+}
+
+func resetTerm(clear bool) {
+	if clear {
+		tm.Clear()
+	}
+	tm.MoveCursor(1, 1)
+	tm.Flush()
+}
+
+func prompt() {
+	fmt.Print("[C]hains, [G]uardians, [M]essage Counts, [O]bsv Rate, Obsv by Cha[I]n, [Q]uit: ")
+}
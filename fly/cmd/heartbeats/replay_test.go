@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"go.uber.org/zap"
+)
+
+// TestReplayIntoTUI replays a recording into the aggregator the way main does with --replay, and renders the tables.
+func TestReplayIntoTUI(t *testing.T) {
+	g0, g1, outsider := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	boot := at.Add(-time.Hour).UnixNano()
+	path := gossiptest.WriteRecording(t,
+		gossiptest.Envelope(t, g0.Peer, "control", at, g0.Heartbeat(t, &gossipv1.Heartbeat{
+			NodeName: "node-0", Counter: 7, Timestamp: at.UnixNano(), BootTimestamp: boot, Version: "v2.24.0",
+			Networks: []*gossipv1.Heartbeat_Network{{Id: 2, Height: 100}},
+		})),
+		// Not in the guardian set, so it is dropped.
+		gossiptest.Envelope(t, outsider.Peer, "control", at, outsider.Heartbeat(t, &gossipv1.Heartbeat{NodeName: "outsider", Counter: 1})),
+		gossiptest.Envelope(t, g1.Peer, "attestation", at.Add(time.Second), g1.ObservationBatch(
+			g1.Observation(t, "2/0000000000000000000000000000000000000000000000000000000000000001/1", make([]byte, 32)),
+			g1.Observation(t, "2/0000000000000000000000000000000000000000000000000000000000000001/2", make([]byte, 32)),
+		)),
+		gossiptest.Envelope(t, g1.Peer, "control", at.Add(2*time.Second), &gossipv1.GossipMessage{
+			Message: &gossipv1.GossipMessage_SignedChainGovernorStatus{SignedChainGovernorStatus: &gossipv1.SignedChainGovernorStatus{GuardianAddr: g1.Addr.Bytes()}},
+		}),
+	)
+
+	batchObsvC := make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch], 10)
+	obsvReqC := make(chan *gossipv1.ObservationRequest, 10)
+	signedInC := make(chan *gossipv1.SignedVAAWithQuorum, 10)
+	heartbeatC := make(chan *gossipv1.Heartbeat, 10)
+	govConfigC := make(chan *gossipv1.SignedChainGovernorConfig, 10)
+	govStatusC := make(chan *gossipv1.SignedChainGovernorStatus, 10)
+	keys := []eth_common.Address{g0.Addr, g1.Addr}
+	gst := node_common.NewGuardianSetState(heartbeatC)
+	gst.Set(&node_common.GuardianSet{Keys: keys})
+
+	a, ctx := startAggregator(t, keys, inputs{
+		batchObsvC: batchObsvC,
+		obsvReqC:   obsvReqC,
+		signedInC:  signedInC,
+		heartbeatC: heartbeatC,
+		govConfigC: govConfigC,
+		govStatusC: govStatusC,
+	})
+	sinks := &gossip.Sinks{
+		Logger:     zap.NewNop(),
+		Gst:        gst,
+		ObsvBatchC: batchObsvC,
+		ObsvReqC:   obsvReqC,
+		SignedVAAC: signedInC,
+		GovConfigC: govConfigC,
+		GovStatusC: govStatusC,
+	}
+	if err := gossip.Replay(ctx, zap.NewNop(), []string{path}, 0, sinks.Dispatch); err != nil {
+		t.Fatal(err)
+	}
+
+	// The heartbeat, the batch and the governor status.
+	var s *snapshot
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if s = a.snapshot(ctx); s.version >= 3 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if s.version != 3 {
+		t.Fatalf("version = %d, want 3", s.version)
+	}
+	if got := s.gossipCounter[0][GSM_signedHeartbeat]; got != 1 {
+		t.Errorf("heartbeats of guardian 0 = %d, want 1", got)
+	}
+	if got := s.gossipCounter[totalsRow][GSM_signedHeartbeat]; got != 1 {
+		t.Errorf("total heartbeats = %d, want 1, the outsider is not counted", got)
+	}
+	if got := s.gossipCounter[1][GSM_signedObservationInBatch]; got != 2 {
+		t.Errorf("observations of guardian 1 = %d, want 2", got)
+	}
+	if got := s.gossipCounter[1][GSM_signedChainGovernorStatus]; got != 1 {
+		t.Errorf("governor statuses of guardian 1 = %d, want 1", got)
+	}
+
+	guardians := guardianTable(s)
+	guardians.SetOutputMirror(nil)
+	if out := guardians.Render(); !strings.Contains(out, "node-0") || !strings.Contains(out, "v2.24.0") || strings.Contains(out, "outsider") {
+		t.Errorf("guardian table does not show the heartbeat of guardian 0 only:\n%s", out)
+	}
+	chains := chainTable(s)
+	chains.SetOutputMirror(nil)
+	if out := chains.Render(); !strings.Contains(out, "100") {
+		t.Errorf("chain table does not show the height from the heartbeat:\n%s", out)
+	}
+	counts := gossipMsgTable(s)
+	counts.SetOutputMirror(nil)
+	if out := counts.Render(); !strings.Contains(out, "guardian-1") {
+		t.Errorf("message count table does not name the guardians:\n%s", out)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+)
+
+//go:embed web/index.html
+var indexHTML []byte
+
+// The JSON representation of a snapshot, served by the web UI.
+type stateJSON struct {
+	Version       uint64             `json:"version"`
+	Guardians     []guardianJSON     `json:"guardians"`
+	Chains        []chainJSON        `json:"chains"`
+	MessageCounts []messageCountJSON `json:"messageCounts"`
+	ObsvRate      []obsvRateJSON     `json:"obsvRate"`
+	ObsvChains    []obsvChainJSON    `json:"obsvChains"`
+}
+
+type guardianJSON struct {
+	Index         int       `json:"index"`
+	Address       string    `json:"address"`
+	Seen          bool      `json:"seen"`
+	Name          string    `json:"name,omitempty"`
+	Version       string    `json:"version,omitempty"`
+	Features      []string  `json:"features,omitempty"`
+	Counter       string    `json:"counter,omitempty"`
+	BootTimestamp time.Time `json:"bootTimestamp"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+type chainJSON struct {
+	ID      uint32 `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Healthy int    `json:"healthy"`
+	Highest int64  `json:"highest"`
+}
+
+type messageCountJSON struct {
+	Index           int    `json:"index"`
+	Guardian        string `json:"guardian"`
+	ObsvInBatch     int    `json:"obsvInBatch"`
+	ObsvBatch       int    `json:"obsvBatch"`
+	TokenBridgeObsv int    `json:"tokenBridgeObsv"`
+	Heartbeat       int    `json:"heartbeat"`
+	VAA             int    `json:"vaa"`
+	ObsvRequest     int    `json:"obsvRequest"`
+	ChainGovConfig  int    `json:"chainGovConfig"`
+	ChainGovStatus  int    `json:"chainGovStatus"`
+}
+
+type obsvRateJSON struct {
+	Index     uint    `json:"index"`
+	Guardian  string  `json:"guardian"`
+	LastMin   uint    `json:"lastMin"`
+	SharePct  float64 `json:"sharePct"`
+	Sparkline string  `json:"sparkline"`
+}
+
+type obsvChainJSON struct {
+	ID             uint16              `json:"id"`
+	Name           string              `json:"name"`
+	Total          uint                `json:"total"`
+	Median         float64             `json:"median"`
+	Sparkline      string              `json:"sparkline"`
+	UnderObserving []underObserverJSON `json:"underObserving"`
+}
+
+type underObserverJSON struct {
+	Index       int     `json:"index"`
+	Guardian    string  `json:"guardian"`
+	Count       uint    `json:"count"`
+	PctOfMedian float64 `json:"pctOfMedian"`
+}
+
+func (s *snapshot) toJSON() *stateJSON {
+	out := &stateJSON{
+		Version:       s.version,
+		Guardians:     make([]guardianJSON, 0, len(s.guardians)),
+		Chains:        make([]chainJSON, 0, len(s.chains)),
+		MessageCounts: make([]messageCountJSON, 0, len(s.gossipCounter)),
+		ObsvRate:      make([]obsvRateJSON, 0, len(s.obsvRate)),
+		ObsvChains:    make([]obsvChainJSON, 0, len(s.obsvChains)),
+	}
+	for _, g := range s.guardians {
+		gj := guardianJSON{Index: g.index, Address: g.addr.Hex(), Seen: g.seen}
+		if g.seen {
+			gj.Name = g.hb.nodeName
+			gj.Version = g.hb.version
+			gj.Features = g.hb.features
+			gj.Counter = g.hb.counter
+			gj.BootTimestamp = g.hb.bootTimestamp
+			gj.Timestamp = g.hb.timestamp
+		}
+		out.Guardians = append(out.Guardians, gj)
+	}
+	for _, c := range s.chains {
+		out.Chains = append(out.Chains, chainJSON{ID: c.id, Name: vaa.ChainID(c.id).String(), Status: c.status, Healthy: c.healthy, Highest: c.highest})
+	}
+	for idx, r := range s.gossipCounter {
+		out.MessageCounts = append(out.MessageCounts, messageCountJSON{
+			Index:           idx,
+			Guardian:        guardianIndexToNameMap[idx],
+			ObsvInBatch:     r[GSM_signedObservationInBatch],
+			ObsvBatch:       r[GSM_signedObservationBatch],
+			TokenBridgeObsv: r[GSM_tbObservation],
+			Heartbeat:       r[GSM_signedHeartbeat],
+			VAA:             r[GSM_signedVaaWithQuorum],
+			ObsvRequest:     r[GSM_signedObservationRequest],
+			ChainGovConfig:  r[GSM_signedChainGovernorConfig],
+			ChainGovStatus:  r[GSM_signedChainGovernorStatus],
+		})
+	}
+	for _, r := range s.obsvRate {
+		out.ObsvRate = append(out.ObsvRate, obsvRateJSON{Index: r.guardianIndex, Guardian: r.guardianName, LastMin: r.obsvCount, SharePct: r.share, Sparkline: r.spark})
+	}
+	for _, c := range s.obsvChains {
+		cj := obsvChainJSON{ID: uint16(c.chain), Name: c.chain.String(), Total: c.total, Median: c.median, Sparkline: c.spark, UnderObserving: []underObserverJSON{}}
+		for _, u := range c.under {
+			cj.UnderObserving = append(cj.UnderObserving, underObserverJSON{Index: u.guardianIndex, Guardian: u.guardianName, Count: u.count, PctOfMedian: u.pctOfMedian})
+		}
+		out.ObsvChains = append(out.ObsvChains, cj)
+	}
+	return out
+}
+
+// webServer serves the aggregated state as an HTML page, a JSON API and a server-sent event stream.
+// Any number of browsers can watch the same monitor.
+type webServer struct {
+	logger   *zap.Logger
+	agg      *aggregator
+	interval time.Duration
+}
+
+func newWebServer(logger *zap.Logger, agg *aggregator, interval time.Duration) *webServer {
+	return &webServer{logger: logger, agg: agg, interval: interval}
+}
+
+func (w *webServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", w.handleIndex)
+	mux.HandleFunc("GET /api/state", w.handleState)
+	mux.HandleFunc("GET /api/events", w.handleEvents)
+	return mux
+}
+
+// run serves on addr until the context is cancelled.
+func (w *webServer) run(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           w.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(_ net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	w.logger.Info("serving web UI", zap.String("addr", addr))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (w *webServer) handleIndex(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = rw.Write(indexHTML)
+}
+
+func (w *webServer) handleState(rw http.ResponseWriter, r *http.Request) {
+	s := w.agg.snapshot(r.Context())
+	if s == nil {
+		http.Error(rw, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(s.toJSON()); err != nil {
+		w.logger.Debug("failed to write state", zap.Error(err))
+	}
+}
+
+// handleEvents pushes the state every time it changes, at most once per refresh interval.
+func (w *webServer) handleEvents(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+
+	ctx := r.Context()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	var lastVersion uint64
+	sent := false
+	for {
+		s := w.agg.snapshot(ctx)
+		if s == nil {
+			return
+		}
+		if !sent || s.version != lastVersion {
+			b, err := json.Marshal(s.toJSON())
+			if err != nil {
+				w.logger.Error("failed to marshal state", zap.Error(err))
+				return
+			}
+			if _, err := fmt.Fprintf(rw, "data: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastVersion = s.version
+			sent = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"go.uber.org/zap"
+)
+
+// readEvents sends the state of every server-sent event of the stream to the returned channel.
+func readEvents(t *testing.T, ctx context.Context, url string) <-chan stateJSON {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	eventC := make(chan stateJSON)
+	go func() {
+		defer resp.Body.Close()
+		defer close(eventC)
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			data, ok := strings.CutPrefix(sc.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var s stateJSON
+			if err := json.Unmarshal([]byte(data), &s); err != nil {
+				t.Errorf("invalid event %q: %v", data, err)
+				return
+			}
+			select {
+			case eventC <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return eventC
+}
+
+func TestEventsOnlyOnChange(t *testing.T) {
+	a, src, ctx := testAggregator(t)
+	const interval = 10 * time.Millisecond
+	srv := httptest.NewServer(newWebServer(zap.NewNop(), a, interval).handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	eventC := readEvents(t, ctx, srv.URL+"/api/events")
+
+	// The current state is sent right away.
+	select {
+	case s := <-eventC:
+		if s.Version != 0 {
+			t.Errorf("first event has version %d, want 0", s.Version)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no initial event")
+	}
+
+	// Nothing happens for many refresh intervals, so nothing is sent.
+	select {
+	case s := <-eventC:
+		t.Fatalf("idle aggregator sent an event with version %d", s.Version)
+	case <-time.After(50 * interval):
+	}
+
+	src.heartbeatC <- &gossipv1.Heartbeat{GuardianAddr: testKeys[0].Hex(), NodeName: "g0", Counter: 1}
+	select {
+	case s := <-eventC:
+		if s.Version != 1 || !s.Guardians[0].Seen || s.Guardians[0].Name != "g0" {
+			t.Errorf("event after the heartbeat = %+v, want version 1 with guardian 0 seen", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after the heartbeat")
+	}
+
+	select {
+	case s := <-eventC:
+		t.Fatalf("idle aggregator sent another event with version %d", s.Version)
+	case <-time.After(50 * interval):
+	}
+}
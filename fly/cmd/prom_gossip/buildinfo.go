@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	guardianBuildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "guardian_build_info",
+		Help: "Always 1, labeled with the version each guardian reports in its heartbeats",
+	}, []string{"guardian_name", "version"})
+	guardianFeature = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "guardian_feature_enabled",
+		Help: "Always 1, for each feature flag each guardian reports in its heartbeats",
+	}, []string{"guardian_name", "feature"})
+	guardianBootTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "guardian_boot_timestamp_seconds",
+		Help: "Unix time at which each guardian reports it booted",
+	}, []string{"guardian_name"})
+)
+
+type guardianBuild struct {
+	version  string
+	features map[string]bool
+	boot     time.Time
+}
+
+// buildInfoTracker keeps the version, features and boot time of every guardian, so that stale label sets can be
+// removed when they change, and so that it can report the rollout state.
+type buildInfoTracker struct {
+	mu     sync.Mutex
+	builds map[string]*guardianBuild
+}
+
+func newBuildInfoTracker() *buildInfoTracker {
+	return &buildInfoTracker{builds: map[string]*guardianBuild{}}
+}
+
+func (t *buildInfoTracker) heartbeat(name string, hb *gossipv1.Heartbeat) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.builds[name]
+	if !ok {
+		b = &guardianBuild{features: map[string]bool{}}
+		t.builds[name] = b
+	}
+	if b.version != hb.Version {
+		if ok {
+			guardianBuildInfo.DeleteLabelValues(name, b.version)
+		}
+		b.version = hb.Version
+	}
+	guardianBuildInfo.WithLabelValues(name, b.version).Set(1)
+
+	features := make(map[string]bool, len(hb.Features))
+	for _, f := range hb.Features {
+		features[f] = true
+		guardianFeature.WithLabelValues(name, f).Set(1)
+	}
+	for f := range b.features {
+		if !features[f] {
+			guardianFeature.DeleteLabelValues(name, f)
+		}
+	}
+	b.features = features
+
+	b.boot = time.Unix(0, hb.BootTimestamp)
+	guardianBootTimestamp.WithLabelValues(name).Set(float64(b.boot.Unix()))
+}
+
+type rolloutVersion struct {
+	Version   string   `json:"version"`
+	Guardians []string `json:"guardians"`
+}
+
+type rolloutReport struct {
+	Versions []rolloutVersion `json:"versions"`
+	// NotSeen lists the guardians of the set that haven't sent a heartbeat yet.
+	NotSeen []string `json:"notSeen"`
+}
+
+func (t *buildInfoTracker) report() rolloutReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	byVersion := map[string][]string{}
+	for name, b := range t.builds {
+		byVersion[b.version] = append(byVersion[b.version], name)
+	}
+	r := rolloutReport{NotSeen: []string{}}
+	for v, names := range byVersion {
+		sort.Strings(names)
+		r.Versions = append(r.Versions, rolloutVersion{Version: v, Guardians: names})
+	}
+	// The most common version first.
+	sort.Slice(r.Versions, func(i, j int) bool {
+		if len(r.Versions[i].Guardians) != len(r.Versions[j].Guardians) {
+			return len(r.Versions[i].Guardians) > len(r.Versions[j].Guardians)
+		}
+		return r.Versions[i].Version > r.Versions[j].Version
+	})
+	for idx := 0; idx < numGuardians; idx++ {
+		name := guardianIndexToNameMap[idx]
+		if _, ok := t.builds[name]; !ok {
+			r.NotSeen = append(r.NotSeen, name)
+		}
+	}
+	return r
+}
+
+// ServeHTTP serves the rollout report, as text or, with ?format=json, as JSON.
+func (t *buildInfoTracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r := t.report()
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, v := range r.Versions {
+		fmt.Fprintf(w, "%s (%d/%d): %s\n", v.Version, len(v.Guardians), numGuardians, strings.Join(v.Guardians, ", "))
+	}
+	if len(r.NotSeen) > 0 {
+		fmt.Fprintf(w, "not seen (%d/%d): %s\n", len(r.NotSeen), numGuardians, strings.Join(r.NotSeen, ", "))
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	governorNotionalLimit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_governor_notional_limit",
+		Help: "The daily notional limit of the governor, in USD, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	governorBigTransactionSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_governor_big_transaction_size",
+		Help: "The notional value, in USD, above which a single transfer is delayed by the governor, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	governorAvailableNotional = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_governor_available_notional",
+		Help: "The remaining available notional of the governor, in USD, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	governorEnqueuedVAAs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_governor_enqueued_vaas",
+		Help: "The number of VAAs enqueued by the governor, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	governorEnqueuedNotional = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_governor_enqueued_notional",
+		Help: "The total notional value, in USD, of the VAAs enqueued by the governor, by guardian, chain and emitter",
+	}, []string{"guardian_name", "chain_name", "emitter_address"})
+)
+
+// governorTracker exports the latest governor config and status of every guardian.
+// It remembers which emitters each guardian last reported so their gauges can be removed once their queue drains.
+// status is not safe for concurrent use.
+type governorTracker struct {
+	emitters map[string]map[[2]string]bool
+}
+
+func newGovernorTracker() *governorTracker {
+	return &governorTracker{emitters: map[string]map[[2]string]bool{}}
+}
+
+func (t *governorTracker) config(name string, s *gossipv1.SignedChainGovernorConfig) error {
+	var cfg gossipv1.ChainGovernorConfig
+	if err := proto.Unmarshal(s.Config, &cfg); err != nil {
+		return fmt.Errorf("failed to unmarshal governor config: %w", err)
+	}
+	for _, c := range cfg.Chains {
+		chain := vaa.ChainID(c.ChainId).String()
+		governorNotionalLimit.WithLabelValues(name, chain).Set(float64(c.NotionalLimit))
+		governorBigTransactionSize.WithLabelValues(name, chain).Set(float64(c.BigTransactionSize))
+	}
+	return nil
+}
+
+func (t *governorTracker) status(name string, s *gossipv1.SignedChainGovernorStatus) error {
+	var status gossipv1.ChainGovernorStatus
+	if err := proto.Unmarshal(s.Status, &status); err != nil {
+		return fmt.Errorf("failed to unmarshal governor status: %w", err)
+	}
+	emitters := map[[2]string]bool{}
+	for _, c := range status.Chains {
+		chain := vaa.ChainID(c.ChainId).String()
+		governorAvailableNotional.WithLabelValues(name, chain).Set(float64(c.RemainingAvailableNotional))
+		enqueued := uint64(0)
+		for _, e := range c.Emitters {
+			enqueued += e.TotalEnqueuedVaas
+			notional := uint64(0)
+			for _, v := range e.EnqueuedVaas {
+				notional += v.NotionalValue
+			}
+			governorEnqueuedNotional.WithLabelValues(name, chain, e.EmitterAddress).Set(float64(notional))
+			emitters[[2]string{chain, e.EmitterAddress}] = true
+		}
+		governorEnqueuedVAAs.WithLabelValues(name, chain).Set(float64(enqueued))
+	}
+	for key := range t.emitters[name] {
+		if !emitters[key] {
+			governorEnqueuedNotional.DeleteLabelValues(name, key[0], key[1])
+		}
+	}
+	t.emitters[name] = emitters
+	return nil
+}
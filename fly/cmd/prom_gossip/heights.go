@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+var (
+	guardianChainHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_guardian_chain_height",
+		Help: "The latest block height reported in heartbeats, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	guardianChainSafeHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_guardian_chain_safe_height",
+		Help: "The safe block height reported in heartbeats, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	guardianChainFinalizedHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_guardian_chain_finalized_height",
+		Help: "The finalized block height reported in heartbeats, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	guardianChainErrorCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_guardian_chain_error_count",
+		Help: "The watcher error count reported in heartbeats, by guardian and chain",
+	}, []string{"guardian_name", "chain_name"})
+	guardianChainHeightLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_guardian_chain_height_lag",
+		Help: "How many blocks the height reported by a guardian is behind the quorum height of the chain (the highest height reached by a quorum of guardians)",
+	}, []string{"guardian_name", "chain_name"})
+	guardianChainLastObservation = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_guardian_chain_last_observation_signed_at_seconds",
+		Help: "Unix time at which a guardian last signed an observation for a chain, as reported in its heartbeats",
+	}, []string{"guardian_name", "chain_name"})
+	heartbeatAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_heartbeat_age_seconds",
+		Help: "Seconds since the latest heartbeat of each guardian was received",
+	}, []string{"guardian_name"})
+)
+
+// guardianHeight is the latest height reported by a guardian for a chain.
+type guardianHeight struct {
+	addr   eth_common.Address
+	height int64
+}
+
+// heightTracker keeps the latest heights of every guardian, which are needed to compute the quorum height of a chain,
+// and the time of their latest heartbeat. The quorum follows the current guardian set of gst.
+type heightTracker struct {
+	mu            sync.Mutex
+	gst           *node_common.GuardianSetState
+	heights       map[vaa.ChainID]map[string]guardianHeight
+	lastHeartbeat map[string]time.Time
+}
+
+func newHeightTracker(gst *node_common.GuardianSetState) *heightTracker {
+	return &heightTracker{
+		gst:           gst,
+		heights:       map[vaa.ChainID]map[string]guardianHeight{},
+		lastHeartbeat: map[string]time.Time{},
+	}
+}
+
+// heartbeat updates the gauges of the guardian that sent hb, and the lag of every guardian on the chains it reports.
+func (t *heightTracker) heartbeat(name string, hb *gossipv1.Heartbeat, receivedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastHeartbeat[name] = receivedAt
+	heartbeatAge.WithLabelValues(name).Set(0)
+
+	for _, n := range hb.Networks {
+		chain := vaa.ChainID(n.Id)
+		chainName := chain.String()
+		guardianChainHeight.WithLabelValues(name, chainName).Set(float64(n.Height))
+		guardianChainSafeHeight.WithLabelValues(name, chainName).Set(float64(n.SafeHeight))
+		guardianChainFinalizedHeight.WithLabelValues(name, chainName).Set(float64(n.FinalizedHeight))
+		guardianChainErrorCount.WithLabelValues(name, chainName).Set(float64(n.ErrorCount))
+		if n.LastObservationSignedAt > 0 {
+			// Reported in nanoseconds.
+			guardianChainLastObservation.WithLabelValues(name, chainName).Set(float64(n.LastObservationSignedAt) / 1e9)
+		}
+
+		if t.heights[chain] == nil {
+			t.heights[chain] = map[string]guardianHeight{}
+		}
+		t.heights[chain][name] = guardianHeight{addr: eth_common.HexToAddress(hb.GuardianAddr), height: n.Height}
+		t.updateLag(chain)
+	}
+}
+
+// updateLag must be called with t.mu held.
+func (t *heightTracker) updateLag(chain vaa.ChainID) {
+	gs := t.gst.Get()
+	if gs == nil {
+		return
+	}
+	chainName := chain.String()
+	byGuardian := t.heights[chain]
+	heights := make([]int64, 0, len(byGuardian))
+	for name, h := range byGuardian {
+		if _, ok := gs.KeyIndex(h.addr); !ok {
+			// The guardian left the set, its height no longer counts towards the quorum.
+			delete(byGuardian, name)
+			guardianChainHeightLag.DeleteLabelValues(name, chainName)
+			continue
+		}
+		heights = append(heights, h.height)
+	}
+	quorum := vaa.CalculateQuorum(len(gs.Keys))
+	if quorum == 0 || len(heights) < quorum {
+		// Without a quorum of heartbeats there is no quorum height yet.
+		return
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+	quorumHeight := heights[quorum-1]
+
+	for name, h := range byGuardian {
+		lag := quorumHeight - h.height
+		if lag < 0 {
+			lag = 0
+		}
+		guardianChainHeightLag.WithLabelValues(name, chainName).Set(float64(lag))
+	}
+}
+
+// runAges refreshes the heartbeat age gauges until the context is cancelled.
+func (t *heightTracker) runAges(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.mu.Lock()
+			for name, last := range t.lastHeartbeat {
+				heartbeatAge.WithLabelValues(name).Set(now.Sub(last).Seconds())
+			}
+			t.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+// heightLags returns the height lag gauges of a chain, by guardian name.
+func heightLags(t *testing.T, chain vaa.ChainID) map[string]float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 100)
+	guardianChainHeightLag.Collect(ch)
+	close(ch)
+	lags := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["chain_name"] == chain.String() {
+			lags[labels["guardian_name"]] = pb.GetGauge().GetValue()
+		}
+	}
+	return lags
+}
+
+func TestUpdateLag(t *testing.T) {
+	keys := make([]eth_common.Address, 5)
+	for i := range keys {
+		keys[i] = eth_common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	type step struct {
+		// set, if not nil, replaces the guardian set with the keys at these indexes before the heartbeat.
+		set      []int
+		guardian int
+		height   int64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  map[string]float64
+	}{
+		{
+			name:  "fewer heartbeats than a quorum",
+			steps: []step{{set: []int{0, 1, 2, 3}, guardian: 0, height: 100}, {guardian: 1, height: 90}},
+			want:  map[string]float64{},
+		},
+		{
+			name: "lag behind the quorum height",
+			steps: []step{
+				{set: []int{0, 1, 2, 3}, guardian: 0, height: 100},
+				{guardian: 1, height: 90},
+				{guardian: 2, height: 95},
+				{guardian: 3, height: 80},
+			},
+			// The third highest height is reached by a quorum of three guardians, those ahead of it have no lag.
+			want: map[string]float64{"g0": 0, "g1": 0, "g2": 0, "g3": 10},
+		},
+		{
+			name: "rotated set",
+			steps: []step{
+				{set: []int{0, 1, 2, 3}, guardian: 0, height: 100},
+				{guardian: 1, height: 90},
+				{guardian: 2, height: 95},
+				{guardian: 3, height: 10},
+				{set: []int{0, 1, 2, 4}, guardian: 4, height: 50},
+			},
+			// The guardian that left no longer counts, and no longer has a lag.
+			want: map[string]float64{"g0": 0, "g1": 0, "g2": 0, "g4": 40},
+		},
+		{
+			name: "larger set",
+			steps: []step{
+				{set: []int{0, 1, 2, 3, 4}, guardian: 0, height: 100},
+				{guardian: 1, height: 90},
+				{guardian: 2, height: 95},
+				{guardian: 3, height: 80},
+			},
+			// A quorum of five guardians is four, so every guardian that reported is at or above the quorum height.
+			want: map[string]float64{"g0": 0, "g1": 0, "g2": 0, "g3": 0},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each case uses its own chain, so that the gauges of the other cases don't get in the way.
+			chain := vaa.ChainID(1000 + i)
+			gst := node_common.NewGuardianSetState(nil)
+			tracker := newHeightTracker(gst)
+			for _, s := range tt.steps {
+				if s.set != nil {
+					setKeys := make([]eth_common.Address, len(s.set))
+					for j, k := range s.set {
+						setKeys[j] = keys[k]
+					}
+					gst.Set(&node_common.GuardianSet{Keys: setKeys})
+				}
+				tracker.heartbeat(fmt.Sprintf("g%d", s.guardian), &gossipv1.Heartbeat{
+					GuardianAddr: keys[s.guardian].Hex(),
+					Networks:     []*gossipv1.Heartbeat_Network{{Id: uint32(chain), Height: s.height}},
+				}, time.Now())
+			}
+			got := heightLags(t, chain)
+			if len(got) != len(tt.want) {
+				t.Fatalf("lags = %v, want %v", got, tt.want)
+			}
+			for name, lag := range tt.want {
+				if l, ok := got[name]; !ok || l != lag {
+					t.Errorf("lags = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestLastObservationSignedAt(t *testing.T) {
+	g := eth_common.HexToAddress("0x58CC3AE5C097b213cE3c81979e1B9f9570746AA5")
+	gst := node_common.NewGuardianSetState(nil)
+	gst.Set(&node_common.GuardianSet{Keys: []eth_common.Address{g}})
+	tracker := newHeightTracker(gst)
+	signedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker.heartbeat("last-observation", &gossipv1.Heartbeat{
+		GuardianAddr: g.Hex(),
+		Networks: []*gossipv1.Heartbeat_Network{
+			{Id: uint32(vaa.ChainIDSolana), LastObservationSignedAt: signedAt.UnixNano()},
+			// Guardians report 0 for the chains they have not signed anything on.
+			{Id: uint32(vaa.ChainIDEthereum)},
+		},
+	}, time.Now())
+	if got := gaugeValue(t, guardianChainLastObservation.WithLabelValues("last-observation", vaa.ChainIDSolana.String())); got != float64(signedAt.Unix()) {
+		t.Errorf("last observation on solana = %v, want %v", got, signedAt.Unix())
+	}
+	if guardianChainLastObservation.DeleteLabelValues("last-observation", vaa.ChainIDEthereum.String()) {
+		t.Error("last observation exported for a chain without observations")
+	}
+}
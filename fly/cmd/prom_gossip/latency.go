@@ -0,0 +1,175 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+)
+
+// latencyBuckets go from 10ms to about 160s.
+var latencyBuckets = prometheus.ExponentialBuckets(0.01, 2, 15)
+
+var (
+	timeToQuorum = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gossip_time_to_quorum_seconds",
+		Help:    "Time from the first observation of a message to the arrival of its quorum VAA, by chain",
+		Buckets: latencyBuckets,
+	}, []string{"chain_name"})
+	observationDelay = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gossip_observation_delay_seconds",
+		Help:    "Time from the first observation of a message by any guardian to the observation by this guardian, by chain",
+		Buckets: latencyBuckets,
+	}, []string{"guardian_name", "chain_name"})
+	observationsAfterQuorum = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_observations_after_quorum_total",
+		Help: "The number of observations received after the quorum VAA of the message, by guardian",
+	}, []string{"guardian_name"})
+	vaasWithoutObservations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_vaas_without_observations_total",
+		Help: "The number of quorum VAAs received without any observation of the message being received first, by chain",
+	}, []string{"chain_name"})
+	latencyMessagesEvicted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gossip_latency_messages_evicted_total",
+		Help: "The number of messages forgotten before their ttl because the latency tracker was full",
+	})
+)
+
+type pendingMessage struct {
+	id               string
+	firstObservation time.Time
+	quorumAt         time.Time
+	observed         map[string]bool
+}
+
+// latencyTracker follows every message ID from its first observation to its quorum VAA.
+// Messages are forgotten after ttl, so late observations are only attributed within that window. Once it follows
+// maxSize messages, a new message evicts the oldest one.
+// All times are receive times of the envelopes, so replays are measured on the recorded clock.
+type latencyTracker struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	// order holds the messages from the first seen to the last, so both kinds of eviction start at the front.
+	order    *list.List
+	messages map[string]*list.Element
+	// latest is the latest receive time seen, which the cleanup measures the ttl against.
+	latest time.Time
+}
+
+// newLatencyTracker creates a tracker. A maxSize of 0 or less means it is only bounded by ttl.
+func newLatencyTracker(ttl time.Duration, maxSize int) *latencyTracker {
+	return &latencyTracker{ttl: ttl, maxSize: maxSize, order: list.New(), messages: map[string]*list.Element{}}
+}
+
+// observation records an observation of msgID by a known guardian.
+func (t *latencyTracker) observation(name string, chain vaa.ChainID, msgID string, receivedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seen(receivedAt)
+	m := t.get(msgID)
+	if m == nil {
+		m = t.add(&pendingMessage{id: msgID, firstObservation: receivedAt, observed: map[string]bool{}})
+	}
+	if m.observed[name] {
+		// Guardians re-broadcast observations until quorum is reached. Only the first one counts.
+		return
+	}
+	m.observed[name] = true
+	observationDelay.WithLabelValues(name, chain.String()).Observe(receivedAt.Sub(m.firstObservation).Seconds())
+	if !m.quorumAt.IsZero() {
+		observationsAfterQuorum.WithLabelValues(name).Inc()
+	}
+}
+
+// quorum records the arrival of the first quorum VAA for msgID.
+func (t *latencyTracker) quorum(msgID string, chain vaa.ChainID, receivedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seen(receivedAt)
+	m := t.get(msgID)
+	if m == nil {
+		vaasWithoutObservations.WithLabelValues(chain.String()).Inc()
+		// Remember the message so late observations are still counted.
+		t.add(&pendingMessage{id: msgID, firstObservation: receivedAt, quorumAt: receivedAt, observed: map[string]bool{}})
+		return
+	}
+	if !m.quorumAt.IsZero() {
+		return
+	}
+	m.quorumAt = receivedAt
+	timeToQuorum.WithLabelValues(chain.String()).Observe(receivedAt.Sub(m.firstObservation).Seconds())
+}
+
+// get must be called with t.mu held.
+func (t *latencyTracker) get(msgID string) *pendingMessage {
+	if el, ok := t.messages[msgID]; ok {
+		return el.Value.(*pendingMessage)
+	}
+	return nil
+}
+
+// add must be called with t.mu held.
+func (t *latencyTracker) add(m *pendingMessage) *pendingMessage {
+	if t.maxSize > 0 && t.order.Len() >= t.maxSize {
+		t.removeFront()
+		latencyMessagesEvicted.Inc()
+	}
+	t.messages[m.id] = t.order.PushBack(m)
+	return m
+}
+
+// removeFront must be called with t.mu held.
+func (t *latencyTracker) removeFront() {
+	el := t.order.Front()
+	if el == nil {
+		return
+	}
+	t.order.Remove(el)
+	delete(t.messages, el.Value.(*pendingMessage).id)
+}
+
+// evict forgets the messages first seen more than ttl before the latest message. Messages are added in the order
+// they are received, so it stops at the first one that is still fresh.
+func (t *latencyTracker) evict() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for el := t.order.Front(); el != nil && t.latest.Sub(el.Value.(*pendingMessage).firstObservation) > t.ttl; el = t.order.Front() {
+		t.removeFront()
+	}
+}
+
+// len returns the number of messages followed.
+func (t *latencyTracker) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.order.Len()
+}
+
+func (t *latencyTracker) seen(receivedAt time.Time) {
+	if receivedAt.After(t.latest) {
+		t.latest = receivedAt
+	}
+}
+
+// runCleanup periodically forgets messages first seen more than ttl before the latest message.
+func (t *latencyTracker) runCleanup(ctx context.Context, logger *zap.Logger) {
+	ticker := time.NewTicker(t.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := t.len()
+			t.evict()
+			after := t.len()
+			logger.Info("Cleaned up message latency cache", zap.Int("beforeCount", before), zap.Int("afterCount", after))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+func TestLatencyTrackerBounds(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newLatencyTracker(time.Hour, 2)
+	evicted := counterValue(t, latencyMessagesEvicted)
+	chain := vaa.ChainIDPythNet
+	withoutObservations := counterValue(t, vaasWithoutObservations.WithLabelValues(chain.String()))
+
+	tracker.observation("guardian-0", chain, "26/a/1", at)
+	tracker.observation("guardian-0", chain, "26/a/2", at.Add(time.Second))
+	// Observations of a message already followed don't take more room.
+	tracker.observation("guardian-1", chain, "26/a/2", at.Add(2*time.Second))
+	if got := tracker.len(); got != 2 {
+		t.Fatalf("len = %d, want 2", got)
+	}
+	tracker.observation("guardian-0", chain, "26/a/3", at.Add(3*time.Second))
+	if got := tracker.len(); got != 2 {
+		t.Errorf("len = %d, want 2 once full", got)
+	}
+	if got := counterValue(t, latencyMessagesEvicted) - evicted; got != 1 {
+		t.Errorf("evictions = %v, want 1", got)
+	}
+	// The oldest message was evicted, so its VAA is as good as unobserved. It is followed again, in place of the
+	// next oldest message.
+	tracker.quorum("26/a/1", chain, at.Add(4*time.Second))
+	if got := counterValue(t, vaasWithoutObservations.WithLabelValues(chain.String())) - withoutObservations; got != 1 {
+		t.Errorf("VAAs without observations = %v, want 1", got)
+	}
+
+	// The ttl is measured against the latest receive time, from the oldest message on.
+	tracker.observation("guardian-0", chain, "26/a/4", at.Add(time.Hour+4*time.Second+time.Millisecond))
+	tracker.evict()
+	if got := tracker.len(); got != 1 {
+		t.Errorf("len after eviction = %d, want 1", got)
+	}
+	if tracker.get("26/a/4") == nil {
+		t.Error("the latest message was evicted")
+	}
+}
@@ -1,11 +1,10 @@
-// TODO: this currently leverages `p2p.Run` for gathering messages,
-// but this abtracts away some critical metrics that would be advantageous to track, for example
+// By default this leverages `p2p.Run` for gathering messages, which abstracts away some critical metrics, for example
 // - getting raw counts for heartbeats (only guardian heartbeats are counted)
-// - getting the sender's p2p key for VAAs (these are not currently attributed)
-// - attributing messages to p2p key instead of guardian address (the guardian address field is currently unverified)
-// - mapping p2p key to guardian address (is is possible for the same guardian key to have multiple p2p keys, such as testnet)
-// manually connecting to the gossip network here would allow for the flexibility to do the above
-// at cost of the added complexity of verifying guardian heartbeats to determine their legitimate p2p key(s)
+// - getting the sender's p2p key for VAAs (these are not attributed)
+// - attributing messages to p2p key instead of guardian address (the guardian address field is unverified)
+// - mapping p2p key to guardian address (it is possible for the same guardian key to have multiple p2p keys, such as testnet)
+// With --raw, the gossip topics are joined directly instead, guardian heartbeats are verified to learn their
+// legitimate p2p key(s), and every message is counted by the peer that published it (see raw.go).
 
 package main
 
@@ -25,11 +24,14 @@ import (
 	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
 	"github.com/certusone/wormhole/node/pkg/supervisor"
 	ipfslog "github.com/ipfs/go-log/v2"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/wormhole-foundation/wormhole-monitor/fly/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/ttlset"
 	"github.com/wormhole-foundation/wormhole-monitor/fly/utils"
 	"github.com/wormhole-foundation/wormhole/sdk"
 	"github.com/wormhole-foundation/wormhole/sdk/vaa"
@@ -38,14 +40,21 @@ import (
 )
 
 var (
-	envStr       = flag.String("env", "mainnet", `environment (may be "mainnet", "testnet" or "devnet", required)`)
-	logLevel     = flag.String("logLevel", "warn", "Logging level (debug, info, warn, error, dpanic, panic, fatal)")
-	p2pNetworkID = flag.String("network", "", "P2P network identifier (optional, overrides default, required for devnet)")
-	p2pPort      = flag.Uint("port", 8999, "P2P UDP listener port")
-	p2pBootstrap = flag.String("bootstrap", "", "P2P bootstrap peers (optional, overrides default)")
-	nodeKeyPath  = flag.String("nodeKey", "/tmp/node.key", "Path to node key (will be generated if it doesn't exist)")
-	ethRPC       = flag.String("ethRPC", "", "Ethereum RPC for fetching current guardian set (default is based on env)")
-	ethContract  = flag.String("ethContract", "", "Ethereum core bridge address for fetching current guardian set (default is based on env)")
+	envStr         = flag.String("env", "mainnet", `environment (may be "mainnet", "testnet" or "devnet", required)`)
+	logLevel       = flag.String("logLevel", "warn", "Logging level (debug, info, warn, error, dpanic, panic, fatal)")
+	p2pNetworkID   = flag.String("network", "", "P2P network identifier (optional, overrides default, required for devnet)")
+	p2pPort        = flag.Uint("port", 8999, "P2P UDP listener port")
+	p2pBootstrap   = flag.String("bootstrap", "", "P2P bootstrap peers (optional, overrides default)")
+	nodeKeyPath    = flag.String("nodeKey", "/tmp/node.key", "Path to node key (will be generated if it doesn't exist)")
+	ethRPC         = flag.String("ethRPC", "", "Ethereum RPC for fetching current guardian set (default is based on env)")
+	ethContract    = flag.String("ethContract", "", "Ethereum core bridge address for fetching current guardian set (default is based on env)")
+	replayFiles    = flag.String("replay", "", "Comma separated recordings (or glob patterns) to replay instead of connecting to the gossip network")
+	replaySpeed    = flag.Float64("replaySpeed", 1, "Replay speed multiplier (0 replays as fast as possible)")
+	raw            = flag.Bool("raw", false, "Join the gossip topics directly instead of using p2p.Run, and attribute every message to the peer ID that published it")
+	dedupTTL       = flag.Duration("dedupTTL", time.Hour, "How long observation hashes and VAA digests are remembered to count unique messages")
+	dedupMaxSize   = flag.Int("dedupMaxSize", 1_000_000, "Maximum number of observation hashes, and of VAA digests, remembered (0 for no limit)")
+	latencyMaxSize = flag.Int("latencyMaxSize", 1_000_000, "Maximum number of messages followed from their first observation to their quorum VAA (0 for no limit)")
+	traceDir       = flag.String("traceDir", "", "Write the pubsub mesh and delivery events to rotating hourly files in this directory (raw mode only, see cmd/summarize_trace)")
 )
 
 var (
@@ -90,11 +99,11 @@ var (
 	}, []string{"chain_name"})
 	uniqueVAAsCounter = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "gossip_vaas_unique_total",
-		Help: "The unique number of vaas received over gossip",
+		Help: "The unique number of verified vaas received over gossip",
 	})
 	uniqueVAAsByGuardianPerChain = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "gossip_vaas_by_guardian_per_chain_total",
-		Help: "The number of unique VAAs received over gossip, grouped by guardian and chain",
+		Help: "Deprecated: the number of unique VAAs received over gossip, credited only to their lowest-index signer, by chain. Use gossip_vaa_signatures_by_guardian_per_chain_total instead",
 	}, []string{"guardian_name", "chain_name"})
 	heartbeatsByGuardian = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "gossip_heartbeats_by_guardian_total",
@@ -102,15 +111,17 @@ var (
 	}, []string{"guardian_name"})
 	govConfigByGuardian = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "gossip_gov_config_by_guardian_total",
-		Help: "The number of heartbeats received over gossip by guardian",
+		Help: "The number of governor configs received over gossip by guardian",
 	}, []string{"guardian_name"})
 	govStatusByGuardian = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "gossip_gov_status_by_guardian_total",
-		Help: "The number of heartbeats received over gossip by guardian",
+		Help: "The number of governor statuses received over gossip by guardian",
 	}, []string{"guardian_name"})
 )
 
 func main() {
+	var metricsConfig metrics.Config
+	metricsConfig.RegisterFlags(flag.CommandLine, ":2112")
 	flag.Parse()
 
 	// Set up the logger.
@@ -197,8 +208,8 @@ func main() {
 	// Inbound observation requests
 	obsvReqC := make(chan *gossipv1.ObservationRequest, 20000)
 
-	// Inbound signed VAAs
-	signedInC := make(chan *gossipv1.SignedVAAWithQuorum, 20000)
+	// Inbound signed VAAs, with the time they were received so quorum and observation latencies use the same clock
+	signedInC := make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedVAAWithQuorum], 20000)
 
 	// Heartbeat updates
 	heartbeatC := make(chan *gossipv1.Heartbeat, 20000)
@@ -212,7 +223,8 @@ func main() {
 	// Governor status
 	govStatusC := make(chan *gossipv1.SignedChainGovernorStatus, 20000)
 	// Bootstrap guardian set, otherwise heartbeats would be skipped
-	idx, sgs, err := utils.FetchCurrentGuardianSet(rpcUrl, coreBridgeAddr)
+	// Replays have to work offline, so they use the known guardians for the environment instead of querying the chain.
+	idx, sgs, err := utils.GuardianSet(env, *replayFiles != "", rpcUrl, coreBridgeAddr)
 	if err != nil {
 		logger.Fatal("Failed to fetch guardian set", zap.Error(err))
 	}
@@ -228,30 +240,180 @@ func main() {
 		return
 	}
 
+	builds := consume(rootCtx, logger, gst, inputs{
+		batchObsvC: batchObsvC,
+		obsvReqC:   obsvReqC,
+		signedInC:  signedInC,
+		heartbeatC: heartbeatC,
+		govConfigC: govConfigC,
+		govStatusC: govStatusC,
+	})
+
+	if err := metrics.Start(rootCtx, logger, metricsConfig, "prom_gossip", map[string]http.Handler{"/rollout": builds}); err != nil {
+		logger.Fatal("Failed to start metrics", zap.Error(err))
+	}
+
+	// In raw mode, and when replaying, messages are read straight from pubsub and routed to the same channels
+	// p2p.Run would deliver them to.
+	sinks := &gossip.Sinks{
+		Logger:          logger,
+		Gst:             gst,
+		ObsvBatchC:      batchObsvC,
+		ObsvReqC:        obsvReqC,
+		TimedSignedVAAC: signedInC,
+		GovConfigC:      govConfigC,
+		GovStatusC:      govStatusC,
+	}
+	handle := sinks.Dispatch
+	if *raw {
+		monitor := newRawMonitor(rootCtx, logger, gst)
+		handle = func(ctx context.Context, e *gossip.Envelope) {
+			monitor.handle(ctx, e)
+			sinks.Dispatch(ctx, e)
+		}
+	}
+
+	if *replayFiles != "" {
+		files, err := gossip.ExpandRecordings(*replayFiles)
+		if err != nil {
+			logger.Fatal("Invalid --replay", zap.Error(err))
+		}
+		go func() {
+			if err := gossip.Replay(rootCtx, logger, files, *replaySpeed, handle); err != nil && rootCtx.Err() == nil {
+				logger.Error("Replay failed", zap.Error(err))
+			}
+			logger.Info("Replay finished")
+		}()
+	} else {
+		// Load p2p private key
+		var priv crypto.PrivKey
+		priv, err = node_common.GetOrCreateNodeKey(logger, *nodeKeyPath)
+		if err != nil {
+			logger.Fatal("Failed to load node key", zap.Error(err))
+		}
+
+		if *raw {
+			tracer, err := gossip.NewBandwidthTracer(prometheus.DefaultRegisterer)
+			if err != nil {
+				logger.Fatal("Failed to register gossipsub tracer metrics", zap.Error(err))
+			}
+			listenerConfig := gossip.ListenerConfig{
+				NetworkID:     *p2pNetworkID,
+				Bootstrap:     *p2pBootstrap,
+				Port:          *p2pPort,
+				Priv:          priv,
+				PubsubOptions: []pubsub.Option{pubsub.WithRawTracer(tracer)},
+			}
+			if *traceDir != "" {
+				listenerConfig.Trace = &gossip.TraceConfig{Dir: *traceDir, Prefix: "prom-gossip-", MaxAge: time.Hour, Compress: true}
+			}
+			listener, err := gossip.NewListener(rootCtx, logger, listenerConfig)
+			if err != nil {
+				logger.Fatal("Failed to start gossip listener", zap.Error(err))
+			}
+			if err := gossip.RegisterResourceCollector(prometheus.DefaultRegisterer, listener.Host()); err != nil {
+				logger.Fatal("Failed to register resource manager metrics", zap.Error(err))
+			}
+			go func() {
+				listener.Run(rootCtx, handle)
+				listener.Close()
+			}()
+			<-rootCtx.Done()
+			logger.Info("root context cancelled, exiting...")
+			return
+		}
+
+		// p2p.Run delivers VAAs without a timestamp, so stamp them when they are handed over, like it does for observations.
+		p2pSignedInC := make(chan *gossipv1.SignedVAAWithQuorum, 20000)
+		go func() {
+			for {
+				select {
+				case <-rootCtx.Done():
+					return
+				case m := <-p2pSignedInC:
+					select {
+					case signedInC <- &node_common.MsgWithTimeStamp[gossipv1.SignedVAAWithQuorum]{Msg: m, Timestamp: time.Now()}:
+					case <-rootCtx.Done():
+						return
+					}
+				}
+			}
+		}()
+
+		// Run supervisor.
+		components := p2p.DefaultComponents()
+		components.Port = *p2pPort
+
+		params, err := p2p.NewRunParams(
+			*p2pBootstrap,
+			*p2pNetworkID,
+			priv,
+			gst,
+			rootCtxCancel,
+			p2p.WithComponents(components),
+			p2p.WithSignedObservationBatchListener(batchObsvC),
+			p2p.WithSignedVAAListener(p2pSignedInC),
+			p2p.WithObservationRequestListener(obsvReqC),
+			p2p.WithChainGovernorConfigListener(govConfigC),
+			p2p.WithChainGovernorStatusListener(govStatusC),
+		)
+		if err != nil {
+			logger.Fatal("Failed to create RunParams", zap.Error(err))
+		}
+
+		supervisor.New(rootCtx, logger, func(ctx context.Context) error {
+			if err := supervisor.Run(ctx,
+				"p2p",
+				p2p.Run(params)); err != nil {
+				return err
+			}
+
+			logger.Info("Started internal services")
+
+			<-ctx.Done()
+			return nil
+		},
+			// It's safer to crash and restart the process in case we encounter a panic,
+			// rather than attempting to reschedule the runnable.
+			supervisor.WithPropagatePanic)
+	}
+
+	<-rootCtx.Done()
+	logger.Info("root context cancelled, exiting...")
+}
+
+// inputs are the channels p2p.Run, or the gossip sinks, deliver the messages to.
+type inputs struct {
+	batchObsvC <-chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]
+	obsvReqC   <-chan *gossipv1.ObservationRequest
+	signedInC  <-chan *node_common.MsgWithTimeStamp[gossipv1.SignedVAAWithQuorum]
+	heartbeatC <-chan *gossipv1.Heartbeat
+	govConfigC <-chan *gossipv1.SignedChainGovernorConfig
+	govStatusC <-chan *gossipv1.SignedChainGovernorStatus
+}
+
+// consume exports the metrics of the messages delivered to in until the context is cancelled.
+// The returned tracker serves the rollout page.
+func consume(ctx context.Context, logger *zap.Logger, gst *node_common.GuardianSetState, in inputs) *buildInfoTracker {
+	heights := newHeightTracker(gst)
+	go heights.runAges(ctx, 5*time.Second)
+	builds := newBuildInfoTracker()
+	latency := newLatencyTracker(30*time.Minute, *latencyMaxSize)
+	go latency.runCleanup(ctx, logger)
+
+	// The dedup sets are evicted in the background so the message handlers never block on a cleanup.
+	uniqueObs := ttlset.New("unique_observations", *dedupTTL, *dedupMaxSize)
+	go uniqueObs.Run(ctx, time.Minute)
+	uniqueVAAs := ttlset.New("unique_vaas", *dedupTTL, *dedupMaxSize)
+	go uniqueVAAs.Run(ctx, time.Minute)
+
 	// Count observations
 	go func() {
-		// TODO: move this to a function / struct with a mutex so that the cleanup can be run independently from the message handling, so as to not back up the channel
-		uniqueObs := make(map[string]time.Time)
-		timeout := time.Hour
-		delay := time.Minute * 10
-		timer := time.NewTimer(delay)
-		defer timer.Stop()
 		for {
 			select {
-			case <-rootCtx.Done():
+			case <-ctx.Done():
 				return
-			case <-timer.C:
-				beforeCount := len(uniqueObs)
-				now := time.Now()
-				for hash, t := range uniqueObs {
-					if now.After(t.Add(timeout)) {
-						delete(uniqueObs, hash)
-					}
-				}
-				afterCount := len(uniqueObs)
-				logger.Info("Cleaned up unique observations cache", zap.Int("beforeCount", beforeCount), zap.Int("afterCount", afterCount), zap.Int("cleanedUpCount", beforeCount-afterCount))
-				timer.Reset(delay)
-			case batch := <-batchObsvC:
+			case batch := <-in.batchObsvC:
 				gossipByType.WithLabelValues("batch_observation").Inc()
 				addr := "0x" + string(hex.EncodeToString(batch.Msg.Addr))
 				name := addr
@@ -267,14 +429,15 @@ func main() {
 					}
 					emitter := strings.ToLower(spl[1])
 					observationsByGuardianPerChain.WithLabelValues(name, chain.String()).Inc()
+					if found {
+						latency.observation(name, chain, o.MessageId, batch.Timestamp)
+					}
 					if knownEmitters[emitter] {
 						tbObservationsByGuardianPerChain.WithLabelValues(name, chain.String()).Inc()
 					}
-					hash := hex.EncodeToString(o.Hash)
-					if _, exists := uniqueObs[hash]; !exists {
+					if uniqueObs.Add(hex.EncodeToString(o.Hash)) {
 						uniqueObservationsCounter.Inc()
 					}
-					uniqueObs[hash] = time.Now()
 				}
 			}
 		}
@@ -284,9 +447,9 @@ func main() {
 	go func() {
 		for {
 			select {
-			case <-rootCtx.Done():
+			case <-ctx.Done():
 				return
-			case or := <-obsvReqC:
+			case or := <-in.obsvReqC:
 				// There is no guardian address in the observation request
 				gossipByType.WithLabelValues("observation_request").Inc()
 				chain := vaa.ChainID(or.ChainId)
@@ -297,54 +460,46 @@ func main() {
 
 	// Count signed VAAs
 	go func() {
-		uniqueVAAs := make(map[string]time.Time)
-		timeout := time.Hour
-		delay := time.Minute * 10
-		timer := time.NewTimer(delay)
 		for {
 			select {
-			case <-rootCtx.Done():
+			case <-ctx.Done():
 				return
-			case <-timer.C:
-				beforeCount := len(uniqueVAAs)
-				now := time.Now()
-				for hash, t := range uniqueVAAs {
-					if now.After(t.Add(timeout)) {
-						delete(uniqueVAAs, hash)
-					}
-				}
-				afterCount := len(uniqueVAAs)
-				logger.Info("Cleaned up unique VAAs cache", zap.Int("beforeCount", beforeCount), zap.Int("afterCount", afterCount), zap.Int("cleanedUpCount", beforeCount-afterCount))
-				timer.Reset(delay)
-			case m := <-signedInC:
+			case signed := <-in.signedInC:
+				m := signed.Msg
 				gossipByType.WithLabelValues("vaa").Inc()
 				v, err := vaa.Unmarshal(m.Vaa)
 				if err != nil {
+					invalidVAAs.WithLabelValues("unmarshal").Inc()
 					logger.Warn("received invalid VAA in SignedVAAWithQuorum message", zap.Error(err), zap.Any("message", m))
 					continue
 				}
 
 				digest := v.HexDigest()
-				chain := v.EmitterChain.String() // Extract chain name
+				if uniqueVAAs.Contains(digest) {
+					uniqueVAAs.Add(digest)
+					continue
+				}
+
+				gs := gst.Get()
+				if reason, err := verifyVAA(v, gs); err != nil {
+					invalidVAAs.WithLabelValues(reason).Inc()
+					logger.Debug("received VAA that failed verification", zap.String("digest", digest), zap.Error(err))
+					continue
+				}
+				uniqueVAAs.Add(digest)
+				uniqueVAAsCounter.Inc()
+				attributeVAA(v, gs)
+				latency.quorum(v.MessageID(), v.EmitterChain, signed.Timestamp)
 
-				// Extract guardian name using signature index
+				// Deprecated: only credits the lowest-index signer, kept for existing dashboards.
 				guardianName := "unknown"
 				for _, sig := range v.Signatures {
-					guardianIndex := int(sig.Index) // Extract the guardian index
-					if name, found := guardianIndexToNameMap[guardianIndex]; found {
+					if name, found := guardianIndexToNameMap[int(sig.Index)]; found {
 						guardianName = name
-						break // Take the first matched guardian
+						break
 					}
 				}
-
-				if _, exists := uniqueVAAs[digest]; !exists {
-					// Increment the original gossip_vaas_unique_total metric
-					uniqueVAAsCounter.Inc()
-
-					// Increment the new metric with guardian and chain labels
-					uniqueVAAsByGuardianPerChain.WithLabelValues(guardianName, chain).Inc()
-				}
-				uniqueVAAs[digest] = time.Now()
+				uniqueVAAsByGuardianPerChain.WithLabelValues(guardianName, v.EmitterChain.String()).Inc()
 			}
 		}
 	}()
@@ -353,24 +508,32 @@ func main() {
 	go func() {
 		for {
 			select {
-			case <-rootCtx.Done():
+			case <-ctx.Done():
 				return
-			case hb := <-heartbeatC:
+			case hb := <-in.heartbeatC:
 				gossipByType.WithLabelValues("heartbeat").Inc()
-				idx := guardianIndexMap[strings.ToLower(hb.GuardianAddr)]
-				name := guardianIndexToNameMap[idx]
+				name := hb.GuardianAddr
+				idx, found := guardianIndexMap[strings.ToLower(hb.GuardianAddr)]
+				if found {
+					name = guardianIndexToNameMap[idx]
+				}
 				heartbeatsByGuardian.WithLabelValues(name).Inc()
+				heights.heartbeat(name, hb, time.Now())
+				builds.heartbeat(name, hb)
 			}
 		}
 	}()
 
+	// Only the govStatus goroutine below touches the tracker's state. Configs just set gauges.
+	governor := newGovernorTracker()
+
 	// Count govConfigs
 	go func() {
 		for {
 			select {
-			case <-rootCtx.Done():
+			case <-ctx.Done():
 				return
-			case g := <-govConfigC:
+			case g := <-in.govConfigC:
 				gossipByType.WithLabelValues("gov_config").Inc()
 				addr := "0x" + string(hex.EncodeToString(g.GuardianAddr))
 				name := addr
@@ -379,6 +542,11 @@ func main() {
 					name = guardianIndexToNameMap[idx]
 				}
 				govConfigByGuardian.WithLabelValues(name).Inc()
+				if found {
+					if err := governor.config(name, g); err != nil {
+						logger.Warn("received invalid governor config", zap.String("guardian", name), zap.Error(err))
+					}
+				}
 			}
 		}
 	}()
@@ -387,9 +555,9 @@ func main() {
 	go func() {
 		for {
 			select {
-			case <-rootCtx.Done():
+			case <-ctx.Done():
 				return
-			case g := <-govStatusC:
+			case g := <-in.govStatusC:
 				gossipByType.WithLabelValues("gov_status").Inc()
 				addr := "0x" + string(hex.EncodeToString(g.GuardianAddr))
 				name := addr
@@ -398,62 +566,16 @@ func main() {
 					name = guardianIndexToNameMap[idx]
 				}
 				govStatusByGuardian.WithLabelValues(name).Inc()
+				if found {
+					if err := governor.status(name, g); err != nil {
+						logger.Warn("received invalid governor status", zap.String("guardian", name), zap.Error(err))
+					}
+				}
 			}
 		}
 	}()
 
-	// Start prometheus server
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":2112", nil)
-	}()
-
-	// Load p2p private key
-	var priv crypto.PrivKey
-	priv, err = node_common.GetOrCreateNodeKey(logger, *nodeKeyPath)
-	if err != nil {
-		logger.Fatal("Failed to load node key", zap.Error(err))
-	}
-
-	// Run supervisor.
-	components := p2p.DefaultComponents()
-	components.Port = *p2pPort
-
-	params, err := p2p.NewRunParams(
-		*p2pBootstrap,
-		*p2pNetworkID,
-		priv,
-		gst,
-		rootCtxCancel,
-		p2p.WithComponents(components),
-		p2p.WithSignedObservationBatchListener(batchObsvC),
-		p2p.WithSignedVAAListener(signedInC),
-		p2p.WithObservationRequestListener(obsvReqC),
-		p2p.WithChainGovernorConfigListener(govConfigC),
-		p2p.WithChainGovernorStatusListener(govStatusC),
-	)
-	if err != nil {
-		logger.Fatal("Failed to create RunParams", zap.Error(err))
-	}
-
-	supervisor.New(rootCtx, logger, func(ctx context.Context) error {
-		if err := supervisor.Run(ctx,
-			"p2p",
-			p2p.Run(params)); err != nil {
-			return err
-		}
-
-		logger.Info("Started internal services")
-
-		<-ctx.Done()
-		return nil
-	},
-		// It's safer to crash and restart the process in case we encounter a panic,
-		// rather than attempting to reschedule the runnable.
-		supervisor.WithPropagatePanic)
-
-	<-rootCtx.Done()
-	logger.Info("root context cancelled, exiting...")
+	return builds
 }
 
 // parseChainID parses a human-readable chain name or a chain ID.
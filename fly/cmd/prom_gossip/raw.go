@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/ttlset"
+	"go.uber.org/zap"
+)
+
+// Attributions of a peer ID, from the heartbeats it has published.
+const (
+	// attributionGuardian peers published a valid heartbeat signed by a member of the guardian set.
+	attributionGuardian = "guardian"
+	// attributionNonGuardian peers published a valid heartbeat signed by a key outside the guardian set.
+	attributionNonGuardian = "non_guardian"
+	// attributionUnattributed peers haven't published a valid heartbeat.
+	attributionUnattributed = "unattributed"
+)
+
+var (
+	rawMessagesBySender = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_raw_messages_by_sender_total",
+		Help: "The number of gossip messages received, by sender: the guardian name if attributed to a guardian, the attribution otherwise, topic and type (raw mode only)",
+	}, []string{"sender", "topic", "type"})
+	rawMessagesByAttribution = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_raw_messages_by_attribution_total",
+		Help: "The number of gossip messages received, by whether their publisher is a guardian, a non-guardian or unattributed, topic and type (raw mode only)",
+	}, []string{"attribution", "topic", "type"})
+	peerGuardian = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_peer_guardian",
+		Help: "Always 1, mapping the peer IDs of guardians to the guardian whose verified heartbeats they published (raw mode only)",
+	}, []string{"peer_id", "guardian_name"})
+	guardianPeerCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gossip_guardian_peer_ids",
+		Help: "The number of distinct peer IDs that published verified heartbeats for each guardian (raw mode only)",
+	}, []string{"guardian_name"})
+	rawBytesBySender = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_raw_bytes_by_sender_total",
+		Help: "Bytes of gossip message payloads received, by sender: the guardian name if attributed to a guardian, the attribution otherwise, topic and type (raw mode only)",
+	}, []string{"sender", "topic", "type"})
+	rawMessageSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "gossip_raw_message_size_bytes",
+		Help: "The size of gossip message payloads, by topic, type and sender: the guardian name if attributed to a guardian, the attribution otherwise (raw mode only)",
+		// 64B to 1MiB, the default pubsub message size limit.
+		Buckets: prometheus.ExponentialBuckets(64, 2, 15),
+	}, []string{"topic", "type", "sender"})
+	rawInvalidHeartbeats = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gossip_raw_invalid_heartbeats_total",
+		Help: "The number of heartbeats that failed verification (raw mode only)",
+	})
+)
+
+// Anyone can publish heartbeats signed by a fresh key from a fresh peer ID, so non-guardian peers are only
+// remembered for a while, and up to a bound.
+const (
+	nonGuardianPeersTTL     = time.Hour
+	nonGuardianPeersMaxSize = 10000
+)
+
+// rawMonitor attributes every message to the peer that published it. Heartbeats are verified to learn which
+// guardian each peer belongs to, since the guardian address in the other messages is not authenticated,
+// and the same guardian key may be used by several peers. Metrics are labelled by guardian name or attribution,
+// and peer IDs are only exported for guardians, so the number of series doesn't grow with the peers of the network.
+type rawMonitor struct {
+	logger       *zap.Logger
+	gst          *node_common.GuardianSetState
+	nonGuardians *ttlset.Set
+
+	mu sync.Mutex
+	// guardians maps the peer IDs of guardians to the guardian name.
+	guardians   map[peer.ID]string
+	peersByName map[string]map[peer.ID]bool
+}
+
+// newRawMonitor creates a monitor that forgets non-guardian peers in the background until the context is cancelled.
+func newRawMonitor(ctx context.Context, logger *zap.Logger, gst *node_common.GuardianSetState) *rawMonitor {
+	r := &rawMonitor{
+		logger:       logger,
+		gst:          gst,
+		nonGuardians: ttlset.New("raw_non_guardian_peers", nonGuardianPeersTTL, nonGuardianPeersMaxSize),
+		guardians:    map[peer.ID]string{},
+		peersByName:  map[string]map[peer.ID]bool{},
+	}
+	go r.nonGuardians.Run(ctx, time.Minute)
+	return r
+}
+
+// handle is a gossip.Handler. It may be called concurrently.
+func (r *rawMonitor) handle(_ context.Context, e *gossip.Envelope) {
+	topic, msgType := e.TopicName(), e.MessageType()
+	if shb, ok := e.Msg.GetMessage().(*gossipv1.GossipMessage_SignedHeartbeat); ok {
+		r.heartbeat(e.From, shb.SignedHeartbeat)
+	}
+
+	r.mu.Lock()
+	name, isGuardian := r.guardians[e.From]
+	r.mu.Unlock()
+	attribution, sender := attributionUnattributed, attributionUnattributed
+	switch {
+	case isGuardian:
+		attribution, sender = attributionGuardian, name
+	case r.nonGuardians.Contains(string(e.From)):
+		attribution, sender = attributionNonGuardian, attributionNonGuardian
+	}
+	size := float64(len(e.Data))
+	rawMessagesBySender.WithLabelValues(sender, topic, msgType).Inc()
+	rawBytesBySender.WithLabelValues(sender, topic, msgType).Add(size)
+	rawMessagesByAttribution.WithLabelValues(attribution, topic, msgType).Inc()
+	rawMessageSize.WithLabelValues(topic, msgType, sender).Observe(size)
+}
+
+func (r *rawMonitor) heartbeat(from peer.ID, s *gossipv1.SignedHeartbeat) {
+	// Verify the signature first, and only then check the signer against the guardian set,
+	// so that peers run by other keys are told apart from peers sending garbage.
+	hb, err := gossip.VerifyHeartbeat(s, nil, from)
+	if err != nil {
+		rawInvalidHeartbeats.Inc()
+		r.logger.Debug("invalid heartbeat", zap.String("from", from.String()), zap.Error(err))
+		return
+	}
+	addr := eth_common.HexToAddress(hb.GuardianAddr)
+	name, isGuardian := "", false
+	if gs := r.gst.Get(); gs != nil {
+		if _, isGuardian = gs.KeyIndex(addr); isGuardian {
+			name = guardianNameByAddr(addr.Hex())
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, known := r.guardians[from]
+	if known && isGuardian && prev == name {
+		return
+	}
+	if known {
+		// The peer started publishing heartbeats for another key.
+		peerGuardian.DeleteLabelValues(from.String(), prev)
+		delete(r.peersByName[prev], from)
+		guardianPeerCount.WithLabelValues(prev).Set(float64(len(r.peersByName[prev])))
+		delete(r.guardians, from)
+	}
+	if !isGuardian {
+		if r.nonGuardians.Add(string(from)) {
+			r.logger.Debug("learned non-guardian peer", zap.String("peer_id", from.String()), zap.String("addr", addr.Hex()))
+		}
+		return
+	}
+	r.guardians[from] = name
+	if r.peersByName[name] == nil {
+		r.peersByName[name] = map[peer.ID]bool{}
+	}
+	r.peersByName[name][from] = true
+	peerGuardian.WithLabelValues(from.String(), name).Set(1)
+	guardianPeerCount.WithLabelValues(name).Set(float64(len(r.peersByName[name])))
+	r.logger.Info("learned guardian peer", zap.String("peer_id", from.String()), zap.String("name", name))
+}
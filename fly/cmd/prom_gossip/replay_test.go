@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := g.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func histogramSum(t *testing.T, o prometheus.Observer) float64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := o.(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleSum()
+}
+
+// waitFor polls cond until it holds, for the consumers that run in the background.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// setGuardians sets up the guardian globals the way main does, until the test ends.
+func setGuardians(t *testing.T, keys []eth_common.Address) {
+	prevNum, prevIndex, prevNames := numGuardians, guardianIndexMap, guardianIndexToNameMap
+	t.Cleanup(func() { numGuardians, guardianIndexMap, guardianIndexToNameMap = prevNum, prevIndex, prevNames })
+	numGuardians, guardianIndexMap, guardianIndexToNameMap = len(keys), map[string]int{}, map[int]string{}
+	for i, k := range keys {
+		guardianIndexMap[strings.ToLower(k.Hex())] = i
+		guardianIndexToNameMap[i] = fmt.Sprintf("guardian-%d", i)
+	}
+}
+
+// TestReplayRaw replays a recording the way main does with --replay --raw, and checks the exported metrics.
+func TestReplayRaw(t *testing.T) {
+	g0, g1, outsider := gossiptest.NewGuardian(t), gossiptest.NewGuardian(t), gossiptest.NewGuardian(t)
+	keys := []eth_common.Address{g0.Addr, g1.Addr}
+	setGuardians(t, keys)
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := &vaa.VAA{
+		Version:          vaa.SupportedVAAVersion,
+		Timestamp:        at,
+		Sequence:         1,
+		EmitterChain:     vaa.ChainIDEthereum,
+		EmitterAddress:   vaa.Address{31: 1},
+		ConsistencyLevel: 1,
+		Payload:          []byte("test"),
+	}
+	v.AddSignature(g0.Key, 0)
+	v.AddSignature(g1.Key, 1)
+	signedVAA, err := v.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := v.SigningDigest().Bytes()
+	governorConfig, err := proto.Marshal(&gossipv1.ChainGovernorConfig{
+		NodeName: "node-0",
+		Chains:   []*gossipv1.ChainGovernorConfig_Chain{{ChainId: uint32(vaa.ChainIDEthereum), NotionalLimit: 1000000, BigTransactionSize: 50000}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	governorStatus, err := proto.Marshal(&gossipv1.ChainGovernorStatus{
+		NodeName: "node-0",
+		Chains: []*gossipv1.ChainGovernorStatus_Chain{{
+			ChainId:                    uint32(vaa.ChainIDEthereum),
+			RemainingAvailableNotional: 750000,
+			Emitters: []*gossipv1.ChainGovernorStatus_Emitter{{
+				EmitterAddress:    "0000000000000000000000000000000000000000000000000000000000000001",
+				TotalEnqueuedVaas: 2,
+				EnqueuedVaas: []*gossipv1.ChainGovernorStatus_EnqueuedVAA{
+					{Sequence: 1, NotionalValue: 30000},
+					{Sequence: 2, NotionalValue: 20000},
+				},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := gossiptest.WriteRecording(t,
+		gossiptest.Envelope(t, g0.Peer, "control", at, g0.Heartbeat(t, &gossipv1.Heartbeat{
+			NodeName: "node-0", Counter: 1, Timestamp: at.UnixNano(), BootTimestamp: at.Add(-time.Hour).UnixNano(), Version: "v2.24.0",
+			Features: []string{"ccq", "governor"},
+		})),
+		// Verified, but not in the guardian set.
+		gossiptest.Envelope(t, outsider.Peer, "control", at, outsider.Heartbeat(t, &gossipv1.Heartbeat{NodeName: "outsider", Counter: 1})),
+		gossiptest.Envelope(t, g0.Peer, "attestation", at.Add(time.Second), g0.ObservationBatch(g0.Observation(t, v.MessageID(), hash))),
+		gossiptest.Envelope(t, g1.Peer, "attestation", at.Add(2*time.Second), g1.ObservationBatch(g1.Observation(t, v.MessageID(), hash))),
+		gossiptest.Envelope(t, g1.Peer, "vaa", at.Add(3*time.Second), &gossipv1.GossipMessage{
+			Message: &gossipv1.GossipMessage_SignedVaaWithQuorum{SignedVaaWithQuorum: &gossipv1.SignedVAAWithQuorum{Vaa: signedVAA}},
+		}),
+		gossiptest.Envelope(t, g0.Peer, "control", at.Add(4*time.Second), &gossipv1.GossipMessage{
+			Message: &gossipv1.GossipMessage_SignedChainGovernorConfig{SignedChainGovernorConfig: &gossipv1.SignedChainGovernorConfig{
+				Config: governorConfig, GuardianAddr: g0.Addr.Bytes(),
+			}},
+		}),
+		// Governor messages of guardians outside the set are only counted.
+		gossiptest.Envelope(t, outsider.Peer, "control", at.Add(4*time.Second), &gossipv1.GossipMessage{
+			Message: &gossipv1.GossipMessage_SignedChainGovernorStatus{SignedChainGovernorStatus: &gossipv1.SignedChainGovernorStatus{
+				Status: governorStatus, GuardianAddr: outsider.Addr.Bytes(),
+			}},
+		}),
+		gossiptest.Envelope(t, g0.Peer, "control", at.Add(5*time.Second), &gossipv1.GossipMessage{
+			Message: &gossipv1.GossipMessage_SignedChainGovernorStatus{SignedChainGovernorStatus: &gossipv1.SignedChainGovernorStatus{
+				Status: governorStatus, GuardianAddr: g0.Addr.Bytes(),
+			}},
+		}),
+	)
+
+	batchObsvC := make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch], 10)
+	obsvReqC := make(chan *gossipv1.ObservationRequest, 10)
+	signedInC := make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedVAAWithQuorum], 10)
+	heartbeatC := make(chan *gossipv1.Heartbeat, 10)
+	govConfigC := make(chan *gossipv1.SignedChainGovernorConfig, 10)
+	govStatusC := make(chan *gossipv1.SignedChainGovernorStatus, 10)
+	gst := node_common.NewGuardianSetState(heartbeatC)
+	gst.Set(&node_common.GuardianSet{Keys: keys})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	builds := consume(ctx, zap.NewNop(), gst, inputs{
+		batchObsvC: batchObsvC,
+		obsvReqC:   obsvReqC,
+		signedInC:  signedInC,
+		heartbeatC: heartbeatC,
+		govConfigC: govConfigC,
+		govStatusC: govStatusC,
+	})
+	sinks := &gossip.Sinks{
+		Logger:          zap.NewNop(),
+		Gst:             gst,
+		ObsvBatchC:      batchObsvC,
+		ObsvReqC:        obsvReqC,
+		TimedSignedVAAC: signedInC,
+		GovConfigC:      govConfigC,
+		GovStatusC:      govStatusC,
+	}
+	monitor := newRawMonitor(ctx, zap.NewNop(), gst)
+	handle := func(ctx context.Context, e *gossip.Envelope) {
+		monitor.handle(ctx, e)
+		sinks.Dispatch(ctx, e)
+	}
+	// Observations and VAAs are consumed by different goroutines, so a VAA replayed right after the observations
+	// could be handled first. Keep the recorded order with 50ms between the messages a second apart.
+	if err := gossip.Replay(ctx, zap.NewNop(), []string{path}, 20, handle); err != nil {
+		t.Fatal(err)
+	}
+
+	// The consumers run in the background, wait for the last metric of the last message to be counted, so that the
+	// VAA handler is done reading the guardian globals before the cleanup restores them.
+	chain := vaa.ChainIDEthereum.String()
+	for deadline := time.Now().Add(5 * time.Second); counterValue(t, uniqueVAAsByGuardianPerChain.WithLabelValues("guardian-0", chain)) < 1 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, c := range []struct {
+		name string
+		c    prometheus.Counter
+		want float64
+	}{
+		{"heartbeats of guardian 0", heartbeatsByGuardian.WithLabelValues("guardian-0"), 1},
+		{"heartbeats of the outsider", heartbeatsByGuardian.WithLabelValues(outsider.Addr.Hex()), 0},
+		{"observations of guardian 0", observationsByGuardianPerChain.WithLabelValues("guardian-0", chain), 1},
+		{"observations of guardian 1", observationsByGuardianPerChain.WithLabelValues("guardian-1", chain), 1},
+		{"unique VAAs", uniqueVAAsCounter, 1},
+		{"VAA signatures of guardian 1", vaaSignaturesByGuardianPerChain.WithLabelValues("guardian-1", chain), 1},
+		{"VAAs without observations", vaasWithoutObservations.WithLabelValues(chain), 0},
+		{"guardian heartbeats", rawMessagesByAttribution.WithLabelValues(attributionGuardian, "control", "heartbeat"), 1},
+		{"non-guardian heartbeats", rawMessagesByAttribution.WithLabelValues(attributionNonGuardian, "control", "heartbeat"), 1},
+		{"unattributed observations", rawMessagesByAttribution.WithLabelValues(attributionUnattributed, "attestation", "observation_batch"), 1},
+		{"heartbeats sent by guardian 0", rawMessagesBySender.WithLabelValues("guardian-0", "control", "heartbeat"), 1},
+		{"heartbeats sent by non-guardians", rawMessagesBySender.WithLabelValues(attributionNonGuardian, "control", "heartbeat"), 1},
+		{"observations sent by unattributed peers", rawMessagesBySender.WithLabelValues(attributionUnattributed, "attestation", "observation_batch"), 1},
+	} {
+		if got := counterValue(t, c.c); got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// Peer IDs are only exported for guardians.
+	if got := gaugeValue(t, peerGuardian.WithLabelValues(g0.Peer.String(), "guardian-0")); got != 1 {
+		t.Errorf("peer of guardian 0 = %v, want 1", got)
+	}
+	if peerGuardian.DeleteLabelValues(outsider.Peer.String(), outsider.Addr.Hex()) {
+		t.Errorf("the peer ID of the outsider is exported")
+	}
+
+	// Latencies are measured on the recorded receive times, not on the time of the replay.
+	for _, h := range []struct {
+		name string
+		o    prometheus.Observer
+		want float64
+	}{
+		{"time to quorum", timeToQuorum.WithLabelValues(chain), 2},
+		{"observation delay of guardian 1", observationDelay.WithLabelValues("guardian-1", chain), 1},
+	} {
+		if got := histogramSum(t, h.o); got != h.want {
+			t.Errorf("%s = %vs, want %vs", h.name, got, h.want)
+		}
+	}
+
+	// The boot timestamp is the last gauge set for a heartbeat.
+	boot := guardianBootTimestamp.WithLabelValues("guardian-0")
+	waitFor(t, "the build info of guardian 0", func() bool { return gaugeValue(t, boot) != 0 })
+	if got, want := gaugeValue(t, boot), float64(at.Add(-time.Hour).Unix()); got != want {
+		t.Errorf("boot timestamp of guardian 0 = %v, want %v", got, want)
+	}
+	if got := gaugeValue(t, guardianBuildInfo.WithLabelValues("guardian-0", "v2.24.0")); got != 1 {
+		t.Errorf("build info of guardian 0 = %v, want 1", got)
+	}
+	for _, f := range []string{"ccq", "governor"} {
+		if got := gaugeValue(t, guardianFeature.WithLabelValues("guardian-0", f)); got != 1 {
+			t.Errorf("feature %s of guardian 0 = %v, want 1", f, got)
+		}
+	}
+	if guardianBuildInfo.DeleteLabelValues(outsider.Addr.Hex(), "") {
+		t.Error("build info exported for the outsider")
+	}
+	r := builds.report()
+	if len(r.Versions) != 1 || r.Versions[0].Version != "v2.24.0" || len(r.Versions[0].Guardians) != 1 || r.Versions[0].Guardians[0] != "guardian-0" {
+		t.Errorf("rollout versions = %+v, want guardian-0 on v2.24.0", r.Versions)
+	}
+	if len(r.NotSeen) != 1 || r.NotSeen[0] != "guardian-1" {
+		t.Errorf("guardians not seen = %v, want guardian-1", r.NotSeen)
+	}
+
+	// The enqueued VAAs and the big transaction size are the last gauges set for a status and a config.
+	waitFor(t, "the governor status of guardian 0", func() bool {
+		return gaugeValue(t, governorEnqueuedVAAs.WithLabelValues("guardian-0", chain)) != 0
+	})
+	waitFor(t, "the governor config of guardian 0", func() bool {
+		return gaugeValue(t, governorBigTransactionSize.WithLabelValues("guardian-0", chain)) != 0
+	})
+	emitter := "0000000000000000000000000000000000000000000000000000000000000001"
+	for _, g := range []struct {
+		name string
+		g    prometheus.Gauge
+		want float64
+	}{
+		{"notional limit", governorNotionalLimit.WithLabelValues("guardian-0", chain), 1000000},
+		{"big transaction size", governorBigTransactionSize.WithLabelValues("guardian-0", chain), 50000},
+		{"available notional", governorAvailableNotional.WithLabelValues("guardian-0", chain), 750000},
+		{"enqueued VAAs", governorEnqueuedVAAs.WithLabelValues("guardian-0", chain), 2},
+		{"enqueued notional", governorEnqueuedNotional.WithLabelValues("guardian-0", chain, emitter), 50000},
+	} {
+		if got := gaugeValue(t, g.g); got != g.want {
+			t.Errorf("%s of guardian 0 = %v, want %v", g.name, got, g.want)
+		}
+	}
+	outsiderName := "0x" + hex.EncodeToString(outsider.Addr.Bytes())
+	if got := counterValue(t, govStatusByGuardian.WithLabelValues(outsiderName)); got != 1 {
+		t.Errorf("governor statuses of the outsider = %v, want 1", got)
+	}
+	if governorAvailableNotional.DeleteLabelValues(outsiderName, chain) {
+		t.Error("governor status exported for the outsider")
+	}
+}
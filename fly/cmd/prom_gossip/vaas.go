@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+var (
+	invalidVAAs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_vaas_invalid_total",
+		Help: "The number of VAAs received over gossip that could not be verified, by reason",
+	}, []string{"reason"})
+	vaaSignaturesByGuardianPerChain = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_vaa_signatures_by_guardian_per_chain_total",
+		Help: "The number of unique verified VAAs received over gossip that include a signature from the guardian, by chain",
+	}, []string{"guardian_name", "chain_name"})
+	vaaMissingSignaturesByGuardian = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gossip_vaa_missing_signatures_by_guardian_total",
+		Help: "The number of unique verified VAAs received over gossip that do not include a signature from the guardian",
+	}, []string{"guardian_name"})
+	vaaSignatureCount = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gossip_vaa_signature_count",
+		Help:    "The number of signatures in each unique verified VAA received over gossip",
+		Buckets: prometheus.LinearBuckets(1, 1, 19),
+	})
+)
+
+// verifyVAA checks that the VAA is signed by a quorum of the current guardian set.
+// The returned reason labels gossip_vaas_invalid_total.
+func verifyVAA(v *vaa.VAA, gs *node_common.GuardianSet) (reason string, err error) {
+	if gs == nil {
+		return "no_guardian_set", fmt.Errorf("no guardian set")
+	}
+	if v.GuardianSetIndex != gs.Index {
+		return "guardian_set_index", fmt.Errorf("VAA is signed by guardian set %d, the current one is %d", v.GuardianSetIndex, gs.Index)
+	}
+	if err := v.Verify(gs.Keys); err != nil {
+		return "signature", err
+	}
+	return "", nil
+}
+
+// attributeVAA credits every guardian that signed a verified VAA, and counts every one that didn't.
+func attributeVAA(v *vaa.VAA, gs *node_common.GuardianSet) {
+	chain := v.EmitterChain.String()
+	signed := make([]bool, len(gs.Keys))
+	for _, sig := range v.Signatures {
+		if int(sig.Index) < len(signed) {
+			signed[sig.Index] = true
+		}
+	}
+	vaaSignatureCount.Observe(float64(len(v.Signatures)))
+	for idx, key := range gs.Keys {
+		name := guardianNameByAddr(key.Hex())
+		if signed[idx] {
+			vaaSignaturesByGuardianPerChain.WithLabelValues(name, chain).Inc()
+		} else {
+			vaaMissingSignaturesByGuardian.WithLabelValues(name).Inc()
+		}
+	}
+}
+
+// guardianNameByAddr returns the name of a known guardian, or the address itself.
+func guardianNameByAddr(addr string) string {
+	if idx, found := guardianIndexMap[strings.ToLower(addr)]; found {
+		return guardianIndexToNameMap[idx]
+	}
+	return addr
+}
@@ -0,0 +1,149 @@
+// This program records every message received on the gossip network, along with its receive time and sender,
+// so it can later be replayed into the other fly tools with their --replay flag: fly, heartbeats, prom_gossip and track_race.
+// healthcheck and track_pyth can't replay. healthcheck judges whether a guardian is healthy right now, from live gossip
+// and its public API, and track_pyth appends to statistics kept across runs, which a replay would mix recorded data into.
+// With --trace, the pubsub mesh and delivery events are written next to the recordings, for cmd/summarize_trace.
+//
+// Run the program as follows:
+// $ go run main.go --env mainnet --out ./recordings --compress
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	"github.com/certusone/wormhole/node/pkg/p2p"
+	ipfslog "github.com/ipfs/go-log/v2"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"go.uber.org/zap"
+)
+
+var (
+	envStr        = flag.String("env", "mainnet", `environment (may be "mainnet", "testnet" or "devnet", required)`)
+	logLevel      = flag.String("logLevel", "warn", "Logging level (debug, info, warn, error, dpanic, panic, fatal)")
+	p2pNetworkID  = flag.String("network", "", "P2P network identifier (optional, overrides default, required for devnet)")
+	p2pPort       = flag.Uint("port", 8999, "P2P UDP listener port")
+	p2pBootstrap  = flag.String("bootstrap", "", "P2P bootstrap peers (optional, overrides default)")
+	nodeKeyPath   = flag.String("nodeKey", "/tmp/node.key", "Path to node key (will be generated if it doesn't exist)")
+	outDir        = flag.String("out", "recordings", "Directory the recordings are written to")
+	prefix        = flag.String("prefix", "gossip-", "File name prefix of the recordings")
+	maxSize       = flag.Int64("maxSize", 256<<20, "Rotate the recording after this many uncompressed bytes (0 to disable)")
+	maxAge        = flag.Duration("maxAge", time.Hour, "Rotate the recording after this long (0 to disable)")
+	compress      = flag.Bool("compress", true, "Gzip the recordings")
+	flushInterval = flag.Duration("flushInterval", 5*time.Second, "How often buffered records are flushed to disk")
+	duration      = flag.Duration("duration", 0, "Stop recording after this long (0 to record until interrupted)")
+	trace         = flag.Bool("trace", false, "Also write the pubsub mesh and delivery events next to the recordings, rotated the same way (see cmd/summarize_trace)")
+)
+
+func main() {
+	flag.Parse()
+
+	lvl, err := ipfslog.LevelFromString(*logLevel)
+	if err != nil {
+		fmt.Println("Invalid log level")
+		os.Exit(1)
+	}
+	logger := ipfslog.Logger("record-gossip").Desugar()
+	ipfslog.SetAllLoggers(lvl)
+
+	env, err := node_common.ParseEnvironment(*envStr)
+	if err != nil || (env != node_common.UnsafeDevNet && env != node_common.TestNet && env != node_common.MainNet) {
+		logger.Fatal("Invalid value for --env, should be devnet, testnet or mainnet", zap.String("val", *envStr))
+	}
+	if *p2pNetworkID == "" {
+		*p2pNetworkID = p2p.GetNetworkId(env)
+	}
+	if *p2pBootstrap == "" {
+		*p2pBootstrap, err = p2p.GetBootstrapPeers(env)
+		if err != nil {
+			logger.Fatal("failed to determine the bootstrap peers from the environment", zap.String("env", string(env)), zap.Error(err))
+		}
+	}
+
+	rootCtx, rootCtxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer rootCtxCancel()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		rootCtx, cancel = context.WithTimeout(rootCtx, *duration)
+		defer cancel()
+	}
+
+	priv, err := node_common.GetOrCreateNodeKey(logger, *nodeKeyPath)
+	if err != nil {
+		logger.Fatal("Failed to load node key", zap.Error(err))
+	}
+
+	recorder, err := gossip.NewRecorder(gossip.RecorderConfig{
+		Dir:      *outDir,
+		Prefix:   *prefix,
+		MaxBytes: *maxSize,
+		MaxAge:   *maxAge,
+		Compress: *compress,
+	})
+	if err != nil {
+		logger.Fatal("Failed to create recorder", zap.Error(err))
+	}
+
+	listenerConfig := gossip.ListenerConfig{
+		NetworkID: *p2pNetworkID,
+		Bootstrap: *p2pBootstrap,
+		Port:      *p2pPort,
+		Priv:      priv,
+	}
+	if *trace {
+		listenerConfig.Trace = &gossip.TraceConfig{
+			Dir:           *outDir,
+			Prefix:        *prefix,
+			MaxBytes:      *maxSize,
+			MaxAge:        *maxAge,
+			Compress:      *compress,
+			FlushInterval: *flushInterval,
+		}
+	}
+	listener, err := gossip.NewListener(rootCtx, logger, listenerConfig)
+	if err != nil {
+		logger.Fatal("Failed to start gossip listener", zap.Error(err))
+	}
+
+	// Periodically flush so that a killed recorder loses as little as possible.
+	go func() {
+		ticker := time.NewTicker(*flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case <-ticker.C:
+				if err := recorder.Flush(); err != nil {
+					logger.Error("Failed to flush recording", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	// The handler is called concurrently for the different topics.
+	var count atomic.Int64
+	logger.Info("Recording", zap.String("dir", *outDir))
+	listener.Run(rootCtx, func(ctx context.Context, e *gossip.Envelope) {
+		if err := recorder.Write(e); err != nil {
+			logger.Error("Failed to write record", zap.Error(err))
+			rootCtxCancel()
+			return
+		}
+		count.Add(1)
+	})
+
+	listener.Close()
+	if err := recorder.Close(); err != nil {
+		logger.Error("Failed to close recording", zap.Error(err))
+	}
+	logger.Info("Recording stopped", zap.Int64("records", count.Load()))
+}
@@ -0,0 +1,267 @@
+// This program summarizes the pubsub traces written by record_gossip --trace or prom_gossip --traceDir into
+// per-peer delivery statistics: how many messages each peer delivered to us first, how many duplicates and
+// rejected messages it sent, and how long it spent in our mesh.
+//
+// Run the program as follows:
+// $ go run main.go --trace '../record_gossip/recordings/*.trace.jsonl.gz'
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+)
+
+var (
+	traceFiles = flag.String("trace", "", "Comma separated trace files (or glob patterns) to summarize, in chronological order (required)")
+	output     = flag.String("output", "text", `Output format, "text" or "json"`)
+	sortBy     = flag.String("sort", "delivered", `Column the peers are sorted by, descending: "delivered", "duplicates", "rejected" or "mesh"`)
+	top        = flag.Int("top", 0, "Only show this many peers (0 for all)")
+)
+
+// peerStats are the statistics of a remote peer. Messages are attributed to the peer that forwarded them to us.
+type peerStats struct {
+	Peer string `json:"peer"`
+	// Delivered messages were first received from this peer.
+	Delivered  int `json:"delivered"`
+	Duplicates int `json:"duplicates"`
+	Rejected   int `json:"rejected"`
+	// Published messages were authored by this peer, whoever forwarded them.
+	Published int `json:"published"`
+	// FirstShare is the fraction of all delivered messages this peer delivered first.
+	FirstShare float64 `json:"first_share"`
+	// DuplicateRatio is the fraction of the messages received from this peer that were duplicates.
+	DuplicateRatio float64        `json:"duplicate_ratio"`
+	RejectReasons  map[string]int `json:"reject_reasons,omitempty"`
+	Grafts         int            `json:"grafts"`
+	Prunes         int            `json:"prunes"`
+	Throttled      int            `json:"throttled"`
+	// MeshTime sums the time spent in our mesh over every topic.
+	MeshTime    time.Duration `json:"mesh_time_ns"`
+	Connections int           `json:"connections"`
+
+	grafted map[string]time.Time
+}
+
+type summary struct {
+	From          time.Time      `json:"from"`
+	To            time.Time      `json:"to"`
+	Events        int            `json:"events"`
+	Delivered     int            `json:"delivered"`
+	Duplicates    int            `json:"duplicates"`
+	Rejected      int            `json:"rejected"`
+	RejectReasons map[string]int `json:"reject_reasons"`
+	Peers         []*peerStats   `json:"peers"`
+}
+
+func main() {
+	flag.Parse()
+	if *traceFiles == "" {
+		fmt.Fprintln(os.Stderr, "--trace is required")
+		os.Exit(1)
+	}
+	files, err := gossip.ExpandRecordings(*traceFiles)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	s, err := summarize(files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	less, ok := map[string]func(a, b *peerStats) bool{
+		"delivered":  func(a, b *peerStats) bool { return a.Delivered > b.Delivered },
+		"duplicates": func(a, b *peerStats) bool { return a.Duplicates > b.Duplicates },
+		"rejected":   func(a, b *peerStats) bool { return a.Rejected > b.Rejected },
+		"mesh":       func(a, b *peerStats) bool { return a.MeshTime > b.MeshTime },
+	}[*sortBy]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid --sort %q\n", *sortBy)
+		os.Exit(1)
+	}
+	sort.SliceStable(s.Peers, func(i, j int) bool { return less(s.Peers[i], s.Peers[j]) })
+	if *top > 0 && len(s.Peers) > *top {
+		s.Peers = s.Peers[:*top]
+	}
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "text":
+		printText(s)
+	default:
+		fmt.Fprintf(os.Stderr, "invalid --output %q\n", *output)
+		os.Exit(1)
+	}
+}
+
+func summarize(files []string) (*summary, error) {
+	s := &summary{RejectReasons: map[string]int{}}
+	peers := map[string]*peerStats{}
+	get := func(p string) *peerStats {
+		ps, ok := peers[p]
+		if !ok {
+			ps = &peerStats{Peer: p, RejectReasons: map[string]int{}, grafted: map[string]time.Time{}}
+			peers[p] = ps
+		}
+		return ps
+	}
+	// The trace doesn't record the peers leaving the mesh when the tracing node stops, so a new file that doesn't
+	// continue the previous one would leave them grafted. Mesh intervals are closed at the last event of each file.
+	closeMesh := func(at time.Time) {
+		for _, ps := range peers {
+			for topic, since := range ps.grafted {
+				ps.MeshTime += at.Sub(since)
+				delete(ps.grafted, topic)
+			}
+		}
+	}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		r, err := gossip.NewTraceReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var last time.Time
+		for {
+			ev, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// A tracer that was killed can leave a partial line at the end of the file.
+				if errors.Is(err, io.ErrUnexpectedEOF) {
+					fmt.Fprintf(os.Stderr, "%s: truncated, ignoring the last event\n", file)
+					break
+				}
+				r.Close()
+				f.Close()
+				return nil, fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			s.Events++
+			last = ev.Time
+			if s.From.IsZero() {
+				s.From = ev.Time
+			}
+			s.To = ev.Time
+
+			switch ev.Type {
+			case gossip.TraceAddPeer:
+				get(ev.Peer).Connections++
+			case gossip.TraceRemovePeer:
+				ps := get(ev.Peer)
+				for topic, since := range ps.grafted {
+					ps.MeshTime += ev.Time.Sub(since)
+					delete(ps.grafted, topic)
+				}
+			case gossip.TraceGraft:
+				ps := get(ev.Peer)
+				ps.Grafts++
+				if _, ok := ps.grafted[ev.Topic]; !ok {
+					ps.grafted[ev.Topic] = ev.Time
+				}
+			case gossip.TracePrune:
+				ps := get(ev.Peer)
+				ps.Prunes++
+				if since, ok := ps.grafted[ev.Topic]; ok {
+					ps.MeshTime += ev.Time.Sub(since)
+					delete(ps.grafted, ev.Topic)
+				}
+			case gossip.TraceDeliver:
+				s.Delivered++
+				get(ev.Peer).Delivered++
+				if ev.Author != "" {
+					get(ev.Author).Published++
+				}
+			case gossip.TraceDuplicate:
+				s.Duplicates++
+				get(ev.Peer).Duplicates++
+			case gossip.TraceReject:
+				s.Rejected++
+				s.RejectReasons[ev.Reason]++
+				ps := get(ev.Peer)
+				ps.Rejected++
+				ps.RejectReasons[ev.Reason]++
+			case gossip.TraceThrottle:
+				get(ev.Peer).Throttled++
+			}
+		}
+		r.Close()
+		f.Close()
+		closeMesh(last)
+	}
+
+	for _, ps := range peers {
+		if s.Delivered > 0 {
+			ps.FirstShare = float64(ps.Delivered) / float64(s.Delivered)
+		}
+		if received := ps.Delivered + ps.Duplicates + ps.Rejected; received > 0 {
+			ps.DuplicateRatio = float64(ps.Duplicates) / float64(received)
+		}
+		s.Peers = append(s.Peers, ps)
+	}
+	sort.Slice(s.Peers, func(i, j int) bool { return s.Peers[i].Peer < s.Peers[j].Peer })
+	return s, nil
+}
+
+func printText(s *summary) {
+	fmt.Printf("%s to %s (%s), %d events\n", s.From.UTC().Format(time.RFC3339), s.To.UTC().Format(time.RFC3339), s.To.Sub(s.From).Round(time.Second), s.Events)
+	fmt.Printf("%d delivered, %d duplicates, %d rejected\n", s.Delivered, s.Duplicates, s.Rejected)
+	for _, reason := range sortedKeys(s.RejectReasons) {
+		fmt.Printf("  rejected %q: %d\n", reason, s.RejectReasons[reason])
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "peer\tdelivered\tfirst %\tduplicates\tdup %\trejected\tpublished\tgrafts\tprunes\tmesh time\tconns\tthrottled\t")
+	for _, ps := range s.Peers {
+		fmt.Fprintf(w, "%s\t%d\t%.1f\t%d\t%.1f\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t\n",
+			ps.Peer, ps.Delivered, 100*ps.FirstShare, ps.Duplicates, 100*ps.DuplicateRatio, ps.Rejected,
+			ps.Published, ps.Grafts, ps.Prunes, ps.MeshTime.Round(time.Second), ps.Connections, ps.Throttled)
+	}
+	w.Flush()
+
+	for _, ps := range s.Peers {
+		if len(ps.RejectReasons) == 0 {
+			continue
+		}
+		reasons := make([]string, 0, len(ps.RejectReasons))
+		for _, reason := range sortedKeys(ps.RejectReasons) {
+			reasons = append(reasons, fmt.Sprintf("%s: %d", reason, ps.RejectReasons[reason]))
+		}
+		fmt.Printf("\n%s rejected: %s", ps.Peer, strings.Join(reasons, ", "))
+	}
+	fmt.Println()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"go.uber.org/zap"
+)
+
+// writeTrace writes a trace file with a gossip.Tracer, pausing between events so that they have distinct times,
+// and returns its path along with the events as read back.
+func writeTrace(t *testing.T, compress bool, events func(tr *gossip.Tracer)) (string, []*gossip.TraceEvent) {
+	t.Helper()
+	dir := t.TempDir()
+	tr, err := gossip.NewTracer(context.Background(), zap.NewNop(), gossip.TraceConfig{Dir: dir, Prefix: "test-", Compress: compress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events(tr)
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+gossip.TraceExt+"*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one trace, found %v (%v)", files, err)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gossip.NewTraceReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var read []*gossip.TraceEvent
+	for {
+		ev, err := r.Next()
+		if err != nil {
+			break
+		}
+		read = append(read, ev)
+	}
+	return files[0], read
+}
+
+func message(from, author peer.ID, id string) *pubsub.Message {
+	topic := "/wormhole/test/broadcast"
+	return &pubsub.Message{
+		Message:      &pb.Message{Data: []byte("data"), Topic: &topic, From: []byte(author)},
+		ID:           id,
+		ReceivedFrom: from,
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	p1, p2, p3 := gossiptest.NewPeerID(t), gossiptest.NewPeerID(t), gossiptest.NewPeerID(t)
+	const a, b = "/wormhole/test/attestation", "/wormhole/test/control"
+	pause := func() { time.Sleep(2 * time.Millisecond) }
+
+	file1, ev1 := writeTrace(t, true, func(tr *gossip.Tracer) {
+		tr.AddPeer(p1, "/meshsub/1.1.0")
+		pause()
+		tr.Graft(p1, a)
+		pause()
+		tr.Graft(p2, a)
+		pause()
+		// A repeated graft doesn't restart the interval.
+		tr.Graft(p1, a)
+		pause()
+		tr.Prune(p1, a)
+		pause()
+		tr.Graft(p1, b)
+		pause()
+		// Leaving the mesh of every topic.
+		tr.RemovePeer(p1)
+		pause()
+		tr.DeliverMessage(message(p2, p3, "m1"))
+		// p2 is still grafted when the file ends.
+	})
+	file2, ev2 := writeTrace(t, true, func(tr *gossip.Tracer) {
+		tr.Graft(p2, a)
+		pause()
+		tr.DuplicateMessage(message(p1, p3, "m1"))
+		pause()
+		tr.RejectMessage(message(p2, p2, "m2"), pubsub.RejectValidationFailed)
+	})
+	file3, ev3 := writeTrace(t, false, func(tr *gossip.Tracer) {
+		tr.Graft(p1, a)
+		pause()
+		tr.ThrottlePeer(p1)
+	})
+	if len(ev1) != 8 || len(ev2) != 3 || len(ev3) != 2 {
+		t.Fatalf("read back %d, %d and %d events, want 8, 3 and 2", len(ev1), len(ev2), len(ev3))
+	}
+	// A tracer that was killed leaves a partial line behind.
+	f, err := os.OpenFile(file3, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"time":"2024-01-01T00:00:00Z","type":"gra`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s, err := summarize([]string{file1, file2, file3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Events != 13 || !s.From.Equal(ev1[0].Time) || !s.To.Equal(ev3[1].Time) {
+		t.Errorf("events %d from %v to %v, want 13 from %v to %v", s.Events, s.From, s.To, ev1[0].Time, ev3[1].Time)
+	}
+	if s.Delivered != 1 || s.Duplicates != 1 || s.Rejected != 1 || s.RejectReasons[pubsub.RejectValidationFailed] != 1 {
+		t.Errorf("summary = %+v, want one delivered, duplicate and rejected message", s)
+	}
+
+	peers := map[string]*peerStats{}
+	for _, ps := range s.Peers {
+		peers[ps.Peer] = ps
+	}
+	want := map[peer.ID]peerStats{
+		p1: {
+			Connections: 1, Grafts: 4, Prunes: 1, Duplicates: 1, Throttled: 1, DuplicateRatio: 1,
+			// Pruned, removed with the peer, then closed at the last complete event of the truncated file.
+			MeshTime: ev1[4].Time.Sub(ev1[1].Time) + ev1[6].Time.Sub(ev1[5].Time) + ev3[1].Time.Sub(ev3[0].Time),
+		},
+		p2: {
+			Grafts: 2, Delivered: 1, Rejected: 1, FirstShare: 1,
+			// Closed at the end of each file.
+			MeshTime: ev1[7].Time.Sub(ev1[2].Time) + ev2[2].Time.Sub(ev2[0].Time),
+		},
+		// Only delivered messages count towards their author.
+		p3: {Published: 1},
+	}
+	for _, p := range []peer.ID{p1, p2, p3} {
+		got, ok := peers[p.String()]
+		if !ok {
+			t.Errorf("no statistics for %s", p)
+			continue
+		}
+		w := want[p]
+		if got.Connections != w.Connections || got.Grafts != w.Grafts || got.Prunes != w.Prunes || got.Delivered != w.Delivered ||
+			got.Duplicates != w.Duplicates || got.Rejected != w.Rejected || got.Published != w.Published || got.Throttled != w.Throttled ||
+			got.FirstShare != w.FirstShare || got.DuplicateRatio != w.DuplicateRatio {
+			t.Errorf("statistics of %s = %+v, want %+v", p, got, w)
+		}
+		if got.MeshTime != w.MeshTime {
+			t.Errorf("mesh time of %s = %v, want %v", p, got.MeshTime, w.MeshTime)
+		}
+	}
+	if len(s.Peers) != 3 {
+		t.Errorf("%d peers, want 3", len(s.Peers))
+	}
+}
+
+func TestSummarizeCorruptTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrupt"+gossip.TraceExt)
+	if err := os.WriteFile(path, []byte("{\"type\":\"graft\"}\nnot json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := summarize([]string{path}); err == nil {
+		t.Error("summarize of a corrupt trace succeeded")
+	}
+}
@@ -1,9 +1,12 @@
 // This program listens to the gossip network and monitors the receipt of Pythnet VAAs to see how the specified guardian performs relative to the others.
 // The guardian to be monitored in specified by setting ourGuardianIndex to the index of the guardian in the guardian set (See guardian set creation below.).
 //
+// The statistics are kept per version of the guardian in --statsFile, so that upgrades can be compared with --report.
+//
 // Run the program as follows:
-// $ export GOLOG_FILE=fly.log; rm -f fly.log; go run trackPyth.go
+// $ export GOLOG_FILE=fly.log; rm -f fly.log; go run .
 // $ tail -f fly.log | grep data
+// $ go run . --report
 
 package main
 
@@ -13,8 +16,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/certusone/wormhole/node/pkg/common"
@@ -26,6 +31,10 @@ import (
 	ipfslog "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/mr-tron/base58"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/ttlset"
 	"github.com/wormhole-foundation/wormhole-monitor/fly/utils"
 	"github.com/wormhole-foundation/wormhole/sdk/vaa"
 
@@ -40,8 +49,7 @@ type (
 		weWereFirst      bool
 	}
 
-	msgMapType       map[string]*msgEntry
-	signedVaaMapType map[string]time.Time
+	msgMapType map[string]*msgEntry
 )
 
 var (
@@ -58,22 +66,39 @@ var (
 
 	msgMapLock   sync.Mutex
 	msgMap       msgMapType
-	signedVaaMap signedVaaMapType
-
-	ourGuardianAddr    string
-	ourGuardianVersion string
-
-	// Note: If you add anything here, be sure to update handleHeartbeat.
-	weWon            uint64
-	weLost           uint64
-	weMissed         uint64
-	allPythnetVaas   uint64
-	noObservations   uint64
-	signedByUs       uint64
-	totalTimeSum     int64
-	totalTimeSamples int64
-	ourTimeSum       int64
-	ourTimeSamples   int64
+	signedVaaMap *ttlset.Set
+
+	ourGuardianAddr string
+
+	// stats holds the statistics of every version of our guardian, and current those of the version it runs now.
+	// Both are guarded by msgMapLock.
+	stats   *statsStore
+	current *versionPeriod
+
+	// timeToQuorumWindows and ourDelayWindows estimate the latency percentiles over recent sliding windows.
+	timeToQuorumWindows *latencyWindows
+	ourDelayWindows     *latencyWindows
+)
+
+var (
+	pythnetVAAs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "track_pyth_vaas_total",
+		Help: "The number of Pythnet VAAs, by outcome for the monitored guardian (won, lost, missed or no_observations)",
+	}, []string{"outcome"})
+	pythnetVAAsSignedByUs = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "track_pyth_vaas_signed_by_us_total",
+		Help: "The number of Pythnet VAAs that include a signature from the monitored guardian",
+	})
+	pythnetTimeToQuorum = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "track_pyth_time_to_quorum_seconds",
+		Help:    "Time from the first observation of a Pythnet message to its quorum VAA",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	pythnetOurDelay = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "track_pyth_our_delay_seconds",
+		Help:    "Time from the first observation of a Pythnet message to the observation of the monitored guardian, when it was not first",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
 )
 
 // ourGuardianIndex specifies the guardian index that we want to monitor.
@@ -107,7 +132,27 @@ func main() {
 	// Verify flags
 	rpcUrl := flag.String("rpcUrl", "https://rpc.ankr.com/eth", "RPC URL for fetching current guardian set")
 	coreBridgeAddr := flag.String("coreBridgeAddr", "0x98f3c9e6E3fAce36bAAd05FE09d375Ef1464288B", "Core bridge address for fetching guardian set")
+	statsFile := flag.String("statsFile", "track_pyth_stats.json", "File the statistics of every guardian version are kept in")
+	saveInterval := flag.Duration("saveInterval", time.Minute, "How often the statistics are saved")
+	report := flag.Bool("report", false, "Print a comparison of the versions in --statsFile and exit")
+	windowsFlag := flag.String("windows", "1m,10m,1h", "Comma separated sliding windows the latency percentiles are computed over")
+	var metricsConfig metrics.Config
+	metricsConfig.RegisterFlags(flag.CommandLine, "")
 	flag.Parse()
+
+	if *report {
+		s, err := loadStats(*statsFile)
+		if err != nil {
+			logger.Fatal("Failed to load stats", zap.Error(err))
+		}
+		for _, guardian := range s.guardians() {
+			fmt.Printf("\n%s\n", guardian)
+			if err := s.writeReport(os.Stdout, guardian, time.Now()); err != nil {
+				logger.Fatal("Failed to write report", zap.Error(err))
+			}
+		}
+		return
+	}
 	if *rpcUrl == "" {
 		logger.Fatal("rpcUrl must be specified")
 	}
@@ -122,9 +167,34 @@ func main() {
 	}
 
 	// Node's main lifecycle context.
-	rootCtx, rootCtxCancel = context.WithCancel(context.Background())
+	// Interrupting it saves the stats.
+	rootCtx, rootCtxCancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer rootCtxCancel()
 
+	if err := metrics.Start(rootCtx, logger, metricsConfig, "track_pyth", nil); err != nil {
+		logger.Fatal("Failed to start metrics", zap.Error(err))
+	}
+
+	widths, err := parseWindows(*windowsFlag)
+	if err != nil {
+		logger.Fatal("Invalid --windows", zap.Error(err))
+	}
+	timeToQuorumWindows = newLatencyWindows("time_to_quorum", widths)
+	ourDelayWindows = newLatencyWindows("our_delay", widths)
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case now := <-ticker.C:
+				timeToQuorumWindows.export(now)
+				ourDelayWindows.export(now)
+			}
+		}
+	}()
+
 	// Inbound observations
 	batchObsvC := make(chan *common.MsgWithTimeStamp[gossipv1.SignedObservationBatch], 1024)
 
@@ -150,9 +220,37 @@ func main() {
 	gst.Set(&gs)
 
 	msgMap = make(msgMapType)
-	signedVaaMap = make(signedVaaMapType)
+	signedVaaMap = ttlset.New("signed_vaas", 5*time.Minute, 100_000)
+	go signedVaaMap.Run(rootCtx, time.Minute)
 	ourGuardianAddr = gs.Keys[ourGuardianIndex].String()
 
+	stats, err = loadStats(*statsFile)
+	if err != nil {
+		logger.Fatal("Failed to load stats", zap.Error(err))
+	}
+	// The version is filled in by the first heartbeat.
+	current = stats.start(ourGuardianAddr, "", time.Now())
+	saveStats := func() {
+		msgMapLock.Lock()
+		defer msgMapLock.Unlock()
+		if err := stats.save(); err != nil {
+			logger.Error("Failed to save stats", zap.Error(err))
+		}
+	}
+	saveStats()
+	go func() {
+		ticker := time.NewTicker(*saveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case <-ticker.C:
+				saveStats()
+			}
+		}
+	}()
+
 	// Handle observations
 	go func() {
 		for {
@@ -193,21 +291,6 @@ func main() {
 		}
 	}()
 
-	// Clean up our VAA map.
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-
-	go func() {
-		for {
-			select {
-			case <-rootCtx.Done():
-				return
-			case <-ticker.C:
-				cleanUpMap(logger)
-			}
-		}
-	}()
-
 	// Load p2p private key
 	var priv crypto.PrivKey
 	priv, err = common.GetOrCreateNodeKey(logger, nodeKeyPath)
@@ -252,6 +335,10 @@ func main() {
 	<-rootCtx.Done()
 	logger.Info("root context cancelled, sleeping...")
 	time.Sleep(2 * time.Second)
+	msgMapLock.Lock()
+	current.End = time.Now()
+	msgMapLock.Unlock()
+	saveStats()
 	logger.Info("done sleeping, exiting")
 	// TODO: wait for things to shut down gracefully
 
@@ -286,15 +373,14 @@ func handleSignedVAAWithQuorum(logger *zap.Logger, gs common.GuardianSet, m *gos
 	msgMapLock.Lock()
 	defer msgMapLock.Unlock()
 
-	if _, exists := signedVaaMap[msgId]; exists {
+	if !signedVaaMap.Add(msgId) {
 		return
 	}
 
 	logger.Debug("received a pythnet signed vaa", zap.String("msgId", msgId), zap.Uint32("gsIdx", v.GuardianSetIndex), zap.Int("numSigs", len(v.Signatures)))
-	allPythnetVaas += 1
+	current.AllVaas += 1
 
 	now := time.Now()
-	signedVaaMap[msgId] = now
 
 	weSigned := false
 	for _, sig := range v.Signatures {
@@ -306,49 +392,48 @@ func handleSignedVAAWithQuorum(logger *zap.Logger, gs common.GuardianSet, m *gos
 
 	me, exists := msgMap[msgId]
 	if exists {
+		// Later observations are ignored once the VAA is in signedVaaMap, so the entry is no longer needed.
+		delete(msgMap, msgId)
 		totalTime := now.Sub(me.firstObservation)
-		totalTimeSum += totalTime.Microseconds()
-		totalTimeSamples += 1
+		current.TimeToQuorum.observe(totalTime)
+		pythnetTimeToQuorum.Observe(totalTime.Seconds())
+		timeToQuorumWindows.add(now, totalTime)
 
 		if weSigned {
-			signedByUs += 1
+			current.SignedByUs += 1
+			pythnetVAAsSignedByUs.Inc()
 		}
 
 		if me.seenByUs {
-			ourTimeSamples += 1
 			if !me.weWereFirst {
-				weLost += 1
+				current.Lost += 1
+				pythnetVAAs.WithLabelValues("lost").Inc()
 				ourTime := me.receivedByUs.Sub(me.firstObservation)
-				ourTimeSum += ourTime.Microseconds()
+				current.OurDelay.observe(ourTime)
+				pythnetOurDelay.Observe(ourTime.Seconds())
+				ourDelayWindows.add(now, ourTime)
 				logger.Debug("TIME, We lost", zap.String("msgId", msgId), zap.Stringer("ourTime", ourTime), zap.Stringer("totalTime", totalTime))
 			} else {
-				weWon += 1
+				current.Won += 1
+				pythnetVAAs.WithLabelValues("won").Inc()
 				logger.Debug("TIME, We won", zap.String("msgId", msgId), zap.Stringer("totalTime", totalTime))
 			}
 		} else {
-			weMissed += 1
+			current.Missed += 1
+			pythnetVAAs.WithLabelValues("missed").Inc()
 			logger.Debug("TIME, We didn't see it", zap.String("msgId", msgId), zap.Stringer("totalTime", totalTime))
 		}
 	} else {
-		noObservations += 1
+		current.NoObservations += 1
+		pythnetVAAs.WithLabelValues("no_observations").Inc()
 		logger.Debug("Received a signed VAA without any observations!", zap.String("msgId", msgId))
 	}
 
-	if allPythnetVaas%100 == 0 {
-		averageTimeMs := int64(0)
-		if totalTimeSamples > 0 {
-			averageTimeMs = totalTimeSum / totalTimeSamples
-		}
-
-		ourAverageMics := int64(0)
-		if ourTimeSamples > 0 {
-			ourAverageMics = ourTimeSum / ourTimeSamples
-		}
-
-		logger.Info("data", zap.Uint64("allPythnetVaas", allPythnetVaas), zap.Uint64("noObs", noObservations), zap.Uint64("signedByUs", signedByUs),
-			zap.Uint64("weWon", weWon), zap.Uint64("weLost", weLost), zap.Uint64("weMissed", weMissed),
-			zap.Int64("averageTimeMics", averageTimeMs), zap.Int64("ourAverageMics", ourAverageMics),
-			zap.String("version", ourGuardianVersion))
+	if current.AllVaas%100 == 0 {
+		logger.Info("data", zap.Uint64("allPythnetVaas", current.AllVaas), zap.Uint64("noObs", current.NoObservations), zap.Uint64("signedByUs", current.SignedByUs),
+			zap.Uint64("weWon", current.Won), zap.Uint64("weLost", current.Lost), zap.Uint64("weMissed", current.Missed),
+			timeToQuorumWindows.field(now), ourDelayWindows.field(now),
+			zap.String("version", current.Version))
 	}
 }
 
@@ -417,7 +502,7 @@ func handleObservation(logger *zap.Logger, gs common.GuardianSet, addr []byte, m
 	msgMapLock.Lock()
 	defer msgMapLock.Unlock()
 
-	if _, exists := signedVaaMap[m.MessageId]; exists {
+	if signedVaaMap.Contains(m.MessageId) {
 		return
 	}
 
@@ -442,37 +527,22 @@ func handleObservation(logger *zap.Logger, gs common.GuardianSet, addr []byte, m
 	}
 }
 
-func cleanUpMap(logger *zap.Logger) {
-	msgMapLock.Lock()
-	defer msgMapLock.Unlock()
-
-	for key, t := range signedVaaMap {
-		if time.Since(t) > 5*time.Minute {
-			delete(signedVaaMap, key)
-		}
-	}
-}
-
 func handleHeartbeat(logger *zap.Logger, m *gossipv1.Heartbeat) {
 	msgMapLock.Lock()
 	defer msgMapLock.Unlock()
 
-	if ourGuardianVersion != m.GetVersion() {
-		if ourGuardianVersion != "" {
-			logger.Info("Guardian version has changed, resetting all counts", zap.String("oldVersion", ourGuardianVersion), zap.String("newVersion", m.GetVersion()))
-
-			weWon = 0
-			weLost = 0
-			weMissed = 0
-			allPythnetVaas = 0
-			noObservations = 0
-			signedByUs = 0
-			totalTimeSum = 0
-			totalTimeSamples = 0
-			ourTimeSum = 0
-			ourTimeSamples = 0
-		}
-
-		ourGuardianVersion = m.GetVersion()
+	version := m.GetVersion()
+	if current.Version == version {
+		return
+	}
+	if current.Version == "" {
+		// The first heartbeat since we started, the VAAs counted so far belong to this version too.
+		current.Version = version
+		return
+	}
+	logger.Info("Guardian version has changed, starting a new stats period", zap.String("oldVersion", current.Version), zap.String("newVersion", version))
+	current = stats.start(ourGuardianAddr, version, time.Now())
+	if err := stats.save(); err != nil {
+		logger.Error("Failed to save stats", zap.Error(err))
 	}
 }
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/sketch"
+)
+
+// latencySketch is a persisted sketch of a latency, to estimate percentiles across restarts.
+type latencySketch struct {
+	*sketch.Sketch
+}
+
+func newLatencySketch() *latencySketch {
+	return &latencySketch{sketch.New(sketchAccuracy)}
+}
+
+func (l *latencySketch) UnmarshalJSON(b []byte) error {
+	l.Sketch = &sketch.Sketch{}
+	return json.Unmarshal(b, l.Sketch)
+}
+
+func (l *latencySketch) observe(d time.Duration) {
+	l.Add(d.Seconds())
+}
+
+func (l *latencySketch) merge(o *latencySketch) error {
+	if o.Accuracy() != l.Accuracy() {
+		return fmt.Errorf("sketch accuracy %v differs from %v", o.Accuracy(), l.Accuracy())
+	}
+	l.Merge(o.Sketch)
+	return nil
+}
+
+func (l *latencySketch) mean() time.Duration {
+	return time.Duration(l.Mean() * float64(time.Second))
+}
+
+func (l *latencySketch) quantile(q float64) time.Duration {
+	return time.Duration(l.Quantile(q) * float64(time.Second))
+}
+
+// versionPeriod holds the statistics of the monitored guardian while it ran one version, from Start until End.
+// A period is also ended by restarting track_pyth, so a version may span several periods.
+type versionPeriod struct {
+	Guardian string    `json:"guardian"`
+	Version  string    `json:"version"`
+	Start    time.Time `json:"start"`
+	// End is zero for the current period.
+	End time.Time `json:"end"`
+
+	AllVaas        uint64 `json:"all_vaas"`
+	NoObservations uint64 `json:"no_observations"`
+	SignedByUs     uint64 `json:"signed_by_us"`
+	Won            uint64 `json:"won"`
+	Lost           uint64 `json:"lost"`
+	Missed         uint64 `json:"missed"`
+	// TimeToQuorum is measured from the first observation to the quorum VAA.
+	TimeToQuorum *latencySketch `json:"time_to_quorum"`
+	// OurDelay is measured from the first observation to ours, when we were not first.
+	OurDelay *latencySketch `json:"our_delay"`
+}
+
+func newVersionPeriod(guardian, version string, start time.Time) *versionPeriod {
+	return &versionPeriod{
+		Guardian:     guardian,
+		Version:      version,
+		Start:        start,
+		TimeToQuorum: newLatencySketch(),
+		OurDelay:     newLatencySketch(),
+	}
+}
+
+// statsStore persists the version periods to a JSON file. It is not safe for concurrent use.
+type statsStore struct {
+	path    string
+	Periods []*versionPeriod `json:"periods"`
+}
+
+// loadStats reads the stats file, which doesn't need to exist yet.
+func loadStats(path string) (*statsStore, error) {
+	s := &statsStore{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// start ends any period left open by a previous run and opens a new one.
+func (s *statsStore) start(guardian, version string, now time.Time) *versionPeriod {
+	for _, p := range s.Periods {
+		if p.End.IsZero() {
+			// The previous run didn't shut down cleanly, so its last save is the best guess.
+			p.End = now
+		}
+	}
+	p := newVersionPeriod(guardian, version, now)
+	s.Periods = append(s.Periods, p)
+	return p
+}
+
+// save writes the file atomically, so a crash never leaves a truncated file behind.
+func (s *statsStore) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// guardians returns the guardians with recorded periods, in the order they were first recorded.
+func (s *statsStore) guardians() []string {
+	var guardians []string
+	seen := map[string]bool{}
+	for _, p := range s.Periods {
+		if !seen[p.Guardian] {
+			seen[p.Guardian] = true
+			guardians = append(guardians, p.Guardian)
+		}
+	}
+	return guardians
+}
+
+type versionSummary struct {
+	version      string
+	start, end   time.Time
+	periods      int
+	total        versionPeriod
+	timeToQuorum *latencySketch
+	ourDelay     *latencySketch
+}
+
+// writeReport compares the versions of the guardian side by side, in the order they were first run.
+// Periods still open are reported up to now.
+func (s *statsStore) writeReport(w io.Writer, guardian string, now time.Time) error {
+	var order []string
+	byVersion := map[string]*versionSummary{}
+	for _, p := range s.Periods {
+		if p.Guardian != guardian {
+			continue
+		}
+		v, ok := byVersion[p.Version]
+		if !ok {
+			v = &versionSummary{version: p.Version, start: p.Start, timeToQuorum: newLatencySketch(), ourDelay: newLatencySketch()}
+			byVersion[p.Version] = v
+			order = append(order, p.Version)
+		}
+		end := p.End
+		if end.IsZero() {
+			end = now
+		}
+		if end.After(v.end) {
+			v.end = end
+		}
+		v.periods++
+		v.total.AllVaas += p.AllVaas
+		v.total.NoObservations += p.NoObservations
+		v.total.SignedByUs += p.SignedByUs
+		v.total.Won += p.Won
+		v.total.Lost += p.Lost
+		v.total.Missed += p.Missed
+		if err := v.timeToQuorum.merge(p.TimeToQuorum); err != nil {
+			return fmt.Errorf("period of %s starting %s: %w", p.Version, p.Start, err)
+		}
+		if err := v.ourDelay.merge(p.OurDelay); err != nil {
+			return fmt.Errorf("period of %s starting %s: %w", p.Version, p.Start, err)
+		}
+	}
+	if len(order) == 0 {
+		return errors.New("no statistics recorded")
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Version", "First Run", "Last Run", "Periods", "VAAs", "Won", "Lost", "Missed", "Signed", "Quorum Avg", "Quorum P50", "Quorum P95", "Our Delay Avg", "Our Delay P50", "Our Delay P95"})
+	for _, name := range order {
+		v := byVersion[name]
+		seen := v.total.AllVaas - v.total.NoObservations
+		version := v.version
+		if version == "" {
+			version = "unknown"
+		}
+		t.AppendRow(table.Row{
+			version, v.start.UTC().Format(time.DateTime), v.end.UTC().Format(time.DateTime), v.periods, v.total.AllVaas,
+			percent(v.total.Won, seen), percent(v.total.Lost, seen), percent(v.total.Missed, seen), percent(v.total.SignedByUs, seen),
+			latency(v.timeToQuorum, v.timeToQuorum.mean()), latency(v.timeToQuorum, v.timeToQuorum.quantile(0.5)), latency(v.timeToQuorum, v.timeToQuorum.quantile(0.95)),
+			latency(v.ourDelay, v.ourDelay.mean()), latency(v.ourDelay, v.ourDelay.quantile(0.5)), latency(v.ourDelay, v.ourDelay.quantile(0.95)),
+		})
+	}
+	t.Render()
+	return nil
+}
+
+func percent(n, total uint64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+// latency formats a statistic of h, or "-" if h is empty.
+func latency(h *latencySketch, d time.Duration) string {
+	if h.Count() == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	s, err := loadStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := s.start("g", "v1", start)
+	p.AllVaas, p.Won = 3, 2
+	for _, d := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond} {
+		p.TimeToQuorum.observe(d)
+	}
+	p.OurDelay.observe(50 * time.Millisecond)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Periods) != 1 {
+		t.Fatalf("loaded %d periods, want 1", len(loaded.Periods))
+	}
+	got := loaded.Periods[0].TimeToQuorum
+	if got.Count() != 3 || got.mean() != 200*time.Millisecond || got.quantile(1) != 300*time.Millisecond {
+		t.Errorf("time to quorum: count %d, mean %s, max %s, want 3, 200ms, 300ms", got.Count(), got.mean(), got.quantile(1))
+	}
+	// Sessions continue where they left off.
+	loaded.start("g", "v1", start.Add(time.Hour)).TimeToQuorum.observe(400 * time.Millisecond)
+	var out bytes.Buffer
+	if err := loaded.writeReport(&out, "g", start.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "250ms") {
+		t.Errorf("report does not show the mean time to quorum over both periods:\n%s", out.String())
+	}
+}
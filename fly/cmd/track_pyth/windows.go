@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/sketch"
+	"go.uber.org/zap"
+)
+
+var pythnetLatencyQuantiles = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "track_pyth_latency_quantile_seconds",
+	Help: "Quantiles of the time to quorum and of our delay over sliding windows, quantile 1 being the maximum",
+}, []string{"measure", "window", "quantile"})
+
+// reportedQuantiles are exported and logged for every window.
+var reportedQuantiles = []float64{0.5, 0.9, 0.99, 1}
+
+const (
+	// windowSlots is the number of steps a window slides by, e.g. 5 seconds for a 1 minute window.
+	windowSlots = 12
+	// sketchAccuracy is the relative accuracy of the quantiles.
+	sketchAccuracy = 0.01
+)
+
+// latencyWindows estimates the quantiles of a latency over several sliding windows.
+type latencyWindows struct {
+	measure string
+	windows []*sketch.Window
+}
+
+func newLatencyWindows(measure string, widths []time.Duration) *latencyWindows {
+	l := &latencyWindows{measure: measure}
+	for _, width := range widths {
+		l.windows = append(l.windows, sketch.NewWindow(width, windowSlots, sketchAccuracy))
+	}
+	return l
+}
+
+func (l *latencyWindows) add(t time.Time, d time.Duration) {
+	for _, w := range l.windows {
+		w.Add(t, d.Seconds())
+	}
+}
+
+// export sets the quantile gauges. Windows without samples are left out, rather than reporting a latency of 0.
+func (l *latencyWindows) export(now time.Time) {
+	for _, w := range l.windows {
+		s := w.Snapshot(now)
+		window := formatWindow(w.Width())
+		for _, q := range reportedQuantiles {
+			label := strconv.FormatFloat(q, 'f', -1, 64)
+			if s.Count() == 0 {
+				pythnetLatencyQuantiles.DeleteLabelValues(l.measure, window, label)
+				continue
+			}
+			pythnetLatencyQuantiles.WithLabelValues(l.measure, window, label).Set(s.Quantile(q))
+		}
+	}
+}
+
+// field logs the quantiles of every window, e.g. {"1m": {"count": 95, "p50": "412ms", ..., "max": "1.2s"}}.
+func (l *latencyWindows) field(now time.Time) zap.Field {
+	var windows []zap.Field
+	for _, w := range l.windows {
+		s := w.Snapshot(now)
+		fields := []zap.Field{zap.Uint64("count", s.Count())}
+		for _, q := range reportedQuantiles {
+			name := "max"
+			if q < 1 {
+				name = "p" + strconv.FormatFloat(100*q, 'f', -1, 64)
+			}
+			fields = append(fields, zap.Duration(name, time.Duration(s.Quantile(q)*float64(time.Second)).Round(time.Millisecond)))
+		}
+		windows = append(windows, zap.Dict(formatWindow(w.Width()), fields...))
+	}
+	return zap.Dict(l.measure, windows...)
+}
+
+// formatWindow drops the zero units, e.g. "10m" instead of "10m0s".
+func formatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// parseWindows parses a comma separated list of durations.
+func parseWindows(spec string) ([]time.Duration, error) {
+	var widths []time.Duration
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		if d < windowSlots*time.Second {
+			return nil, fmt.Errorf("window %s is shorter than %ds", s, windowSlots)
+		}
+		widths = append(widths, d)
+	}
+	return widths, nil
+}
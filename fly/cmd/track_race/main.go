@@ -0,0 +1,341 @@
+// This program listens to the gossip network and races guardians against each other: for every quorum VAA of the
+// tracked chains, it records which guardian's observation arrived first, how far behind the first observation each
+// tracked guardian was, and whether its signature made it into the VAA. Results are exported as Prometheus metrics
+// and printed as a table every --reportInterval.
+//
+// Run the program as follows:
+// $ go run . --env mainnet --guardians RockawayX,Staked --chains pythnet --metricsAddr :2113
+//
+// Gossip recorded with cmd/record_gossip can be raced offline instead:
+// $ go run . --replay '../record_gossip/recordings/*.gossip.gz' --replaySpeed 0 --chains pythnet
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	"github.com/certusone/wormhole/node/pkg/p2p"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/certusone/wormhole/node/pkg/supervisor"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	ipfslog "github.com/ipfs/go-log/v2"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/metrics"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/utils"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+)
+
+var (
+	envStr         = flag.String("env", "mainnet", `environment (may be "mainnet", "testnet" or "devnet", required)`)
+	logLevel       = flag.String("logLevel", "warn", "Logging level (debug, info, warn, error, dpanic, panic, fatal)")
+	p2pNetworkID   = flag.String("network", "", "P2P network identifier (optional, overrides default, required for devnet)")
+	p2pPort        = flag.Uint("port", 8999, "P2P UDP listener port")
+	p2pBootstrap   = flag.String("bootstrap", "", "P2P bootstrap peers (optional, overrides default)")
+	nodeKeyPath    = flag.String("nodeKey", "/tmp/node.key", "Path to node key (will be generated if it doesn't exist)")
+	ethRPC         = flag.String("ethRPC", "", "Ethereum RPC for fetching current guardian set (default is based on env)")
+	ethContract    = flag.String("ethContract", "", "Ethereum core bridge address for fetching current guardian set (default is based on env)")
+	guardiansFlag  = flag.String("guardians", "", "Comma separated guardians to track, by name, index or address (default all)")
+	chainsFlag     = flag.String("chains", "", "Comma separated chains to track, by name or ID (default all)")
+	reportInterval = flag.Duration("reportInterval", time.Minute, "How often the results table is printed (0 to disable)")
+	raceTTL        = flag.Duration("raceTTL", 30*time.Minute, "How long a message is waited on to reach quorum")
+	delayWindow    = flag.Duration("delayWindow", time.Hour, "Sliding window the median and p95 delays of every guardian are estimated over")
+	replayFiles    = flag.String("replay", "", "Comma separated recordings (or glob patterns) to replay instead of connecting to the gossip network")
+	replaySpeed    = flag.Float64("replaySpeed", 1, "Replay speed multiplier (0 replays as fast as possible)")
+)
+
+func main() {
+	var metricsConfig metrics.Config
+	metricsConfig.RegisterFlags(flag.CommandLine, ":2112")
+	flag.Parse()
+
+	lvl, err := ipfslog.LevelFromString(*logLevel)
+	if err != nil {
+		fmt.Println("Invalid log level")
+		os.Exit(1)
+	}
+	logger := ipfslog.Logger("track-race").Desugar()
+	ipfslog.SetAllLoggers(lvl)
+
+	env, err := node_common.ParseEnvironment(*envStr)
+	if err != nil || (env != node_common.UnsafeDevNet && env != node_common.TestNet && env != node_common.MainNet) {
+		logger.Fatal("Invalid value for --env, should be devnet, testnet or mainnet", zap.String("val", *envStr))
+	}
+
+	var guardians []common.GuardianEntry
+	var rpcUrl, coreBridgeAddr string
+	switch env {
+	case node_common.MainNet:
+		guardians = common.MainnetGuardians
+		rpcUrl = "https://ethereum-rpc.publicnode.com"
+		coreBridgeAddr = "0x98f3c9e6E3fAce36bAAd05FE09d375Ef1464288B"
+	case node_common.TestNet:
+		guardians = common.TestnetGuardians
+		rpcUrl = "https://ethereum-holesky-rpc.publicnode.com"
+		coreBridgeAddr = "0xa10f2eF61dE1f19f586ab8B6F2EbA89bACE63F7a"
+	case node_common.UnsafeDevNet:
+		guardians = common.DevnetGuardians
+		rpcUrl = "http://localhost:8545"
+		coreBridgeAddr = "0xC89Ce4735882C9F0f0FE26686c53074E09B0D550"
+	}
+	if *ethRPC != "" {
+		rpcUrl = *ethRPC
+	}
+	if *ethContract != "" {
+		coreBridgeAddr = *ethContract
+	}
+	if *p2pNetworkID == "" {
+		*p2pNetworkID = p2p.GetNetworkId(env)
+	}
+	if *p2pBootstrap == "" {
+		*p2pBootstrap, err = p2p.GetBootstrapPeers(env)
+		if err != nil {
+			logger.Fatal("failed to determine the bootstrap peers from the environment", zap.String("env", string(env)), zap.Error(err))
+		}
+	}
+
+	// Replays have to work offline, so they use the known guardians for the environment instead of querying the chain.
+	idx, sgs, err := utils.GuardianSet(env, *replayFiles != "", rpcUrl, coreBridgeAddr)
+	if err != nil {
+		logger.Fatal("Failed to fetch guardian set", zap.Error(err))
+	}
+	gs := node_common.GuardianSet{Keys: sgs.Keys, Index: idx}
+	logger.Info("guardian set", zap.Uint32("index", idx), zap.Any("keys", gs.KeysAsHexStrings()))
+
+	tracked, err := parseGuardians(*guardiansFlag, gs, guardians)
+	if err != nil {
+		logger.Fatal("Invalid --guardians", zap.Error(err))
+	}
+	chains, err := parseChains(*chainsFlag)
+	if err != nil {
+		logger.Fatal("Invalid --chains", zap.Error(err))
+	}
+	if *delayWindow < delayWindowSlots*time.Second {
+		logger.Fatal("Invalid --delayWindow, should be at least 12s", zap.Duration("val", *delayWindow))
+	}
+
+	rootCtx, rootCtxCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer rootCtxCancel()
+
+	if err := metrics.Start(rootCtx, logger, metricsConfig, "track_race", nil); err != nil {
+		logger.Fatal("Failed to start metrics", zap.Error(err))
+	}
+
+	race := newRaceTracker(tracked, chains, *raceTTL, *delayWindow)
+	go race.runCleanup(rootCtx)
+	if *reportInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(*reportInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-rootCtx.Done():
+					return
+				case <-ticker.C:
+					race.report(os.Stdout)
+				}
+			}
+		}()
+	}
+
+	batchObsvC := make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch], 20000)
+	signedInC := make(chan *gossipv1.SignedVAAWithQuorum, 20000)
+	heartbeatC := make(chan *gossipv1.Heartbeat, 50)
+	gst := node_common.NewGuardianSetState(heartbeatC)
+	gst.Set(&gs)
+
+	// Handle observations
+	go func() {
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case batch := <-batchObsvC:
+				guardianIndex, ok := gs.KeyIndex(eth_common.BytesToAddress(batch.Msg.Addr))
+				if !ok {
+					logger.Debug("received observation batch by unknown guardian", zap.String("addr", eth_common.BytesToAddress(batch.Msg.Addr).Hex()))
+					continue
+				}
+				for _, o := range batch.Msg.Observations {
+					if err := gossip.VerifyObservation(batch.Msg.Addr, o); err != nil {
+						logger.Debug("dropping invalid observation", zap.String("msgId", o.MessageId), zap.Error(err))
+						continue
+					}
+					race.observation(guardianIndex, o.MessageId, batch.Timestamp)
+				}
+			}
+		}
+	}()
+
+	// Handle signed VAAs
+	go func() {
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case m := <-signedInC:
+				v, err := vaa.Unmarshal(m.Vaa)
+				if err != nil {
+					logger.Debug("received invalid VAA in SignedVAAWithQuorum message", zap.Error(err))
+					continue
+				}
+				if v.GuardianSetIndex != gs.Index {
+					logger.Debug("dropping SignedVAAWithQuorum message signed by another guardian set", zap.String("msgId", v.MessageID()), zap.Uint32("index", v.GuardianSetIndex))
+					continue
+				}
+				if err := v.Verify(gs.Keys); err != nil {
+					logger.Debug("dropping SignedVAAWithQuorum message because it failed verification", zap.String("msgId", v.MessageID()), zap.Error(err))
+					continue
+				}
+				race.quorum(v)
+			}
+		}
+	}()
+
+	// Drain heartbeats, they are only used by p2p.Run.
+	go func() {
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case <-heartbeatC:
+			}
+		}
+	}()
+
+	if *replayFiles != "" {
+		files, err := gossip.ExpandRecordings(*replayFiles)
+		if err != nil {
+			logger.Fatal("Invalid --replay", zap.Error(err))
+		}
+		sinks := &gossip.Sinks{
+			Logger:     logger,
+			ObsvBatchC: batchObsvC,
+			SignedVAAC: signedInC,
+		}
+		go func() {
+			if err := gossip.Replay(rootCtx, logger, files, *replaySpeed, sinks.Dispatch); err != nil && rootCtx.Err() == nil {
+				logger.Error("Replay failed", zap.Error(err))
+			}
+			logger.Info("Replay finished")
+		}()
+		<-rootCtx.Done()
+		race.report(os.Stdout)
+		return
+	}
+
+	priv, err := node_common.GetOrCreateNodeKey(logger, *nodeKeyPath)
+	if err != nil {
+		logger.Fatal("Failed to load node key", zap.Error(err))
+	}
+
+	components := p2p.DefaultComponents()
+	components.Port = *p2pPort
+	params, err := p2p.NewRunParams(
+		*p2pBootstrap,
+		*p2pNetworkID,
+		priv,
+		gst,
+		rootCtxCancel,
+		p2p.WithComponents(components),
+		p2p.WithSignedObservationBatchListener(batchObsvC),
+		p2p.WithSignedVAAListener(signedInC),
+	)
+	if err != nil {
+		logger.Fatal("Failed to create RunParams", zap.Error(err))
+	}
+
+	supervisor.New(rootCtx, logger, func(ctx context.Context) error {
+		if err := supervisor.Run(ctx, "p2p", p2p.Run(params)); err != nil {
+			return err
+		}
+		logger.Info("Started internal services")
+		<-ctx.Done()
+		return nil
+	},
+		// It's safer to crash and restart the process in case we encounter a panic,
+		// rather than attempting to reschedule the runnable.
+		supervisor.WithPropagatePanic)
+
+	<-rootCtx.Done()
+	race.report(os.Stdout)
+	logger.Info("root context cancelled, exiting...")
+}
+
+// parseGuardians resolves the --guardians list against the guardian set to names by guardian set index.
+// Guardians are named after the known guardians of the environment, or their address.
+func parseGuardians(spec string, gs node_common.GuardianSet, known []common.GuardianEntry) (map[int]string, error) {
+	names := map[int]string{}
+	for i, key := range gs.Keys {
+		names[i] = key.Hex()
+		for _, g := range known {
+			if strings.EqualFold(g.Address, key.Hex()) {
+				names[i] = g.Name
+			}
+		}
+	}
+	if strings.TrimSpace(spec) == "" {
+		return names, nil
+	}
+
+	tracked := map[int]string{}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		found := -1
+		if i, err := strconv.Atoi(s); err == nil && i >= 0 && i < len(gs.Keys) {
+			found = i
+		} else if eth_common.IsHexAddress(s) {
+			if i, ok := gs.KeyIndex(eth_common.HexToAddress(s)); ok {
+				found = i
+			}
+		} else {
+			for i, name := range names {
+				if strings.EqualFold(name, s) {
+					found = i
+				}
+			}
+		}
+		if found < 0 {
+			return nil, fmt.Errorf("guardian %q is not in guardian set %d", s, gs.Index)
+		}
+		tracked[found] = names[found]
+	}
+	return tracked, nil
+}
+
+// parseChains parses the --chains list. It returns nil if it is empty, which tracks every chain.
+func parseChains(spec string) (map[vaa.ChainID]bool, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	chains := map[vaa.ChainID]bool{}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if id, err := strconv.ParseUint(s, 10, 16); err == nil {
+			chains[vaa.ChainID(id)] = true
+			continue
+		}
+		c, err := vaa.ChainIDFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		chains[c] = true
+	}
+	return chains, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/sketch"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/ttlset"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+var (
+	raceVAAs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "track_race_vaas_total",
+		Help: "The number of quorum VAAs of the tracked chains, by chain",
+	}, []string{"chain_name"})
+	raceObservations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "track_race_observations_total",
+		Help: "The outcome of each quorum VAA for each tracked guardian: first (its observation was the first one seen), later, or missed (no observation before quorum)",
+	}, []string{"guardian_name", "chain_name", "outcome"})
+	raceSignatures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "track_race_signatures_total",
+		Help: "The number of quorum VAAs that include a signature of the tracked guardian, by chain",
+	}, []string{"guardian_name", "chain_name"})
+	raceDelay = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "track_race_delay_seconds",
+		Help:    "Time from the first observation of a message to the observation of the tracked guardian, 0 when it was first",
+		Buckets: append([]float64{0}, prometheus.ExponentialBuckets(0.01, 2, 14)...),
+	}, []string{"guardian_name", "chain_name"})
+	raceDelayQuantile = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "track_race_delay_quantile_seconds",
+		Help: "Quantiles of the delay behind the first observation over the sliding --delayWindow of each tracked guardian, as of the last report",
+	}, []string{"guardian_name", "quantile"})
+	raceUnfinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "track_race_unfinished_total",
+		Help: "The number of messages that were observed but whose quorum VAA was not seen in time, by chain",
+	}, []string{"chain_name"})
+)
+
+// raceEntry is a message that has been observed but has not reached quorum yet.
+type raceEntry struct {
+	chain vaa.ChainID
+	first time.Time
+	// seen holds the time of the first observation of every guardian, by guardian set index.
+	seen map[int]time.Time
+}
+
+type guardianStats struct {
+	index int
+	name  string
+	vaas  uint64
+	first uint64
+	later uint64
+	// missed counts the VAAs that reached quorum before the guardian's observation arrived.
+	missed uint64
+	signed uint64
+	delays *sketch.Window
+}
+
+const (
+	// delayWindowSlots is the number of steps the delay window slides by.
+	delayWindowSlots = 12
+	// delayAccuracy is the relative accuracy of the delay quantiles.
+	delayAccuracy = 0.01
+)
+
+// raceTracker races the tracked guardians against each other on every message of the tracked chains.
+// It is safe for concurrent use.
+type raceTracker struct {
+	// chains is nil when all chains are tracked.
+	chains map[vaa.ChainID]bool
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*raceEntry
+	// done holds the message IDs whose quorum VAA was seen, so late observations don't start a new race.
+	done    *ttlset.Set
+	stats   map[int]*guardianStats
+	vaas    uint64
+	started time.Time
+	// latest is the receive time of the newest observation. Races expire relative to it rather than the wall clock,
+	// so replayed recordings race the same way they did live.
+	latest time.Time
+}
+
+// newRaceTracker tracks the given guardians, by index. Messages that don't reach quorum within ttl are dropped.
+// Delay quantiles are estimated over the messages first observed within delayWindow of the latest observation.
+func newRaceTracker(guardians map[int]string, chains map[vaa.ChainID]bool, ttl, delayWindow time.Duration) *raceTracker {
+	t := &raceTracker{
+		chains:  chains,
+		ttl:     ttl,
+		pending: map[string]*raceEntry{},
+		done:    ttlset.New("race_vaas", ttl, 1_000_000),
+		stats:   map[int]*guardianStats{},
+		started: time.Now(),
+	}
+	for idx, name := range guardians {
+		t.stats[idx] = &guardianStats{index: idx, name: name, delays: sketch.NewWindow(delayWindow, delayWindowSlots, delayAccuracy)}
+	}
+	return t
+}
+
+func (t *raceTracker) tracksChain(c vaa.ChainID) bool {
+	return t.chains == nil || t.chains[c]
+}
+
+// observation records a verified observation by the guardian at index idx, received at ts.
+func (t *raceTracker) observation(idx int, msgID string, ts time.Time) {
+	chain, ok := chainOfMessageID(msgID)
+	if !ok || !t.tracksChain(chain) {
+		return
+	}
+	if t.done.Contains(msgID) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.pending[msgID]
+	if !ok {
+		e = &raceEntry{chain: chain, first: ts, seen: map[int]time.Time{}}
+		t.pending[msgID] = e
+	}
+	if ts.Before(e.first) {
+		// Observations of a batch may be handled out of order.
+		e.first = ts
+	}
+	if prev, ok := e.seen[idx]; !ok || ts.Before(prev) {
+		e.seen[idx] = ts
+	}
+	if ts.After(t.latest) {
+		t.latest = ts
+	}
+}
+
+// quorum records a verified VAA.
+func (t *raceTracker) quorum(v *vaa.VAA) {
+	if !t.tracksChain(v.EmitterChain) {
+		return
+	}
+	msgID := v.MessageID()
+	if !t.done.Add(msgID) {
+		return
+	}
+	chain := v.EmitterChain.String()
+	raceVAAs.WithLabelValues(chain).Inc()
+	signed := map[int]bool{}
+	for _, sig := range v.Signatures {
+		signed[int(sig.Index)] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.vaas++
+	e := t.pending[msgID]
+	delete(t.pending, msgID)
+	for idx, s := range t.stats {
+		s.vaas++
+		if signed[idx] {
+			s.signed++
+			raceSignatures.WithLabelValues(s.name, chain).Inc()
+		}
+		var seenAt time.Time
+		if e != nil {
+			seenAt = e.seen[idx]
+		}
+		if seenAt.IsZero() {
+			s.missed++
+			raceObservations.WithLabelValues(s.name, chain, "missed").Inc()
+			continue
+		}
+		delay := seenAt.Sub(e.first)
+		if delay == 0 {
+			s.first++
+			raceObservations.WithLabelValues(s.name, chain, "first").Inc()
+		} else {
+			s.later++
+			raceObservations.WithLabelValues(s.name, chain, "later").Inc()
+		}
+		s.delays.Add(e.first, delay.Seconds())
+		raceDelay.WithLabelValues(s.name, chain).Observe(delay.Seconds())
+	}
+}
+
+// runCleanup drops the races that didn't finish within the ttl, and evicts old VAAs, until the context is cancelled.
+func (t *raceTracker) runCleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.done.Evict()
+			t.mu.Lock()
+			cutoff := t.latest.Add(-t.ttl)
+			for id, e := range t.pending {
+				if e.first.Before(cutoff) {
+					raceUnfinished.WithLabelValues(e.chain.String()).Inc()
+					delete(t.pending, id)
+				}
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// report updates the quantile gauges and writes a table of the results, from the fastest guardian to the slowest.
+// Guardians without a delay in the window come last.
+func (t *raceTracker) report(w io.Writer) {
+	t.mu.Lock()
+	rows := make([]guardianStats, 0, len(t.stats))
+	quantiles := map[int][3]float64{}
+	for idx, s := range t.stats {
+		rows = append(rows, *s)
+		delays := s.delays.Snapshot(t.latest)
+		p50, p95, n := delays.Quantile(0.5), delays.Quantile(0.95), delays.Count()
+		quantiles[idx] = [3]float64{p50, p95, float64(n)}
+		if n > 0 {
+			raceDelayQuantile.WithLabelValues(s.name, "0.5").Set(p50)
+			raceDelayQuantile.WithLabelValues(s.name, "0.95").Set(p95)
+		}
+	}
+	vaas, pending, since := t.vaas, len(t.pending), time.Since(t.started)
+	t.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		qi, qj := quantiles[rows[i].index], quantiles[rows[j].index]
+		if (qi[2] > 0) != (qj[2] > 0) {
+			return qi[2] > 0
+		}
+		if qi[0] != qj[0] {
+			return qi[0] < qj[0]
+		}
+		return rows[i].first > rows[j].first
+	})
+
+	fmt.Fprintf(w, "\n%s: %d VAAs in %s, %d messages awaiting quorum\n", time.Now().UTC().Format(time.RFC3339), vaas, since.Round(time.Second), pending)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "guardian\tindex\tfirst %\tseen %\tmissed %\tp50 delay\tp95 delay\tsigned %\t")
+	for _, r := range rows {
+		q := quantiles[r.index]
+		p50, p95 := "-", "-"
+		if q[2] > 0 {
+			p50 = formatSeconds(q[0])
+			p95 = formatSeconds(q[1])
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			r.name, r.index, percent(r.first, r.vaas), percent(r.first+r.later, r.vaas), percent(r.missed, r.vaas),
+			p50, p95, percent(r.signed, r.vaas))
+	}
+	tw.Flush()
+}
+
+func percent(n, total uint64) string {
+	if total == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(100*float64(n)/float64(total), 'f', 1, 64)
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// chainOfMessageID parses the emitter chain out of a "chain/emitter/sequence" message ID.
+func chainOfMessageID(msgID string) (vaa.ChainID, bool) {
+	s, _, ok := strings.Cut(msgID, "/")
+	if !ok {
+		return 0, false
+	}
+	c, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return vaa.ChainID(c), true
+}
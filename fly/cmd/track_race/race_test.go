@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+)
+
+func quorumVAA(seq uint64, signers ...uint8) *vaa.VAA {
+	v := &vaa.VAA{
+		EmitterChain:   vaa.ChainIDSolana,
+		EmitterAddress: vaa.Address{1},
+		Sequence:       seq,
+	}
+	for _, i := range signers {
+		v.Signatures = append(v.Signatures, &vaa.Signature{Index: i})
+	}
+	return v
+}
+
+func TestRaceTracker(t *testing.T) {
+	race := newRaceTracker(map[int]string{0: "zero", 1: "one", 2: "two"}, map[vaa.ChainID]bool{vaa.ChainIDSolana: true}, time.Hour, time.Hour)
+	t0 := time.Now()
+	first, second := quorumVAA(1, 0, 1), quorumVAA(2, 0, 1, 2)
+
+	race.observation(1, first.MessageID(), t0)
+	race.observation(0, first.MessageID(), t0.Add(100*time.Millisecond))
+	// Untracked chains are ignored.
+	race.observation(2, "2/0000000000000000000000000000000000000000000000000000000000000001/1", t0)
+	race.quorum(first)
+	// Neither a late observation nor a repeated VAA starts another race.
+	race.observation(2, first.MessageID(), t0.Add(time.Second))
+	race.quorum(first)
+
+	// The observations of a batch may be handled out of order.
+	race.observation(0, second.MessageID(), t0.Add(1200*time.Millisecond))
+	race.observation(1, second.MessageID(), t0.Add(time.Second))
+	race.quorum(second)
+
+	if race.vaas != 2 || len(race.pending) != 0 {
+		t.Fatalf("%d VAAs with %d pending, want 2 with none pending", race.vaas, len(race.pending))
+	}
+	want := map[int]guardianStats{
+		0: {vaas: 2, later: 2, signed: 2},
+		1: {vaas: 2, first: 2, signed: 2},
+		2: {vaas: 2, missed: 2, signed: 1},
+	}
+	for idx, w := range want {
+		s := race.stats[idx]
+		if s.vaas != w.vaas || s.first != w.first || s.later != w.later || s.missed != w.missed || s.signed != w.signed {
+			t.Errorf("guardian %d: vaas %d first %d later %d missed %d signed %d, want %d %d %d %d %d", idx,
+				s.vaas, s.first, s.later, s.missed, s.signed, w.vaas, w.first, w.later, w.missed, w.signed)
+		}
+	}
+
+	var buf bytes.Buffer
+	race.report(&buf)
+	var rows [][]string
+	for _, line := range strings.Split(buf.String(), "\n")[3:] {
+		if f := strings.Fields(line); len(f) > 0 {
+			rows = append(rows, f)
+		}
+	}
+	wantRows := [][]string{
+		{"one", "1", "100.0", "100.0", "0.0", "0s", "0s", "100.0"},
+		{"zero", "0", "0.0", "100.0", "0.0"},
+		// Without delays, two sorts last even though it has the smallest p50.
+		{"two", "2", "0.0", "0.0", "100.0", "-", "-", "50.0"},
+	}
+	if len(rows) != len(wantRows) {
+		t.Fatalf("report:\n%s\nwant %d rows", buf.String(), len(wantRows))
+	}
+	for i, w := range wantRows {
+		if strings.Join(rows[i][:len(w)], " ") != strings.Join(w, " ") {
+			t.Errorf("row %d = %v, want %v", i, rows[i], w)
+		}
+	}
+}
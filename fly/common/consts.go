@@ -17,6 +17,12 @@ type GuardianEntry struct {
 	Address string
 }
 
+// The testnet and devnet guardian sets have never been upgraded.
+const (
+	TestnetGuardianSetIndex uint32 = 0
+	DevnetGuardianSetIndex  uint32 = 0
+)
+
 var StandbyMainnetGuardians = []GuardianEntry{}
 
 // Although there are multiple testnet guardians running, they all use the same key, so it looks like one.
@@ -6,6 +6,9 @@ package common
 
 import "strings"
 
+// MainnetGuardianSetIndex is the index of the guardian set in mainnetv2/v5.prototxt, which starts at v1 for index 0.
+const MainnetGuardianSetIndex uint32 = 4
+
 var MainnetGuardians = []GuardianEntry{
 	{0, "RockawayX", "0x5893B5A76c3f739645648885bDCcC06cd70a3Cd3"},
 	{1, "Staked", "0xfF6CB952589BDE862c25Ef4392132fb9D4A42157"},
@@ -0,0 +1,196 @@
+package gossip
+
+import (
+	"strings"
+	"sync"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BandwidthTracer is a pubsub.RawTracer that accounts for the gossipsub traffic of a node: the bytes of every RPC
+// received, sent and dropped, the share of it carrying published messages per topic, and the number of control
+// messages (IHAVE, IWANT, GRAFT, PRUNE, IDONTWANT), which are what the mesh parameters D, Dlo, Dhi and Dout trade off.
+//
+// p2p.NewHost doesn't accept a libp2p bandwidth reporter, neither as an argument nor through p2p.Components, so
+// this is measured at the pubsub layer instead. Per-protocol stream bytes would need a host built outside of the
+// node package, which would no longer match the transports and limits of the guardians.
+type BandwidthTracer struct {
+	rpcBytes     *prometheus.CounterVec
+	rpcs         *prometheus.CounterVec
+	publishBytes *prometheus.CounterVec
+	controlMsgs  *prometheus.CounterVec
+	meshPeers    *prometheus.GaugeVec
+
+	mu sync.Mutex
+	// mesh holds the mesh peers of every topic, since peers that disconnect leave the mesh without a Prune event.
+	mesh map[string]map[peer.ID]bool
+}
+
+var _ pubsub.RawTracer = (*BandwidthTracer)(nil)
+
+// NewBandwidthTracer registers the tracer metrics with reg. Pass it to the listener with pubsub.WithRawTracer.
+func NewBandwidthTracer(reg prometheus.Registerer) (*BandwidthTracer, error) {
+	t := &BandwidthTracer{
+		rpcBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gossipsub_rpc_bytes_total",
+			Help: "Bytes of gossipsub RPCs, by direction (in, out or dropped)",
+		}, []string{"direction"}),
+		rpcs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gossipsub_rpcs_total",
+			Help: "The number of gossipsub RPCs, by direction (in, out or dropped)",
+		}, []string{"direction"}),
+		publishBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gossipsub_publish_bytes_total",
+			Help: "Bytes of published messages carried in gossipsub RPCs, including duplicates, by direction and topic",
+		}, []string{"direction", "topic"}),
+		controlMsgs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gossipsub_control_messages_total",
+			Help: "The number of gossipsub control messages, by direction and kind",
+		}, []string{"direction", "kind"}),
+		meshPeers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gossipsub_mesh_peers",
+			Help: "The number of peers in the gossipsub mesh of each topic",
+		}, []string{"topic"}),
+		mesh: map[string]map[peer.ID]bool{},
+	}
+	for _, c := range []prometheus.Collector{t.rpcBytes, t.rpcs, t.publishBytes, t.controlMsgs, t.meshPeers} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *BandwidthTracer) account(direction string, rpc *pubsub.RPC) {
+	t.rpcs.WithLabelValues(direction).Inc()
+	t.rpcBytes.WithLabelValues(direction).Add(float64(rpc.Size()))
+	for _, m := range rpc.GetPublish() {
+		t.publishBytes.WithLabelValues(direction, topicName(m.GetTopic())).Add(float64(m.Size()))
+	}
+	ctl := rpc.GetControl()
+	if ctl == nil {
+		return
+	}
+	t.control(direction, "ihave", len(ctl.GetIhave()))
+	t.control(direction, "iwant", len(ctl.GetIwant()))
+	t.control(direction, "graft", len(ctl.GetGraft()))
+	t.control(direction, "prune", len(ctl.GetPrune()))
+	t.control(direction, "idontwant", len(ctl.GetIdontwant()))
+}
+
+func (t *BandwidthTracer) control(direction, kind string, n int) {
+	if n > 0 {
+		t.controlMsgs.WithLabelValues(direction, kind).Add(float64(n))
+	}
+}
+
+func (t *BandwidthTracer) RecvRPC(rpc *pubsub.RPC)            { t.account("in", rpc) }
+func (t *BandwidthTracer) SendRPC(rpc *pubsub.RPC, _ peer.ID) { t.account("out", rpc) }
+func (t *BandwidthTracer) DropRPC(rpc *pubsub.RPC, _ peer.ID) { t.account("dropped", rpc) }
+
+func (t *BandwidthTracer) Graft(p peer.ID, topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mesh[topic] == nil {
+		t.mesh[topic] = map[peer.ID]bool{}
+	}
+	t.mesh[topic][p] = true
+	t.meshPeers.WithLabelValues(topicName(topic)).Set(float64(len(t.mesh[topic])))
+}
+
+func (t *BandwidthTracer) Prune(p peer.ID, topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneLocked(p, topic)
+}
+
+func (t *BandwidthTracer) RemovePeer(p peer.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for topic := range t.mesh {
+		t.pruneLocked(p, topic)
+	}
+}
+
+func (t *BandwidthTracer) pruneLocked(p peer.ID, topic string) {
+	delete(t.mesh[topic], p)
+	t.meshPeers.WithLabelValues(topicName(topic)).Set(float64(len(t.mesh[topic])))
+}
+
+func (t *BandwidthTracer) AddPeer(peer.ID, protocol.ID)          {}
+func (t *BandwidthTracer) Join(string)                           {}
+func (t *BandwidthTracer) Leave(string)                          {}
+func (t *BandwidthTracer) ValidateMessage(*pubsub.Message)       {}
+func (t *BandwidthTracer) DeliverMessage(*pubsub.Message)        {}
+func (t *BandwidthTracer) RejectMessage(*pubsub.Message, string) {}
+func (t *BandwidthTracer) DuplicateMessage(*pubsub.Message)      {}
+func (t *BandwidthTracer) ThrottlePeer(peer.ID)                  {}
+func (t *BandwidthTracer) UndeliverableMessage(*pubsub.Message)  {}
+
+// topicName strips the network ID from a topic.
+func topicName(topic string) string {
+	if i := strings.LastIndex(topic, "/"); i >= 0 {
+		return topic[i+1:]
+	}
+	return topic
+}
+
+// resourceCollector exports the usage of the libp2p resource manager scopes of a host: the system and transient
+// scopes, and every protocol the host speaks.
+type resourceCollector struct {
+	h       host.Host
+	streams *prometheus.Desc
+	conns   *prometheus.Desc
+	memory  *prometheus.Desc
+	fds     *prometheus.Desc
+}
+
+// RegisterResourceCollector registers a collector of the resource manager stats of h with reg.
+func RegisterResourceCollector(reg prometheus.Registerer, h host.Host) error {
+	return reg.Register(&resourceCollector{
+		h:       h,
+		streams: prometheus.NewDesc("libp2p_scope_streams", "Open streams in a resource manager scope, by direction", []string{"scope", "protocol", "direction"}, nil),
+		conns:   prometheus.NewDesc("libp2p_scope_conns", "Open connections in a resource manager scope, by direction", []string{"scope", "direction"}, nil),
+		memory:  prometheus.NewDesc("libp2p_scope_memory_bytes", "Memory reserved in a resource manager scope", []string{"scope", "protocol"}, nil),
+		fds:     prometheus.NewDesc("libp2p_scope_fds", "File descriptors reserved in a resource manager scope", []string{"scope"}, nil),
+	})
+}
+
+func (c *resourceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.streams
+	ch <- c.conns
+	ch <- c.memory
+	ch <- c.fds
+}
+
+func (c *resourceCollector) Collect(ch chan<- prometheus.Metric) {
+	rm := c.h.Network().ResourceManager()
+	scope := func(name string) func(network.ResourceScope) error {
+		return func(s network.ResourceScope) error {
+			st := s.Stat()
+			ch <- prometheus.MustNewConstMetric(c.streams, prometheus.GaugeValue, float64(st.NumStreamsInbound), name, "", "in")
+			ch <- prometheus.MustNewConstMetric(c.streams, prometheus.GaugeValue, float64(st.NumStreamsOutbound), name, "", "out")
+			ch <- prometheus.MustNewConstMetric(c.conns, prometheus.GaugeValue, float64(st.NumConnsInbound), name, "in")
+			ch <- prometheus.MustNewConstMetric(c.conns, prometheus.GaugeValue, float64(st.NumConnsOutbound), name, "out")
+			ch <- prometheus.MustNewConstMetric(c.memory, prometheus.GaugeValue, float64(st.Memory), name, "")
+			ch <- prometheus.MustNewConstMetric(c.fds, prometheus.GaugeValue, float64(st.NumFD), name)
+			return nil
+		}
+	}
+	_ = rm.ViewSystem(scope("system"))
+	_ = rm.ViewTransient(scope("transient"))
+	for _, p := range c.h.Mux().Protocols() {
+		_ = rm.ViewProtocol(p, func(s network.ProtocolScope) error {
+			st := s.Stat()
+			ch <- prometheus.MustNewConstMetric(c.streams, prometheus.GaugeValue, float64(st.NumStreamsInbound), "protocol", string(p), "in")
+			ch <- prometheus.MustNewConstMetric(c.streams, prometheus.GaugeValue, float64(st.NumStreamsOutbound), "protocol", string(p), "out")
+			ch <- prometheus.MustNewConstMetric(c.memory, prometheus.GaugeValue, float64(st.Memory), "protocol", string(p))
+			return nil
+		})
+	}
+}
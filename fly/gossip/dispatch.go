@@ -0,0 +1,148 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	eth_crypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var heartbeatMessagePrefix = []byte("heartbeat|")
+
+// VerifyHeartbeat checks the signature of a heartbeat, decodes it and checks that it is consistent with its envelope.
+// If gs is not nil the signer must be part of it. If from is not empty and the heartbeat carries a p2p node ID, they must match.
+func VerifyHeartbeat(s *gossipv1.SignedHeartbeat, gs *node_common.GuardianSet, from peer.ID) (*gossipv1.Heartbeat, error) {
+	envelopeAddr := eth_common.BytesToAddress(s.GuardianAddr)
+	if gs != nil {
+		if _, ok := gs.KeyIndex(envelopeAddr); !ok {
+			return nil, fmt.Errorf("heartbeat signer %s is not in guardian set %d", envelopeAddr.Hex(), gs.Index)
+		}
+	}
+
+	digest := eth_crypto.Keccak256Hash(append(append([]byte(nil), heartbeatMessagePrefix...), s.Heartbeat...))
+	pubKey, err := eth_crypto.Ecrecover(digest.Bytes(), s.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover heartbeat signer: %w", err)
+	}
+	signerAddr := eth_common.BytesToAddress(eth_crypto.Keccak256(pubKey[1:])[12:])
+	if signerAddr != envelopeAddr {
+		return nil, fmt.Errorf("heartbeat signed by %s but the envelope claims %s", signerAddr.Hex(), envelopeAddr.Hex())
+	}
+
+	var hb gossipv1.Heartbeat
+	if err := proto.Unmarshal(s.Heartbeat, &hb); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal heartbeat: %w", err)
+	}
+	if eth_common.HexToAddress(hb.GuardianAddr) != signerAddr {
+		return nil, fmt.Errorf("heartbeat guardian address %s does not match signer %s", hb.GuardianAddr, signerAddr.Hex())
+	}
+	if from != "" && len(hb.P2PNodeId) != 0 {
+		id, err := peer.IDFromBytes(hb.P2PNodeId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode heartbeat p2p node ID: %w", err)
+		}
+		if id != from {
+			return nil, fmt.Errorf("heartbeat p2p node ID %s does not match sender %s", id, from)
+		}
+	}
+	return &hb, nil
+}
+
+// VerifyObservation checks that the observation was signed by addr, which observation batches carry unauthenticated.
+func VerifyObservation(addr []byte, o *gossipv1.Observation) error {
+	pk, err := eth_crypto.Ecrecover(o.Hash, o.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to recover signer: %w", err)
+	}
+	signer := eth_common.BytesToAddress(eth_crypto.Keccak256(pk[1:])[12:])
+	if signer != eth_common.BytesToAddress(addr) {
+		return fmt.Errorf("signed by %s instead of %s", signer.Hex(), eth_common.BytesToAddress(addr).Hex())
+	}
+	return nil
+}
+
+var errNoGuardianSet = errors.New("no guardian set")
+
+// Sinks routes gossip messages to the same channels p2p.Run delivers them to, so that anything that consumes
+// p2p.Run can also consume a Listener or a Replay. Nil channels drop the corresponding message type.
+// Unlike p2p.Run, sends block until the message is accepted or the context is cancelled.
+type Sinks struct {
+	Logger *zap.Logger
+	// Gst receives verified heartbeats, which it forwards to its update channel.
+	Gst        *node_common.GuardianSetState
+	ObsvBatchC chan<- *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]
+	ObsvReqC   chan<- *gossipv1.ObservationRequest
+	SignedVAAC chan<- *gossipv1.SignedVAAWithQuorum
+	// TimedSignedVAAC receives quorum VAAs along with the time the envelope was received, which p2p.Run does not provide.
+	TimedSignedVAAC chan<- *node_common.MsgWithTimeStamp[gossipv1.SignedVAAWithQuorum]
+	GovConfigC      chan<- *gossipv1.SignedChainGovernorConfig
+	GovStatusC      chan<- *gossipv1.SignedChainGovernorStatus
+}
+
+// Dispatch is a Handler.
+func (s *Sinks) Dispatch(ctx context.Context, e *Envelope) {
+	if e.Msg == nil {
+		return
+	}
+	switch m := e.Msg.Message.(type) {
+	case *gossipv1.GossipMessage_SignedHeartbeat:
+		if s.Gst == nil {
+			return
+		}
+		gs := s.Gst.Get()
+		if gs == nil {
+			s.Logger.Debug("dropping heartbeat", zap.Error(errNoGuardianSet))
+			return
+		}
+		hb, err := VerifyHeartbeat(m.SignedHeartbeat, gs, e.From)
+		if err != nil {
+			s.Logger.Debug("dropping invalid heartbeat", zap.String("from", e.From.String()), zap.Error(err))
+			return
+		}
+		if err := s.Gst.SetHeartbeat(eth_common.HexToAddress(hb.GuardianAddr), e.From, hb); err != nil {
+			s.Logger.Debug("failed to store heartbeat", zap.Error(err))
+		}
+	case *gossipv1.GossipMessage_SignedObservationBatch:
+		send(ctx, s.ObsvBatchC, &node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]{
+			Msg:       m.SignedObservationBatch,
+			Timestamp: e.ReceivedAt,
+		})
+	case *gossipv1.GossipMessage_SignedVaaWithQuorum:
+		send(ctx, s.SignedVAAC, m.SignedVaaWithQuorum)
+		send(ctx, s.TimedSignedVAAC, &node_common.MsgWithTimeStamp[gossipv1.SignedVAAWithQuorum]{
+			Msg:       m.SignedVaaWithQuorum,
+			Timestamp: e.ReceivedAt,
+		})
+	case *gossipv1.GossipMessage_SignedObservationRequest:
+		if s.ObsvReqC == nil {
+			return
+		}
+		var req gossipv1.ObservationRequest
+		if err := proto.Unmarshal(m.SignedObservationRequest.ObservationRequest, &req); err != nil {
+			s.Logger.Debug("failed to unmarshal observation request", zap.Error(err))
+			return
+		}
+		send(ctx, s.ObsvReqC, &req)
+	case *gossipv1.GossipMessage_SignedChainGovernorConfig:
+		send(ctx, s.GovConfigC, m.SignedChainGovernorConfig)
+	case *gossipv1.GossipMessage_SignedChainGovernorStatus:
+		send(ctx, s.GovStatusC, m.SignedChainGovernorStatus)
+	}
+}
+
+func send[T any](ctx context.Context, c chan<- T, v T) {
+	if c == nil {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case c <- v:
+	}
+}
@@ -0,0 +1,117 @@
+// Package gossiptest builds signed gossip messages and recordings of them, for the tests of the tools that consume gossip.
+package gossiptest
+
+import (
+	"crypto/ecdsa"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	eth_crypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"google.golang.org/protobuf/proto"
+)
+
+// Guardian is a guardian key along with the peer ID it publishes from.
+type Guardian struct {
+	Key  *ecdsa.PrivateKey
+	Addr eth_common.Address
+	Peer peer.ID
+}
+
+func NewGuardian(t testing.TB) Guardian {
+	t.Helper()
+	key, err := eth_crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Guardian{Key: key, Addr: eth_crypto.PubkeyToAddress(key.PublicKey), Peer: NewPeerID(t)}
+}
+
+func NewPeerID(t testing.TB) peer.ID {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// Heartbeat signs hb, filling in the guardian address, the way guardians do.
+func (g Guardian) Heartbeat(t testing.TB, hb *gossipv1.Heartbeat) *gossipv1.GossipMessage {
+	t.Helper()
+	hb.GuardianAddr = g.Addr.Hex()
+	b, err := proto.Marshal(hb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := eth_crypto.Keccak256Hash(append([]byte("heartbeat|"), b...))
+	sig, err := eth_crypto.Sign(digest.Bytes(), g.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedHeartbeat{SignedHeartbeat: &gossipv1.SignedHeartbeat{
+		Heartbeat:    b,
+		Signature:    sig,
+		GuardianAddr: g.Addr.Bytes(),
+	}}}
+}
+
+// Observation signs the hash of a message.
+func (g Guardian) Observation(t testing.TB, msgID string, hash []byte) *gossipv1.Observation {
+	t.Helper()
+	sig, err := eth_crypto.Sign(hash, g.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gossipv1.Observation{Hash: hash, Signature: sig, MessageId: msgID}
+}
+
+// ObservationBatch wraps observations in a batch sent by the guardian.
+func (g Guardian) ObservationBatch(observations ...*gossipv1.Observation) *gossipv1.GossipMessage {
+	return &gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedObservationBatch{SignedObservationBatch: &gossipv1.SignedObservationBatch{
+		Addr:         g.Addr.Bytes(),
+		Observations: observations,
+	}}}
+}
+
+// Envelope wraps a message published by from on the topic, as the listener would have received and decoded it at receivedAt.
+func Envelope(t testing.TB, from peer.ID, topic string, receivedAt time.Time, msg *gossipv1.GossipMessage) *gossip.Envelope {
+	t.Helper()
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gossip.Envelope{ReceivedAt: receivedAt, From: from, ReceivedFrom: from, Topic: "/wormhole/test/" + topic, Data: data, Msg: msg}
+}
+
+// WriteRecording writes the envelopes to a new compressed recording in a temporary directory and returns its path.
+func WriteRecording(t testing.TB, envelopes ...*gossip.Envelope) string {
+	t.Helper()
+	dir := t.TempDir()
+	r, err := gossip.NewRecorder(gossip.RecorderConfig{Dir: dir, Prefix: "test-", Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range envelopes {
+		if err := r.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+gossip.RecordingExt+".gz"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one recording, found %v (%v)", files, err)
+	}
+	return files[0]
+}
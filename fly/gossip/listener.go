@@ -0,0 +1,225 @@
+// Package gossip provides direct access to the guardian gossip network, bypassing p2p.Run, along with
+// the ability to record the received messages to disk and replay them later.
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/certusone/wormhole/node/pkg/p2p"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultTopics are the gossip topics joined by a Listener when none are specified.
+var DefaultTopics = []string{"control", "attestation", "vaa"}
+
+// Envelope is a single gossip message along with the metadata pubsub attaches to it.
+type Envelope struct {
+	ReceivedAt time.Time
+	// From is the peer that authored the message.
+	From peer.ID
+	// ReceivedFrom is the peer that forwarded the message to us.
+	ReceivedFrom peer.ID
+	Topic        string
+	Data         []byte
+	// Msg is nil if Data could not be decoded.
+	Msg *gossipv1.GossipMessage
+}
+
+// Handler is called for every received message. It may be called concurrently for messages on different topics.
+type Handler func(ctx context.Context, e *Envelope)
+
+type ListenerConfig struct {
+	NetworkID string
+	Bootstrap string
+	Port      uint
+	Priv      crypto.PrivKey
+	// Topics defaults to DefaultTopics. Names are relative to the network ID.
+	Topics []string
+	// Components defaults to p2p.DefaultComponents(). Port overrides its port.
+	Components *p2p.Components
+	// PubsubOptions are passed through to pubsub.NewGossipSub.
+	PubsubOptions []pubsub.Option
+	// Trace, if set, writes the mesh and delivery events of pubsub to rotating files, see Tracer.
+	Trace *TraceConfig
+}
+
+// Listener joins the gossip topics directly with go-libp2p-pubsub.
+type Listener struct {
+	logger *zap.Logger
+	host   host.Host
+	ps     *pubsub.PubSub
+	topics []*pubsub.Topic
+	subs   []*pubsub.Subscription
+	tracer *Tracer
+}
+
+func NewListener(ctx context.Context, logger *zap.Logger, cfg ListenerConfig) (*Listener, error) {
+	components := cfg.Components
+	if components == nil {
+		components = p2p.DefaultComponents()
+	}
+	components.Port = cfg.Port
+	topics := cfg.Topics
+	if len(topics) == 0 {
+		topics = DefaultTopics
+	}
+
+	h, err := p2p.NewHost(logger, ctx, cfg.NetworkID, cfg.Bootstrap, components, cfg.Priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create host: %w", err)
+	}
+	l := &Listener{logger: logger, host: h}
+
+	opts := cfg.PubsubOptions
+	if cfg.Trace != nil {
+		l.tracer, err = NewTracer(ctx, logger, *cfg.Trace)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to create tracer: %w", err)
+		}
+		opts = append(opts[:len(opts):len(opts)], pubsub.WithRawTracer(l.tracer))
+	}
+
+	l.ps, err = pubsub.NewGossipSub(ctx, h, opts...)
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to create pubsub: %w", err)
+	}
+
+	for _, name := range topics {
+		topic := fmt.Sprintf("%s/%s", cfg.NetworkID, name)
+		th, err := l.ps.Join(topic)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to join topic %s: %w", topic, err)
+		}
+		l.topics = append(l.topics, th)
+		sub, err := th.Subscribe()
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+		}
+		l.subs = append(l.subs, sub)
+	}
+
+	return l, nil
+}
+
+func (l *Listener) Host() host.Host {
+	return l.host
+}
+
+func (l *Listener) PubSub() *pubsub.PubSub {
+	return l.ps
+}
+
+// Run delivers messages from every subscribed topic to handle until the context is cancelled.
+func (l *Listener) Run(ctx context.Context, handle Handler) {
+	var wg sync.WaitGroup
+	for _, sub := range l.subs {
+		wg.Add(1)
+		go func(sub *pubsub.Subscription) {
+			defer wg.Done()
+			for {
+				m, err := sub.Next(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						l.logger.Info("failed to receive pubsub message", zap.String("topic", sub.Topic()), zap.Error(err))
+					}
+					return
+				}
+				handle(ctx, newEnvelope(l.logger, m))
+			}
+		}(sub)
+	}
+	wg.Wait()
+}
+
+// Close tears down the subscriptions, topics and host, and closes the trace.
+func (l *Listener) Close() {
+	for _, sub := range l.subs {
+		sub.Cancel()
+	}
+	for _, th := range l.topics {
+		if err := th.Close(); err != nil {
+			l.logger.Debug("Error closing topic", zap.String("topic", th.String()), zap.Error(err))
+		}
+	}
+	if err := l.host.Close(); err != nil {
+		l.logger.Info("Error closing the host", zap.Error(err))
+	}
+	if l.tracer != nil {
+		if err := l.tracer.Close(); err != nil {
+			l.logger.Error("Error closing the trace", zap.Error(err))
+		}
+	}
+}
+
+func newEnvelope(logger *zap.Logger, m *pubsub.Message) *Envelope {
+	e := &Envelope{
+		ReceivedAt:   time.Now(),
+		From:         m.GetFrom(),
+		ReceivedFrom: m.ReceivedFrom,
+		Topic:        m.GetTopic(),
+		Data:         m.Data,
+	}
+	e.decode(logger)
+	return e
+}
+
+func (e *Envelope) decode(logger *zap.Logger) {
+	var msg gossipv1.GossipMessage
+	if err := proto.Unmarshal(e.Data, &msg); err != nil {
+		logger.Debug("received invalid message",
+			zap.Binary("data", e.Data),
+			zap.String("from", e.From.String()))
+		return
+	}
+	e.Msg = &msg
+}
+
+// TopicName is the topic without the network ID prefix, e.g. "control".
+func (e *Envelope) TopicName() string {
+	if i := strings.LastIndex(e.Topic, "/"); i >= 0 {
+		return e.Topic[i+1:]
+	}
+	return e.Topic
+}
+
+// MessageType is a short name for the type of the message, suitable as a metric label.
+// It is "invalid" for messages that could not be decoded.
+func (e *Envelope) MessageType() string {
+	if e.Msg == nil {
+		return "invalid"
+	}
+	switch e.Msg.Message.(type) {
+	case *gossipv1.GossipMessage_SignedHeartbeat:
+		return "heartbeat"
+	case *gossipv1.GossipMessage_SignedObservationBatch:
+		return "observation_batch"
+	case *gossipv1.GossipMessage_SignedVaaWithQuorum:
+		return "vaa"
+	case *gossipv1.GossipMessage_SignedObservationRequest:
+		return "observation_request"
+	case *gossipv1.GossipMessage_SignedChainGovernorConfig:
+		return "gov_config"
+	case *gossipv1.GossipMessage_SignedChainGovernorStatus:
+		return "gov_status"
+	case *gossipv1.GossipMessage_SignedQueryRequest:
+		return "query_request"
+	case *gossipv1.GossipMessage_SignedQueryResponse:
+		return "query_response"
+	default:
+		return "other"
+	}
+}
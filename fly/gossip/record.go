@@ -0,0 +1,316 @@
+package gossip
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Recordings are a sequence of varint length prefixed protobuf messages with the following schema:
+//
+//	message GossipRecord {
+//	  int64  received_at_unix_nanos = 1;
+//	  bytes  from                   = 2; // libp2p peer ID of the author
+//	  string topic                  = 3;
+//	  bytes  data                   = 4; // serialized gossipv1.GossipMessage
+//	  bytes  received_from          = 5; // libp2p peer ID of the forwarding peer
+//	}
+//
+// Files may be gzip compressed, which is detected when reading.
+const (
+	recordFieldReceivedAt   = 1
+	recordFieldFrom         = 2
+	recordFieldTopic        = 3
+	recordFieldData         = 4
+	recordFieldReceivedFrom = 5
+
+	// maxRecordSize protects the reader from allocating absurd amounts of memory on a corrupt file.
+	maxRecordSize = 64 << 20
+
+	RecordingExt = ".gossip"
+)
+
+func marshalRecord(b []byte, e *Envelope) []byte {
+	b = protowire.AppendTag(b, recordFieldReceivedAt, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(e.ReceivedAt.UnixNano()))
+	b = protowire.AppendTag(b, recordFieldFrom, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte(e.From))
+	b = protowire.AppendTag(b, recordFieldTopic, protowire.BytesType)
+	b = protowire.AppendString(b, e.Topic)
+	b = protowire.AppendTag(b, recordFieldData, protowire.BytesType)
+	b = protowire.AppendBytes(b, e.Data)
+	if e.ReceivedFrom != "" {
+		b = protowire.AppendTag(b, recordFieldReceivedFrom, protowire.BytesType)
+		b = protowire.AppendBytes(b, []byte(e.ReceivedFrom))
+	}
+	return b
+}
+
+func unmarshalRecord(b []byte) (*Envelope, error) {
+	e := &Envelope{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == recordFieldReceivedAt && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			e.ReceivedAt = time.Unix(0, int64(v))
+			b = b[n:]
+		case (num == recordFieldFrom || num == recordFieldTopic || num == recordFieldData || num == recordFieldReceivedFrom) && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			switch num {
+			case recordFieldFrom:
+				e.From = peer.ID(v)
+			case recordFieldTopic:
+				e.Topic = string(v)
+			case recordFieldData:
+				e.Data = append([]byte(nil), v...)
+			case recordFieldReceivedFrom:
+				e.ReceivedFrom = peer.ID(v)
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return e, nil
+}
+
+type RecorderConfig struct {
+	// Dir is where the recordings are written. File names are Prefix plus the UTC time the file was opened.
+	Dir    string
+	Prefix string
+	// MaxBytes rotates the file once this many uncompressed bytes have been written to it. Zero disables it.
+	MaxBytes int64
+	// MaxAge rotates the file once it has been open for this long. Zero disables it.
+	MaxAge   time.Duration
+	Compress bool
+}
+
+// Recorder writes envelopes to a set of rotating files. It is safe for concurrent use.
+type Recorder struct {
+	mu  sync.Mutex
+	f   *rotatingFile
+	buf []byte
+}
+
+func NewRecorder(cfg RecorderConfig) (*Recorder, error) {
+	f, err := newRotatingFile(cfg.Dir, cfg.Prefix, RecordingExt, cfg.MaxBytes, cfg.MaxAge, cfg.Compress)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f}, nil
+}
+
+// Write appends an envelope to the current file, rotating it first if needed.
+func (r *Recorder) Write(e *Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf = marshalRecord(r.buf[:0], e)
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(r.buf)))
+	return r.f.write(lenBuf[:n], r.buf)
+}
+
+// Flush pushes buffered records to the file. Compressed files are only readable up to the last flush.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.flush()
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.close()
+}
+
+// rotatingFile is a buffered, optionally gzipped file that is replaced by a new one once it has grown too large or
+// been open too long. It is not safe for concurrent use.
+type rotatingFile struct {
+	dir      string
+	prefix   string
+	ext      string
+	maxBytes int64
+	maxAge   time.Duration
+	compress bool
+
+	f       *os.File
+	gz      *gzip.Writer
+	w       *bufio.Writer
+	opened  time.Time
+	written int64
+}
+
+func newRotatingFile(dir, prefix, ext string, maxBytes int64, maxAge time.Duration, compress bool) (*rotatingFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	rf := &rotatingFile{dir: dir, prefix: prefix, ext: ext, maxBytes: maxBytes, maxAge: maxAge, compress: compress}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	// Names have millisecond precision, so a file rotated within the same millisecond would collide with the previous one.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(rf.opened) {
+		now = rf.opened.Add(time.Millisecond)
+	}
+	name := rf.prefix + now.Format("20060102T150405.000Z") + rf.ext
+	if rf.compress {
+		name += ".gz"
+	}
+	f, err := os.OpenFile(filepath.Join(rf.dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	rf.f = f
+	rf.opened = now
+	rf.written = 0
+	if rf.compress {
+		rf.gz = gzip.NewWriter(f)
+		rf.w = bufio.NewWriter(rf.gz)
+	} else {
+		rf.gz = nil
+		rf.w = bufio.NewWriter(f)
+	}
+	return nil
+}
+
+func (rf *rotatingFile) closeFile() error {
+	err := rf.w.Flush()
+	if rf.gz != nil {
+		err = errors.Join(err, rf.gz.Close())
+	}
+	return errors.Join(err, rf.f.Close())
+}
+
+// write appends the chunks to the current file, rotating it first if needed.
+func (rf *rotatingFile) write(chunks ...[]byte) error {
+	if rf.f == nil {
+		return errors.New("file is closed")
+	}
+	if (rf.maxBytes > 0 && rf.written >= rf.maxBytes) || (rf.maxAge > 0 && time.Since(rf.opened) >= rf.maxAge) {
+		if err := rf.closeFile(); err != nil {
+			return fmt.Errorf("failed to close file: %w", err)
+		}
+		if err := rf.open(); err != nil {
+			rf.f = nil
+			return err
+		}
+	}
+	for _, c := range chunks {
+		if _, err := rf.w.Write(c); err != nil {
+			return err
+		}
+		rf.written += int64(len(c))
+	}
+	return nil
+}
+
+func (rf *rotatingFile) flush() error {
+	if rf.f == nil {
+		return nil
+	}
+	if err := rf.w.Flush(); err != nil {
+		return err
+	}
+	if rf.gz != nil {
+		return rf.gz.Flush()
+	}
+	return nil
+}
+
+func (rf *rotatingFile) close() error {
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.closeFile()
+	rf.f = nil
+	return err
+}
+
+// Reader reads envelopes from a recording.
+type Reader struct {
+	r  *bufio.Reader
+	gz *gzip.Reader
+}
+
+// NewReader wraps a recording, transparently decompressing it if needed.
+func NewReader(in io.Reader) (*Reader, error) {
+	r, gz, err := maybeGunzip(in)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, gz: gz}, nil
+}
+
+// maybeGunzip decompresses in if it starts with the gzip magic number. The gzip reader is nil otherwise.
+func maybeGunzip(in io.Reader) (*bufio.Reader, *gzip.Reader, error) {
+	br := bufio.NewReader(in)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		return bufio.NewReader(gz), gz, nil
+	}
+	return br, nil, nil
+}
+
+// Next returns the next envelope, or io.EOF at the end of the recording. The message is decoded if possible.
+func (r *Reader) Next() (*Envelope, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("record of %d bytes exceeds the maximum size", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return unmarshalRecord(buf)
+}
+
+func (r *Reader) Close() error {
+	if r.gz != nil {
+		return r.gz.Close()
+	}
+	return nil
+}
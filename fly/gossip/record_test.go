@@ -0,0 +1,147 @@
+package gossip_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/gossip/gossiptest"
+	"go.uber.org/zap"
+)
+
+func testEnvelopes(t *testing.T, n int) []*gossip.Envelope {
+	g := gossiptest.NewGuardian(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	envelopes := make([]*gossip.Envelope, 0, n)
+	for i := 0; i < n; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		if i%2 == 0 {
+			hb := g.Heartbeat(t, &gossipv1.Heartbeat{NodeName: "test", Counter: int64(i), Timestamp: at.UnixNano()})
+			envelopes = append(envelopes, gossiptest.Envelope(t, g.Peer, "control", at, hb))
+		} else {
+			o := g.Observation(t, fmt.Sprintf("2/%064x/%d", 1, i), bytes.Repeat([]byte{byte(i)}, 32))
+			envelopes = append(envelopes, gossiptest.Envelope(t, g.Peer, "attestation", at, g.ObservationBatch(o)))
+		}
+	}
+	return envelopes
+}
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%t", compress), func(t *testing.T) {
+			dir := t.TempDir()
+			// Small enough to rotate every few records.
+			r, err := gossip.NewRecorder(gossip.RecorderConfig{Dir: dir, Prefix: "test-", MaxBytes: 1024, Compress: compress})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := testEnvelopes(t, 40)
+			for _, e := range want {
+				if err := r.Write(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := gossip.ExpandRecordings(filepath.Join(dir, "test-*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) < 2 {
+				t.Fatalf("recording was not rotated: %v", files)
+			}
+			for _, f := range files {
+				if gz := filepath.Ext(f) == ".gz"; gz != compress {
+					t.Errorf("%s: compressed is %t, want %t", f, gz, compress)
+				}
+			}
+
+			var got []*gossip.Envelope
+			err = gossip.Replay(context.Background(), zap.NewNop(), files, 0, func(_ context.Context, e *gossip.Envelope) {
+				got = append(got, e)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("replayed %d envelopes, want %d", len(got), len(want))
+			}
+			for i := range want {
+				w, g := want[i], got[i]
+				if !g.ReceivedAt.Equal(w.ReceivedAt) || g.From != w.From || g.ReceivedFrom != w.ReceivedFrom || g.Topic != w.Topic || !bytes.Equal(g.Data, w.Data) {
+					t.Errorf("envelope %d = %+v, want %+v", i, g, w)
+				}
+				if wantType := map[string]string{"control": "heartbeat", "attestation": "observation_batch"}[w.TopicName()]; g.MessageType() != wantType {
+					t.Errorf("envelope %d decoded as %s, want %s", i, g.MessageType(), wantType)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayStopsAtTruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	r, err := gossip.NewRecorder(gossip.RecorderConfig{Dir: dir, Prefix: "test-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testEnvelopes(t, 3)
+	for _, e := range want {
+		if err := r.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := gossip.ExpandRecordings(filepath.Join(dir, "test-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the last record short, as a recorder that was killed would leave it.
+	info, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(files[0], info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	var got int
+	err = gossip.Replay(context.Background(), zap.NewNop(), files, 0, func(context.Context, *gossip.Envelope) { got++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != len(want)-1 {
+		t.Errorf("replayed %d envelopes, want %d", got, len(want)-1)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	want := testEnvelopes(t, 3) // 2s of recording
+	path := gossiptest.WriteRecording(t, want...)
+
+	start := time.Now()
+	err := gossip.Replay(context.Background(), zap.NewNop(), []string{path}, 20, func(context.Context, *gossip.Envelope) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("replaying 2s at 20x took %s, want at least 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gossip.Replay(ctx, zap.NewNop(), []string{path}, 1, func(context.Context, *gossip.Envelope) {}); err != context.Canceled {
+		t.Errorf("replay with a cancelled context returned %v, want %v", err, context.Canceled)
+	}
+}
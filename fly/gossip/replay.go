@@ -0,0 +1,92 @@
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ExpandRecordings turns a comma separated list of files and glob patterns into the list of files to replay.
+// The matches of each pattern are sorted, which puts rotated recordings in chronological order.
+func ExpandRecordings(spec string) ([]string, error) {
+	var files []string
+	for _, pattern := range strings.Split(spec, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no recordings match %q", pattern)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// Replay feeds the recorded envelopes to handle, in order. A speed of 1 reproduces the original timing,
+// 10 plays ten times faster, and 0 or less plays as fast as handle accepts the messages.
+// The envelopes keep their recorded receive time.
+func Replay(ctx context.Context, logger *zap.Logger, files []string, speed float64, handle Handler) error {
+	var firstRecorded, wallStart time.Time
+	for _, file := range files {
+		logger.Info("replaying recording", zap.String("file", file))
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		r, err := NewReader(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for {
+			e, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// A recorder that was killed can leave a partial record at the end of the file.
+				logger.Warn("stopped reading recording early", zap.String("file", file), zap.Error(err))
+				break
+			}
+			if speed > 0 {
+				if firstRecorded.IsZero() {
+					firstRecorded = e.ReceivedAt
+					wallStart = time.Now()
+				}
+				due := wallStart.Add(time.Duration(float64(e.ReceivedAt.Sub(firstRecorded)) / speed))
+				if wait := time.Until(due); wait > 0 {
+					select {
+					case <-ctx.Done():
+						r.Close()
+						f.Close()
+						return ctx.Err()
+					case <-time.After(wait):
+					}
+				}
+			}
+			if ctx.Err() != nil {
+				r.Close()
+				f.Close()
+				return ctx.Err()
+			}
+			e.decode(logger)
+			handle(ctx, e)
+		}
+		r.Close()
+		f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package gossip
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"go.uber.org/zap"
+)
+
+// TraceExt is the extension of the trace files, which hold one JSON TraceEvent per line.
+const TraceExt = ".trace.jsonl"
+
+// Types of trace events.
+const (
+	TraceAddPeer       = "add_peer"
+	TraceRemovePeer    = "remove_peer"
+	TraceJoin          = "join"
+	TraceLeave         = "leave"
+	TraceGraft         = "graft"
+	TracePrune         = "prune"
+	TraceDeliver       = "deliver"
+	TraceReject        = "reject"
+	TraceDuplicate     = "duplicate"
+	TraceThrottle      = "throttle"
+	TraceUndeliverable = "undeliverable"
+)
+
+// TraceEvent is a pubsub event concerning the mesh or a message.
+type TraceEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// Peer is the remote peer of peer and mesh events, and the peer a message was received from.
+	Peer string `json:"peer,omitempty"`
+	// Protocol is the pubsub protocol a peer was added with.
+	Protocol string `json:"protocol,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+	// Author is the peer that published a message, which is not necessarily the one that forwarded it to us.
+	Author string `json:"author,omitempty"`
+	// MsgID is the hex encoded pubsub message ID.
+	MsgID string `json:"msg_id,omitempty"`
+	Size  int    `json:"size,omitempty"`
+	// Reason is why a message was rejected, e.g. "validation failed".
+	Reason string `json:"reason,omitempty"`
+}
+
+// TraceConfig configures the files a Tracer writes to. They rotate like recordings, and are read back with a
+// TraceReader, e.g. by cmd/summarize_trace.
+type TraceConfig struct {
+	// Dir is where the traces are written. File names are Prefix plus the UTC time the file was opened.
+	Dir    string
+	Prefix string
+	// MaxBytes rotates the file once this many uncompressed bytes have been written to it. Zero disables it.
+	MaxBytes int64
+	// MaxAge rotates the file once it has been open for this long. Zero disables it.
+	MaxAge   time.Duration
+	Compress bool
+	// FlushInterval defaults to 5 seconds.
+	FlushInterval time.Duration
+}
+
+// Tracer is a pubsub.RawTracer that writes the graft/prune, peer, delivery, rejection and duplicate events to
+// a set of rotating JSON lines files. Validation and RPC events are not written, they are too frequent to be useful.
+type Tracer struct {
+	logger *zap.Logger
+
+	mu sync.Mutex
+	f  *rotatingFile
+	// failed stops the tracer from logging every event once the file can't be written.
+	failed bool
+}
+
+var _ pubsub.RawTracer = (*Tracer)(nil)
+
+// NewTracer opens the first trace file and flushes it periodically until the context is cancelled.
+func NewTracer(ctx context.Context, logger *zap.Logger, cfg TraceConfig) (*Tracer, error) {
+	f, err := newRotatingFile(cfg.Dir, cfg.Prefix, TraceExt, cfg.MaxBytes, cfg.MaxAge, cfg.Compress)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tracer{logger: logger, f: f}
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					logger.Error("failed to flush trace", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return t, nil
+}
+
+func (t *Tracer) write(ev TraceEvent) {
+	ev.Time = time.Now()
+	b, err := json.Marshal(ev)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f.f == nil {
+		// Closed, pubsub may still report the peers leaving as the host shuts down.
+		return
+	}
+	if err == nil {
+		err = t.f.write(b, []byte{'\n'})
+	}
+	if err != nil && !t.failed {
+		t.failed = true
+		t.logger.Error("failed to write trace event, dropping further events", zap.Error(err))
+	}
+}
+
+func (t *Tracer) message(typ string, msg *pubsub.Message, reason string) {
+	t.write(TraceEvent{
+		Type:   typ,
+		Peer:   msg.ReceivedFrom.String(),
+		Topic:  msg.GetTopic(),
+		Author: msg.GetFrom().String(),
+		MsgID:  hex.EncodeToString([]byte(msg.ID)),
+		Size:   len(msg.Data),
+		Reason: reason,
+	})
+}
+
+// Flush pushes buffered events to the file. Compressed files are only readable up to the last flush.
+func (t *Tracer) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.f.flush()
+}
+
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.f.close()
+}
+
+func (t *Tracer) AddPeer(p peer.ID, proto protocol.ID) {
+	t.write(TraceEvent{Type: TraceAddPeer, Peer: p.String(), Protocol: string(proto)})
+}
+
+func (t *Tracer) RemovePeer(p peer.ID) {
+	t.write(TraceEvent{Type: TraceRemovePeer, Peer: p.String()})
+}
+
+func (t *Tracer) Join(topic string)  { t.write(TraceEvent{Type: TraceJoin, Topic: topic}) }
+func (t *Tracer) Leave(topic string) { t.write(TraceEvent{Type: TraceLeave, Topic: topic}) }
+
+func (t *Tracer) Graft(p peer.ID, topic string) {
+	t.write(TraceEvent{Type: TraceGraft, Peer: p.String(), Topic: topic})
+}
+
+func (t *Tracer) Prune(p peer.ID, topic string) {
+	t.write(TraceEvent{Type: TracePrune, Peer: p.String(), Topic: topic})
+}
+
+func (t *Tracer) DeliverMessage(msg *pubsub.Message) { t.message(TraceDeliver, msg, "") }
+func (t *Tracer) RejectMessage(msg *pubsub.Message, reason string) {
+	t.message(TraceReject, msg, reason)
+}
+func (t *Tracer) DuplicateMessage(msg *pubsub.Message) { t.message(TraceDuplicate, msg, "") }
+func (t *Tracer) UndeliverableMessage(msg *pubsub.Message) {
+	t.message(TraceUndeliverable, msg, "")
+}
+
+func (t *Tracer) ThrottlePeer(p peer.ID) {
+	t.write(TraceEvent{Type: TraceThrottle, Peer: p.String()})
+}
+
+func (t *Tracer) ValidateMessage(*pubsub.Message) {}
+func (t *Tracer) RecvRPC(*pubsub.RPC)             {}
+func (t *Tracer) SendRPC(*pubsub.RPC, peer.ID)    {}
+func (t *Tracer) DropRPC(*pubsub.RPC, peer.ID)    {}
+
+// TraceReader reads the events of a trace file.
+type TraceReader struct {
+	dec *json.Decoder
+	gz  *gzip.Reader
+}
+
+// NewTraceReader wraps a trace file, transparently decompressing it if needed.
+func NewTraceReader(in io.Reader) (*TraceReader, error) {
+	r, gz, err := maybeGunzip(in)
+	if err != nil {
+		return nil, err
+	}
+	return &TraceReader{dec: json.NewDecoder(r), gz: gz}, nil
+}
+
+// Next returns the next event, or io.EOF at the end of the trace.
+func (r *TraceReader) Next() (*TraceEvent, error) {
+	var ev TraceEvent
+	if err := r.dec.Decode(&ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+func (r *TraceReader) Close() error {
+	if r.gz != nil {
+		return r.gz.Close()
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Package metrics exposes the Prometheus metrics of a fly command, on a scrape endpoint and/or by pushing them to
+// a remote-write endpoint, together with the process and Go runtime metrics.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	promremotew "github.com/certusone/wormhole/node/pkg/telemetry/prom_remote_write"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// Config selects how metrics are exposed. Both the scrape endpoint and the remote-write push are optional.
+type Config struct {
+	// ListenAddr serves /metrics, e.g. ":2112". Empty disables the endpoint.
+	ListenAddr string
+	// RemoteWriteURL is the Prometheus remote-write endpoint metrics are pushed to. Empty disables pushing.
+	RemoteWriteURL string
+	// RemoteWriteInterval defaults to 15 seconds.
+	RemoteWriteInterval time.Duration
+	// Labels are added to every pushed sample, as comma separated key=value pairs.
+	Labels string
+}
+
+// RegisterFlags binds the config to --metricsAddr, --promRemoteURL, --promRemoteInterval and --promRemoteLabels.
+func (c *Config) RegisterFlags(fs *flag.FlagSet, defaultListenAddr string) {
+	fs.StringVar(&c.ListenAddr, "metricsAddr", defaultListenAddr, `Address the Prometheus /metrics endpoint listens on, e.g. ":2112" (empty to disable)`)
+	fs.StringVar(&c.RemoteWriteURL, "promRemoteURL", "", "Prometheus remote-write URL to push metrics to (empty to disable)")
+	fs.DurationVar(&c.RemoteWriteInterval, "promRemoteInterval", 15*time.Second, "How often metrics are pushed to --promRemoteURL")
+	fs.StringVar(&c.Labels, "promRemoteLabels", "", "Comma separated key=value labels added to the pushed metrics")
+}
+
+// ConfigFromEnv reads METRICS_ADDR, PROM_REMOTE_URL, PROM_REMOTE_INTERVAL and PROM_REMOTE_LABELS,
+// for the commands that are configured through their environment.
+func ConfigFromEnv() (Config, error) {
+	c := Config{
+		ListenAddr:     os.Getenv("METRICS_ADDR"),
+		RemoteWriteURL: os.Getenv("PROM_REMOTE_URL"),
+		Labels:         os.Getenv("PROM_REMOTE_LABELS"),
+	}
+	if s := os.Getenv("PROM_REMOTE_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid PROM_REMOTE_INTERVAL: %w", err)
+		}
+		c.RemoteWriteInterval = d
+	}
+	return c, nil
+}
+
+// ParseLabels parses comma separated key=value pairs. A key can only be given once.
+func ParseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		k = strings.TrimSpace(k)
+		if _, ok := labels[k]; ok {
+			return nil, fmt.Errorf("duplicate label %q", k)
+		}
+		labels[k] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
+
+// Start exposes the metrics of the default registry as configured. The product label identifies the command in
+// pushed metrics. Extra handlers are served next to /metrics. It returns an error if the listen address can't be
+// bound, and otherwise serves and pushes in the background until the context is cancelled.
+func Start(ctx context.Context, logger *zap.Logger, cfg Config, product string, handlers map[string]http.Handler) error {
+	registerRuntimeCollectors()
+
+	if cfg.RemoteWriteURL != "" {
+		labels, err := pushLabels(cfg.Labels, product)
+		if err != nil {
+			return err
+		}
+		interval := cfg.RemoteWriteInterval
+		if interval <= 0 {
+			interval = 15 * time.Second
+		}
+		go push(ctx, logger.With(zap.String("component", "prometheus_remote_write")), promremotew.PromTelemetryInfo{
+			PromRemoteURL: cfg.RemoteWriteURL,
+			Labels:        labels,
+		}, interval)
+	}
+
+	if cfg.ListenAddr == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s for metrics: %w", cfg.ListenAddr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	for pattern, h := range handlers {
+		mux.Handle(pattern, h)
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server failed", zap.Error(err))
+		}
+	}()
+	logger.Info("serving metrics", zap.String("addr", ln.Addr().String()))
+	return nil
+}
+
+// pushLabels returns the labels added to the pushed metrics: the configured ones, and product unless they set it.
+func pushLabels(labels string, product string) (map[string]string, error) {
+	l, err := ParseLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := l["product"]; !ok {
+		l["product"] = product
+	}
+	return l, nil
+}
+
+func push(ctx context.Context, logger *zap.Logger, info promremotew.PromTelemetryInfo, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := promremotew.ScrapeAndSendLocalMetrics(ctx, info, logger); err != nil {
+				// Keep trying, the endpoint may come back.
+				logger.Error("ScrapeAndSendLocalMetrics error", zap.Error(err))
+			}
+		}
+	}
+}
+
+// registerRuntimeCollectors replaces the default Go collector with one that also exports the scheduler and GC
+// runtime metrics, and makes sure the process and build info collectors are registered.
+func registerRuntimeCollectors() {
+	prometheus.Unregister(collectors.NewGoCollector())
+	for _, c := range []prometheus.Collector{
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsScheduler, collectors.MetricsGC)),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewBuildInfoCollector(),
+	} {
+		if err := prometheus.Register(c); err != nil {
+			var are prometheus.AlreadyRegisteredError
+			if !errors.As(err, &are) {
+				panic(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: map[string]string{}},
+		{name: "only separators", in: " , ,", want: map[string]string{}},
+		{name: "pairs", in: "network=mainnet, instance = a", want: map[string]string{"network": "mainnet", "instance": "a"}},
+		{name: "empty value", in: "instance=", want: map[string]string{"instance": ""}},
+		{name: "value with an equal sign", in: "q=a=b", want: map[string]string{"q": "a=b"}},
+		{name: "duplicate", in: "network=mainnet,network=testnet", wantErr: true},
+		{name: "duplicate after trimming", in: "network=mainnet, network =testnet", wantErr: true},
+		{name: "missing value", in: "network", wantErr: true},
+		{name: "missing key", in: "=mainnet", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabels(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLabels(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if !equalLabels(got, tt.want) {
+				t.Errorf("ParseLabels(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "default product", labels: "network=mainnet", want: map[string]string{"network": "mainnet", "product": "fly"}},
+		{name: "product override", labels: "product=fly-canary", want: map[string]string{"product": "fly-canary"}},
+		{name: "invalid labels", labels: "network", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pushLabels(tt.labels, "fly")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pushLabels(%q) error = %v, want error %v", tt.labels, err, tt.wantErr)
+			}
+			if !equalLabels(got, tt.want) {
+				t.Errorf("pushLabels(%q) = %v, want %v", tt.labels, got, tt.want)
+			}
+		})
+	}
+}
+
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("METRICS_ADDR", ":2112")
+	t.Setenv("PROM_REMOTE_URL", "https://prom.example/api/v1/write")
+	t.Setenv("PROM_REMOTE_LABELS", "network=mainnet")
+	t.Setenv("PROM_REMOTE_INTERVAL", "30s")
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{ListenAddr: ":2112", RemoteWriteURL: "https://prom.example/api/v1/write", RemoteWriteInterval: 30 * time.Second, Labels: "network=mainnet"}
+	if c != want {
+		t.Errorf("ConfigFromEnv() = %+v, want %+v", c, want)
+	}
+
+	// The interval is optional, Start falls back to its default.
+	t.Setenv("PROM_REMOTE_INTERVAL", "")
+	if c, err := ConfigFromEnv(); err != nil || c.RemoteWriteInterval != 0 {
+		t.Errorf("ConfigFromEnv() without an interval = %+v, %v", c, err)
+	}
+
+	t.Setenv("PROM_REMOTE_INTERVAL", "30")
+	if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "PROM_REMOTE_INTERVAL") {
+		t.Errorf("ConfigFromEnv() with an invalid interval error = %v, want one naming PROM_REMOTE_INTERVAL", err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Find a free port.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	handlers := map[string]http.Handler{"/hello": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})}
+	if err := Start(ctx, zap.NewNop(), Config{ListenAddr: addr}, "test", handlers); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"/metrics": "go_gc_duration_seconds", "/hello": "hello"} {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("GET %s = %d, want 200 with %q", path, resp.StatusCode, want)
+		}
+	}
+
+	// The port is now in use.
+	err = Start(ctx, zap.NewNop(), Config{ListenAddr: addr}, "test", nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to listen on "+addr) {
+		t.Errorf("Start on a port in use error = %v, want a listen error", err)
+	}
+}
+
+func TestStartInvalidLabels(t *testing.T) {
+	err := Start(context.Background(), zap.NewNop(), Config{RemoteWriteURL: "http://127.0.0.1:1", Labels: "network"}, "test", nil)
+	if err == nil {
+		t.Error("Start with invalid labels succeeded")
+	}
+}
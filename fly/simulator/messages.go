@@ -0,0 +1,287 @@
+package simulator
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	eth_crypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// blocksPerHeartbeat is how far healthy chains advance between heartbeats.
+	blocksPerHeartbeat = 10
+
+	defaultNotionalLimit      = 50_000_000
+	defaultBigTransactionSize = 5_000_000
+)
+
+var (
+	heartbeatMessagePrefix      = []byte("heartbeat|")
+	governorConfigMessagePrefix = []byte("governor_config_000000000000000000|")
+	governorStatusMessagePrefix = []byte("governor_status_000000000000000000|")
+)
+
+type enqueuedVAA struct {
+	sequence      uint64
+	releaseTime   time.Time
+	notionalValue uint64
+}
+
+func sign(g *guardian, prefix, data []byte) ([]byte, error) {
+	digest := eth_crypto.Keccak256Hash(append(append([]byte(nil), prefix...), data...))
+	return eth_crypto.Sign(digest.Bytes(), g.key)
+}
+
+func (n *Network) publishHeartbeats() {
+	n.mu.Lock()
+	for _, c := range n.cfg.Chains {
+		if !n.stalledChains[c] {
+			n.heights[c] += blocksPerHeartbeat
+		}
+	}
+	active, _ := n.activeGuardians()
+	type signed struct {
+		g    *guardian
+		data []byte
+	}
+	msgs := make([]signed, 0, len(active))
+	now := time.Now()
+	for _, g := range active {
+		g.counter++
+		networks := make([]*gossipv1.Heartbeat_Network, 0, len(n.cfg.Chains))
+		for _, c := range n.cfg.Chains {
+			// A guardian whose watcher is stalled keeps reporting its last height, with a growing error count.
+			if !g.stalled[c] {
+				g.heights[c] = n.heights[c]
+			} else {
+				g.errorCounts[c]++
+			}
+			networks = append(networks, &gossipv1.Heartbeat_Network{
+				Id:              uint32(c),
+				Height:          g.heights[c],
+				SafeHeight:      g.heights[c],
+				FinalizedHeight: g.heights[c],
+				ErrorCount:      g.errorCounts[c],
+				ContractAddress: "simulated",
+			})
+		}
+		hb := &gossipv1.Heartbeat{
+			NodeName:      g.name,
+			Counter:       g.counter,
+			Timestamp:     now.UnixNano(),
+			Networks:      networks,
+			Version:       n.cfg.Version,
+			GuardianAddr:  g.addr.Hex(),
+			BootTimestamp: g.bootTime.UnixNano(),
+			Features:      []string{"simulator"},
+			P2PNodeId:     []byte(g.host.ID()),
+		}
+		data, err := proto.Marshal(hb)
+		if err != nil {
+			n.logger.Error("failed to marshal heartbeat", zap.Error(err))
+			continue
+		}
+		sig, err := sign(g, heartbeatMessagePrefix, data)
+		if err != nil {
+			n.logger.Error("failed to sign heartbeat", zap.Error(err))
+			continue
+		}
+		msg, err := proto.Marshal(&gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedHeartbeat{
+			SignedHeartbeat: &gossipv1.SignedHeartbeat{Heartbeat: data, Signature: sig, GuardianAddr: g.addr.Bytes()},
+		}})
+		if err != nil {
+			n.logger.Error("failed to marshal gossip message", zap.Error(err))
+			continue
+		}
+		msgs = append(msgs, signed{g, msg})
+	}
+	n.mu.Unlock()
+
+	for _, m := range msgs {
+		n.publish(m.g, topicControl, m.data)
+	}
+}
+
+// EmitMessage has every active guardian that isn't stalled on the chain observe a new message. If enough of them
+// do, a quorum VAA is published as well. It returns the message ID.
+func (n *Network) EmitMessage(chain vaa.ChainID, emitter vaa.Address, payload []byte) (string, error) {
+	n.mu.Lock()
+	if n.stalledChains[chain] {
+		n.mu.Unlock()
+		return "", fmt.Errorf("chain %s is stalled", chain)
+	}
+	n.sequences[chain]++
+	v := &vaa.VAA{
+		Version:          vaa.SupportedVAAVersion,
+		GuardianSetIndex: n.setIndex,
+		Timestamp:        time.Now().Truncate(time.Second),
+		Nonce:            0,
+		Sequence:         n.sequences[chain],
+		ConsistencyLevel: 1,
+		EmitterChain:     chain,
+		EmitterAddress:   emitter,
+		Payload:          payload,
+	}
+	active, setIdx := n.activeGuardians()
+	var observers []*guardian
+	var observerIdx []int
+	for i, g := range active {
+		if !g.stalled[chain] {
+			observers = append(observers, g)
+			observerIdx = append(observerIdx, setIdx[i])
+		}
+	}
+	quorum := vaa.CalculateQuorum(len(n.members))
+	n.mu.Unlock()
+
+	digest := v.SigningDigest()
+	txHash := make([]byte, 32)
+	if _, err := rand.Read(txHash); err != nil {
+		return "", err
+	}
+	for i, g := range observers {
+		sig, err := eth_crypto.Sign(digest.Bytes(), g.key)
+		if err != nil {
+			return "", err
+		}
+		msg, err := proto.Marshal(&gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedObservationBatch{
+			SignedObservationBatch: &gossipv1.SignedObservationBatch{
+				Addr: g.addr.Bytes(),
+				Observations: []*gossipv1.Observation{{
+					Hash:      digest.Bytes(),
+					Signature: sig,
+					TxHash:    txHash,
+					MessageId: v.MessageID(),
+				}},
+			},
+		}})
+		if err != nil {
+			return "", err
+		}
+		if n.cfg.ObservationDelay > 0 && i > 0 {
+			select {
+			case <-n.ctx.Done():
+				return "", n.ctx.Err()
+			case <-time.After(n.cfg.ObservationDelay):
+			}
+		}
+		n.publish(g, topicAttestation, msg)
+	}
+
+	if len(observers) < quorum {
+		return v.MessageID(), nil
+	}
+	for i := 0; i < quorum; i++ {
+		v.AddSignature(observers[i].key, uint8(observerIdx[i]))
+	}
+	b, err := v.Marshal()
+	if err != nil {
+		return "", err
+	}
+	msg, err := proto.Marshal(&gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedVaaWithQuorum{
+		SignedVaaWithQuorum: &gossipv1.SignedVAAWithQuorum{Vaa: b},
+	}})
+	if err != nil {
+		return "", err
+	}
+	n.publish(observers[0], topicVAA, msg)
+	return v.MessageID(), nil
+}
+
+func (n *Network) publishGovernor() {
+	n.mu.Lock()
+	active, _ := n.activeGuardians()
+	now := time.Now()
+
+	cfgChains := make([]*gossipv1.ChainGovernorConfig_Chain, 0, len(n.cfg.Chains))
+	statusChains := make([]*gossipv1.ChainGovernorStatus_Chain, 0, len(n.cfg.Chains))
+	for _, c := range n.cfg.Chains {
+		cfgChains = append(cfgChains, &gossipv1.ChainGovernorConfig_Chain{
+			ChainId:            uint32(c),
+			NotionalLimit:      defaultNotionalLimit,
+			BigTransactionSize: defaultBigTransactionSize,
+		})
+		var enqueued []*gossipv1.ChainGovernorStatus_EnqueuedVAA
+		for _, e := range n.govQueue[c] {
+			enqueued = append(enqueued, &gossipv1.ChainGovernorStatus_EnqueuedVAA{
+				Sequence:      e.sequence,
+				ReleaseTime:   uint32(e.releaseTime.Unix()),
+				NotionalValue: e.notionalValue,
+			})
+		}
+		var emitters []*gossipv1.ChainGovernorStatus_Emitter
+		if len(enqueued) > 0 {
+			emitters = append(emitters, &gossipv1.ChainGovernorStatus_Emitter{
+				EmitterAddress:    DefaultEmitter.String(),
+				TotalEnqueuedVaas: uint64(len(enqueued)),
+				EnqueuedVaas:      enqueued,
+			})
+		}
+		statusChains = append(statusChains, &gossipv1.ChainGovernorStatus_Chain{
+			ChainId:                    uint32(c),
+			RemainingAvailableNotional: n.notional[c],
+			Emitters:                   emitters,
+		})
+	}
+
+	type signed struct {
+		g    *guardian
+		data []byte
+	}
+	var msgs []signed
+	for _, g := range active {
+		cfg, err := proto.Marshal(&gossipv1.ChainGovernorConfig{
+			NodeName:  g.name,
+			Counter:   g.counter,
+			Timestamp: now.UnixNano(),
+			Chains:    cfgChains,
+		})
+		if err != nil {
+			n.logger.Error("failed to marshal governor config", zap.Error(err))
+			continue
+		}
+		cfgSig, err := sign(g, governorConfigMessagePrefix, cfg)
+		if err != nil {
+			n.logger.Error("failed to sign governor config", zap.Error(err))
+			continue
+		}
+		status, err := proto.Marshal(&gossipv1.ChainGovernorStatus{
+			NodeName:  g.name,
+			Counter:   g.counter,
+			Timestamp: now.UnixNano(),
+			Chains:    statusChains,
+		})
+		if err != nil {
+			n.logger.Error("failed to marshal governor status", zap.Error(err))
+			continue
+		}
+		statusSig, err := sign(g, governorStatusMessagePrefix, status)
+		if err != nil {
+			n.logger.Error("failed to sign governor status", zap.Error(err))
+			continue
+		}
+		cfgMsg, err := proto.Marshal(&gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedChainGovernorConfig{
+			SignedChainGovernorConfig: &gossipv1.SignedChainGovernorConfig{Config: cfg, Signature: cfgSig, GuardianAddr: g.addr.Bytes()},
+		}})
+		if err != nil {
+			continue
+		}
+		statusMsg, err := proto.Marshal(&gossipv1.GossipMessage{Message: &gossipv1.GossipMessage_SignedChainGovernorStatus{
+			SignedChainGovernorStatus: &gossipv1.SignedChainGovernorStatus{Status: status, Signature: statusSig, GuardianAddr: g.addr.Bytes()},
+		}})
+		if err != nil {
+			continue
+		}
+		msgs = append(msgs, signed{g, cfgMsg}, signed{g, statusMsg})
+	}
+	n.mu.Unlock()
+
+	for _, m := range msgs {
+		n.publish(m.g, topicControl, m.data)
+	}
+}
@@ -0,0 +1,334 @@
+// Package simulator runs a fake guardian network in-process, on loopback, for end-to-end tests of the fly tools.
+//
+// The simulated guardians use the deterministic devnet keys (matching common.DevnetGuardians), sign real heartbeats,
+// observation batches, quorum VAAs and governor messages, and publish them on the real topic names. A consumer
+// connects to it like to any other network, using NetworkID and Bootstrap, and the guardian set from GuardianSet.
+package simulator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	"github.com/certusone/wormhole/node/pkg/devnet"
+	"github.com/certusone/wormhole/node/pkg/p2p"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	eth_crypto "github.com/ethereum/go-ethereum/crypto"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/common"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+)
+
+const (
+	topicControl     = "control"
+	topicAttestation = "attestation"
+	topicVAA         = "vaa"
+)
+
+type Config struct {
+	Logger *zap.Logger
+	// NetworkID defaults to "/wormhole/dev".
+	NetworkID string
+	// NumGuardians is the size of the initial guardian set, which uses the first devnet keys.
+	// It defaults to len(common.DevnetGuardians).
+	NumGuardians int
+	// Chains reported in heartbeats and governor messages. Defaults to Solana and Ethereum.
+	Chains []vaa.ChainID
+	// HeartbeatInterval defaults to one second.
+	HeartbeatInterval time.Duration
+	// GovernorInterval defaults to five seconds.
+	GovernorInterval time.Duration
+	// MessageInterval emits a message on every chain at this interval. Zero disables automatic messages.
+	MessageInterval time.Duration
+	// ObservationDelay is added per guardian index before a guardian publishes its observation,
+	// so that guardians observe in a predictable order. Zero publishes them all at once.
+	ObservationDelay time.Duration
+	// Version is reported in heartbeats. Defaults to "simulator".
+	Version string
+}
+
+// DefaultEmitter is the emitter address used for automatically emitted messages.
+var DefaultEmitter = vaa.Address{31: 0x04}
+
+type guardian struct {
+	keyIndex int
+	name     string
+	key      *ecdsa.PrivateKey
+	addr     eth_common.Address
+	// ctx is cancelled to stop the pubsub router of the guardian.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	host     host.Host
+	topics   map[string]*pubsub.Topic
+	bootTime time.Time
+
+	// The following are protected by Network.mu.
+	counter     int64
+	silent      bool
+	stalled     map[vaa.ChainID]bool
+	heights     map[vaa.ChainID]int64
+	errorCounts map[vaa.ChainID]uint64
+}
+
+// Network is a running set of simulated guardians.
+type Network struct {
+	cfg    Config
+	logger *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	bootstrap string
+
+	mu sync.Mutex
+	// guardians holds every guardian host started so far, by devnet key index.
+	guardians map[int]*guardian
+	// members are the devnet key indices of the current guardian set, in guardian set order.
+	members       []int
+	setIndex      uint32
+	stalledChains map[vaa.ChainID]bool
+	heights       map[vaa.ChainID]int64
+	sequences     map[vaa.ChainID]uint64
+	govQueue      map[vaa.ChainID][]enqueuedVAA
+	notional      map[vaa.ChainID]uint64
+}
+
+// Start launches the initial guardian set. Close must be called to release the hosts.
+func Start(ctx context.Context, cfg Config) (*Network, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	if cfg.NetworkID == "" {
+		cfg.NetworkID = "/wormhole/dev"
+	}
+	if cfg.NumGuardians == 0 {
+		cfg.NumGuardians = len(common.DevnetGuardians)
+	}
+	if len(cfg.Chains) == 0 {
+		cfg.Chains = []vaa.ChainID{vaa.ChainIDSolana, vaa.ChainIDEthereum}
+	}
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = time.Second
+	}
+	if cfg.GovernorInterval == 0 {
+		cfg.GovernorInterval = 5 * time.Second
+	}
+	if cfg.Version == "" {
+		cfg.Version = "simulator"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	n := &Network{
+		cfg:           cfg,
+		logger:        cfg.Logger,
+		ctx:           ctx,
+		cancel:        cancel,
+		guardians:     map[int]*guardian{},
+		stalledChains: map[vaa.ChainID]bool{},
+		heights:       map[vaa.ChainID]int64{},
+		sequences:     map[vaa.ChainID]uint64{},
+		govQueue:      map[vaa.ChainID][]enqueuedVAA{},
+		notional:      map[vaa.ChainID]uint64{},
+	}
+	for _, c := range cfg.Chains {
+		n.heights[c] = 1000
+		n.notional[c] = defaultNotionalLimit
+	}
+
+	members := make([]int, cfg.NumGuardians)
+	for i := range members {
+		members[i] = i
+		if _, err := n.startGuardian(i); err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+	n.members = members
+
+	n.wg.Add(2)
+	go n.loop(cfg.HeartbeatInterval, n.publishHeartbeats)
+	go n.loop(cfg.GovernorInterval, n.publishGovernor)
+	if cfg.MessageInterval > 0 {
+		n.wg.Add(1)
+		go n.loop(cfg.MessageInterval, func() {
+			for _, c := range n.cfg.Chains {
+				if _, err := n.EmitMessage(c, DefaultEmitter, []byte("simulated")); err != nil {
+					n.logger.Debug("failed to emit message", zap.Stringer("chain", c), zap.Error(err))
+				}
+			}
+		})
+	}
+	return n, nil
+}
+
+// startGuardian starts the host of the guardian using the devnet key with the given index.
+// The first guardian started is the bootstrap peer of the others.
+func (n *Network) startGuardian(keyIndex int) (*guardian, error) {
+	key := devnet.InsecureDeterministicEcdsaKeyByIndex(eth_crypto.S256(), uint64(keyIndex))
+	g := &guardian{
+		keyIndex:    keyIndex,
+		name:        fmt.Sprintf("guardian-%d", keyIndex),
+		key:         key,
+		addr:        eth_crypto.PubkeyToAddress(key.PublicKey),
+		topics:      map[string]*pubsub.Topic{},
+		bootTime:    time.Now(),
+		stalled:     map[vaa.ChainID]bool{},
+		heights:     map[vaa.ChainID]int64{},
+		errorCounts: map[vaa.ChainID]uint64{},
+	}
+	if keyIndex < len(common.DevnetGuardians) {
+		expected := eth_common.HexToAddress(common.DevnetGuardians[keyIndex].Address)
+		if g.addr != expected {
+			return nil, fmt.Errorf("devnet key %d derives %s, expected %s", keyIndex, g.addr.Hex(), expected.Hex())
+		}
+		g.name = common.DevnetGuardians[keyIndex].Name
+	}
+
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate p2p key: %w", err)
+	}
+	// The pubsub router runs until its context is cancelled, so each guardian gets its own to shut it down with.
+	g.ctx, g.cancel = context.WithCancel(n.ctx)
+	components := p2p.DefaultComponents()
+	components.ListeningAddressesPatterns = []string{"/ip4/127.0.0.1/udp/%d/quic-v1"}
+	components.Port = 0
+	g.host, err = p2p.NewHost(n.logger, g.ctx, n.cfg.NetworkID, n.bootstrap, components, priv)
+	if err != nil {
+		g.cancel()
+		return nil, fmt.Errorf("failed to create host for %s: %w", g.name, err)
+	}
+
+	if n.bootstrap == "" {
+		n.bootstrap, err = hostAddr(g.host)
+		if err != nil {
+			g.close()
+			return nil, err
+		}
+	} else {
+		info, err := peer.AddrInfoFromString(n.bootstrap)
+		if err != nil {
+			g.close()
+			return nil, err
+		}
+		if err := g.host.Connect(g.ctx, *info); err != nil {
+			g.close()
+			return nil, fmt.Errorf("failed to connect %s to the bootstrap peer: %w", g.name, err)
+		}
+	}
+
+	ps, err := pubsub.NewGossipSub(g.ctx, g.host)
+	if err != nil {
+		g.close()
+		return nil, fmt.Errorf("failed to create pubsub for %s: %w", g.name, err)
+	}
+	for _, name := range []string{topicControl, topicAttestation, topicVAA} {
+		t, err := ps.Join(fmt.Sprintf("%s/%s", n.cfg.NetworkID, name))
+		if err != nil {
+			g.close()
+			return nil, fmt.Errorf("failed to join %s for %s: %w", name, g.name, err)
+		}
+		g.topics[name] = t
+	}
+
+	n.mu.Lock()
+	n.guardians[keyIndex] = g
+	n.mu.Unlock()
+	return g, nil
+}
+
+// close leaves the topics joined so far, stops pubsub and shuts down the host.
+func (g *guardian) close() {
+	for _, t := range g.topics {
+		t.Close()
+	}
+	g.cancel()
+	g.host.Close()
+}
+
+func hostAddr(h host.Host) (string, error) {
+	for _, a := range h.Addrs() {
+		if strings.Contains(a.String(), "/udp/") {
+			return fmt.Sprintf("%s/p2p/%s", a, h.ID()), nil
+		}
+	}
+	return "", errors.New("host has no UDP listen address")
+}
+
+func (n *Network) loop(interval time.Duration, f func()) {
+	defer n.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	f()
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			f()
+		}
+	}
+}
+
+// NetworkID is the p2p network identifier consumers must use.
+func (n *Network) NetworkID() string {
+	return n.cfg.NetworkID
+}
+
+// Bootstrap is the bootstrap peer string consumers must use.
+func (n *Network) Bootstrap() string {
+	return n.bootstrap
+}
+
+// GuardianSet returns the current guardian set.
+func (n *Network) GuardianSet() *node_common.GuardianSet {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	keys := make([]eth_common.Address, len(n.members))
+	for i, m := range n.members {
+		keys[i] = n.guardians[m].addr
+	}
+	return &node_common.GuardianSet{Keys: keys, Index: n.setIndex}
+}
+
+// Close stops publishing and shuts down all the hosts.
+func (n *Network) Close() {
+	n.cancel()
+	n.wg.Wait()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, g := range n.guardians {
+		g.close()
+	}
+}
+
+// activeGuardians returns the members of the current set that are not silent, in guardian set order,
+// along with their index in the set. The caller must hold n.mu.
+func (n *Network) activeGuardians() ([]*guardian, []int) {
+	var gs []*guardian
+	var idx []int
+	for i, m := range n.members {
+		g := n.guardians[m]
+		if !g.silent {
+			gs = append(gs, g)
+			idx = append(idx, i)
+		}
+	}
+	return gs, idx
+}
+
+func (n *Network) publish(g *guardian, topic string, data []byte) {
+	if err := g.topics[topic].Publish(n.ctx, data); err != nil && n.ctx.Err() == nil {
+		n.logger.Warn("failed to publish", zap.String("guardian", g.name), zap.String("topic", topic), zap.Error(err))
+	}
+}
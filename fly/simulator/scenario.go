@@ -0,0 +1,157 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+)
+
+// SetSilent stops (or resumes) all publishing by the guardian with the given devnet key index.
+func (n *Network) SetSilent(keyIndex int, silent bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	g, ok := n.guardians[keyIndex]
+	if !ok {
+		return fmt.Errorf("guardian %d is not running", keyIndex)
+	}
+	g.silent = silent
+	return nil
+}
+
+// SetChainStalled stops (or resumes) a chain for every guardian: heights stop advancing and no messages are emitted.
+func (n *Network) SetChainStalled(chain vaa.ChainID, stalled bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stalledChains[chain] = stalled
+}
+
+// SetGuardianChainStalled stalls (or resumes) the watcher of a single guardian: its reported height stops advancing,
+// its error count grows, and it does not observe messages on the chain.
+func (n *Network) SetGuardianChainStalled(keyIndex int, chain vaa.ChainID, stalled bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	g, ok := n.guardians[keyIndex]
+	if !ok {
+		return fmt.Errorf("guardian %d is not running", keyIndex)
+	}
+	g.stalled[chain] = stalled
+	return nil
+}
+
+// RotateGuardianSet replaces the guardian set with the given devnet key indices and increments the set index.
+// Guardians that are not running yet are started. Guardians that leave the set keep running but stop publishing.
+func (n *Network) RotateGuardianSet(members []int) error {
+	if len(members) == 0 {
+		return fmt.Errorf("guardian set cannot be empty")
+	}
+	for _, m := range members {
+		n.mu.Lock()
+		_, ok := n.guardians[m]
+		n.mu.Unlock()
+		if !ok {
+			if _, err := n.startGuardian(m); err != nil {
+				return err
+			}
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.members = append([]int(nil), members...)
+	n.setIndex++
+	n.logger.Info("rotated guardian set", zap.Uint32("index", n.setIndex), zap.Ints("members", n.members))
+	return nil
+}
+
+// EnqueueGovernorVAAs adds count VAAs of the given notional value to the governor queue of a chain, as reported
+// in the governor status of every guardian, and reduces the remaining available notional accordingly.
+func (n *Network) EnqueueGovernorVAAs(chain vaa.ChainID, count int, notional uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	releaseTime := time.Now().Add(24 * time.Hour)
+	for i := 0; i < count; i++ {
+		n.sequences[chain]++
+		n.govQueue[chain] = append(n.govQueue[chain], enqueuedVAA{
+			sequence:      n.sequences[chain],
+			releaseTime:   releaseTime,
+			notionalValue: notional,
+		})
+		if n.notional[chain] > notional {
+			n.notional[chain] -= notional
+		} else {
+			n.notional[chain] = 0
+		}
+	}
+}
+
+// ReleaseGovernorVAAs empties the governor queue of a chain and restores its available notional.
+func (n *Network) ReleaseGovernorVAAs(chain vaa.ChainID) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.govQueue, chain)
+	n.notional[chain] = defaultNotionalLimit
+}
+
+// Step is an action applied to the network At a given time after the scenario starts.
+type Step struct {
+	At     time.Duration
+	Name   string
+	Action func(n *Network) error
+}
+
+// Run applies the steps in time order and returns once the last one has been applied,
+// or on the first error or cancellation.
+func (n *Network) Run(ctx context.Context, steps []Step) error {
+	steps = append([]Step(nil), steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+	start := time.Now()
+	for _, s := range steps {
+		if wait := time.Until(start.Add(s.At)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-n.ctx.Done():
+				return n.ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		n.logger.Info("applying scenario step", zap.String("step", s.Name), zap.Duration("at", s.At))
+		if err := s.Action(n); err != nil {
+			return fmt.Errorf("step %q failed: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// GoSilent is a Step that silences a guardian.
+func GoSilent(at time.Duration, keyIndex int) Step {
+	return Step{At: at, Name: fmt.Sprintf("guardian %d goes silent", keyIndex), Action: func(n *Network) error {
+		return n.SetSilent(keyIndex, true)
+	}}
+}
+
+// StallChain is a Step that stalls a chain for every guardian.
+func StallChain(at time.Duration, chain vaa.ChainID) Step {
+	return Step{At: at, Name: fmt.Sprintf("%s stalls", chain), Action: func(n *Network) error {
+		n.SetChainStalled(chain, true)
+		return nil
+	}}
+}
+
+// RotateSet is a Step that rotates the guardian set.
+func RotateSet(at time.Duration, members []int) Step {
+	return Step{At: at, Name: fmt.Sprintf("guardian set rotates to %v", members), Action: func(n *Network) error {
+		return n.RotateGuardianSet(members)
+	}}
+}
+
+// FillGovernorQueue is a Step that enqueues governed VAAs on a chain.
+func FillGovernorQueue(at time.Duration, chain vaa.ChainID, count int, notional uint64) Step {
+	return Step{At: at, Name: fmt.Sprintf("%d VAAs enqueued on %s", count, chain), Action: func(n *Network) error {
+		n.EnqueueGovernorVAAs(chain, count, notional)
+		return nil
+	}}
+}
@@ -0,0 +1,292 @@
+package simulator_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	"github.com/certusone/wormhole/node/pkg/p2p"
+	gossipv1 "github.com/certusone/wormhole/node/pkg/proto/gossip/v1"
+	"github.com/certusone/wormhole/node/pkg/supervisor"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/simulator"
+	"github.com/wormhole-foundation/wormhole/sdk/vaa"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// consumer receives the gossip of a simulated network through p2p.Run, like the fly tools do.
+type consumer struct {
+	gst        *node_common.GuardianSetState
+	heartbeatC chan *gossipv1.Heartbeat
+	batchObsvC chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch]
+	signedInC  chan *gossipv1.SignedVAAWithQuorum
+	govStatusC chan *gossipv1.SignedChainGovernorStatus
+}
+
+func startNetwork(t *testing.T, cfg simulator.Config) (*simulator.Network, *consumer) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("starts a simulated guardian network")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	n, err := simulator.Start(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Close)
+
+	c := &consumer{
+		heartbeatC: make(chan *gossipv1.Heartbeat, 1000),
+		batchObsvC: make(chan *node_common.MsgWithTimeStamp[gossipv1.SignedObservationBatch], 1000),
+		signedInC:  make(chan *gossipv1.SignedVAAWithQuorum, 1000),
+		govStatusC: make(chan *gossipv1.SignedChainGovernorStatus, 1000),
+	}
+	c.gst = node_common.NewGuardianSetState(c.heartbeatC)
+	c.gst.Set(n.GuardianSet())
+
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	components := p2p.DefaultComponents()
+	components.ListeningAddressesPatterns = []string{"/ip4/127.0.0.1/udp/%d/quic-v1"}
+	components.Port = 0
+	params, err := p2p.NewRunParams(
+		n.Bootstrap(),
+		n.NetworkID(),
+		priv,
+		c.gst,
+		cancel,
+		p2p.WithComponents(components),
+		p2p.WithSignedObservationBatchListener(c.batchObsvC),
+		p2p.WithSignedVAAListener(c.signedInC),
+		p2p.WithChainGovernorStatusListener(c.govStatusC),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supervisor.New(ctx, zap.NewNop(), func(ctx context.Context) error {
+		if err := supervisor.Run(ctx, "p2p", p2p.Run(params)); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	}, supervisor.WithPropagatePanic)
+	return n, c
+}
+
+// heartbeats collects the heartbeats received during d, by guardian address.
+func (c *consumer) heartbeats(d time.Duration) map[eth_common.Address][]*gossipv1.Heartbeat {
+	hbs := map[eth_common.Address][]*gossipv1.Heartbeat{}
+	for timeout := time.After(d); ; {
+		select {
+		case <-timeout:
+			return hbs
+		case hb := <-c.heartbeatC:
+			addr := eth_common.HexToAddress(hb.GuardianAddr)
+			hbs[addr] = append(hbs[addr], hb)
+		}
+	}
+}
+
+// observedChains collects the chains of the observations received during d.
+func (c *consumer) observedChains(d time.Duration) map[string]int {
+	chains := map[string]int{}
+	for timeout := time.After(d); ; {
+		select {
+		case <-timeout:
+			return chains
+		case b := <-c.batchObsvC:
+			for _, o := range b.Msg.Observations {
+				chains[strings.Split(o.MessageId, "/")[0]]++
+			}
+		}
+	}
+}
+
+// drain drops the messages received so far, so the next reads only see the effects of a step.
+func (c *consumer) drain() {
+	for {
+		select {
+		case <-c.heartbeatC:
+		case <-c.batchObsvC:
+		case <-c.signedInC:
+		case <-c.govStatusC:
+		default:
+			return
+		}
+	}
+}
+
+// waitForAll waits until every guardian of the set has been heard from, which means the mesh has formed.
+func (c *consumer) waitForAll(t *testing.T, keys []eth_common.Address) {
+	t.Helper()
+	seen := map[eth_common.Address]bool{}
+	for timeout := time.After(30 * time.Second); len(seen) < len(keys); {
+		select {
+		case <-timeout:
+			t.Fatalf("heard from %d of %d guardians", len(seen), len(keys))
+		case hb := <-c.heartbeatC:
+			seen[eth_common.HexToAddress(hb.GuardianAddr)] = true
+		}
+	}
+}
+
+// apply runs the steps and gives their effects time to settle before draining what was received until then.
+func apply(t *testing.T, n *simulator.Network, c *consumer, steps ...simulator.Step) {
+	t.Helper()
+	if err := n.Run(context.Background(), steps); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	c.drain()
+}
+
+func TestGoSilent(t *testing.T) {
+	n, c := startNetwork(t, simulator.Config{NumGuardians: 4, HeartbeatInterval: 100 * time.Millisecond})
+	keys := n.GuardianSet().Keys
+	c.waitForAll(t, keys)
+
+	apply(t, n, c, simulator.GoSilent(0, 1))
+	hbs := c.heartbeats(time.Second)
+	if len(hbs[keys[1]]) != 0 {
+		t.Errorf("received %d heartbeats from the silent guardian", len(hbs[keys[1]]))
+	}
+	for _, i := range []int{0, 2, 3} {
+		if len(hbs[keys[i]]) == 0 {
+			t.Errorf("received no heartbeat from guardian %d", i)
+		}
+	}
+}
+
+func TestStallChain(t *testing.T) {
+	n, c := startNetwork(t, simulator.Config{
+		NumGuardians:      4,
+		HeartbeatInterval: 100 * time.Millisecond,
+		MessageInterval:   100 * time.Millisecond,
+	})
+	keys := n.GuardianSet().Keys
+	c.waitForAll(t, keys)
+	if chains := c.observedChains(time.Second); chains[fmt.Sprint(uint16(vaa.ChainIDEthereum))] == 0 {
+		t.Fatalf("no Ethereum observation before the stall: %v", chains)
+	}
+
+	apply(t, n, c, simulator.StallChain(0, vaa.ChainIDEthereum))
+	hbs := c.heartbeats(time.Second)
+	heights := func(hb *gossipv1.Heartbeat) map[vaa.ChainID]int64 {
+		h := map[vaa.ChainID]int64{}
+		for _, net := range hb.Networks {
+			h[vaa.ChainID(net.Id)] = net.Height
+		}
+		return h
+	}
+	g0 := hbs[keys[0]]
+	if len(g0) < 2 {
+		t.Fatalf("received %d heartbeats from guardian 0, want at least 2", len(g0))
+	}
+	first, last := heights(g0[0]), heights(g0[len(g0)-1])
+	if first[vaa.ChainIDEthereum] != last[vaa.ChainIDEthereum] {
+		t.Errorf("Ethereum advanced from %d to %d while stalled", first[vaa.ChainIDEthereum], last[vaa.ChainIDEthereum])
+	}
+	if first[vaa.ChainIDSolana] >= last[vaa.ChainIDSolana] {
+		t.Errorf("Solana did not advance: %d to %d", first[vaa.ChainIDSolana], last[vaa.ChainIDSolana])
+	}
+
+	chains := c.observedChains(time.Second)
+	if chains[fmt.Sprint(uint16(vaa.ChainIDEthereum))] != 0 {
+		t.Errorf("received %d Ethereum observations while stalled", chains[fmt.Sprint(uint16(vaa.ChainIDEthereum))])
+	}
+	if chains[fmt.Sprint(uint16(vaa.ChainIDSolana))] == 0 {
+		t.Errorf("received no Solana observation")
+	}
+}
+
+func TestRotateSet(t *testing.T) {
+	n, c := startNetwork(t, simulator.Config{
+		NumGuardians:      4,
+		HeartbeatInterval: 100 * time.Millisecond,
+		MessageInterval:   100 * time.Millisecond,
+	})
+	c.waitForAll(t, n.GuardianSet().Keys)
+
+	apply(t, n, c, simulator.RotateSet(0, []int{0, 1, 2, 4}))
+	gs := n.GuardianSet()
+	if gs.Index != 1 {
+		t.Errorf("guardian set index = %d, want 1", gs.Index)
+	}
+	if want := eth_common.HexToAddress(common.DevnetGuardians[4].Address); len(gs.Keys) != 4 || gs.Keys[3] != want {
+		t.Fatalf("guardian set = %v, want guardian 4 last", gs.Keys)
+	}
+	// Consumers learn the new set from the chain. p2p.Run drops heartbeats of guardians outside the set it knows.
+	c.gst.Set(gs)
+	c.waitForAll(t, gs.Keys)
+
+	for timeout := time.After(10 * time.Second); ; {
+		select {
+		case <-timeout:
+			t.Fatal("received no VAA signed by the new guardian set")
+		case m := <-c.signedInC:
+			v, err := vaa.Unmarshal(m.Vaa)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.GuardianSetIndex != gs.Index {
+				continue
+			}
+			if err := v.Verify(gs.Keys); err != nil {
+				t.Fatalf("VAA of the new set does not verify: %v", err)
+			}
+			return
+		}
+	}
+}
+
+func TestFillGovernorQueue(t *testing.T) {
+	n, c := startNetwork(t, simulator.Config{
+		NumGuardians:      4,
+		HeartbeatInterval: 100 * time.Millisecond,
+		GovernorInterval:  100 * time.Millisecond,
+	})
+	c.waitForAll(t, n.GuardianSet().Keys)
+
+	apply(t, n, c, simulator.FillGovernorQueue(0, vaa.ChainIDEthereum, 3, 1_000_000))
+	for timeout := time.After(10 * time.Second); ; {
+		select {
+		case <-timeout:
+			t.Fatal("received no governor status with the enqueued VAAs")
+		case m := <-c.govStatusC:
+			var s gossipv1.ChainGovernorStatus
+			if err := proto.Unmarshal(m.Status, &s); err != nil {
+				t.Fatal(err)
+			}
+			for _, chain := range s.Chains {
+				if vaa.ChainID(chain.ChainId) != vaa.ChainIDEthereum {
+					continue
+				}
+				if len(chain.Emitters) != 1 || chain.Emitters[0].TotalEnqueuedVaas != 3 {
+					t.Fatalf("Ethereum emitters = %v, want 3 enqueued VAAs", chain.Emitters)
+				}
+				if chain.RemainingAvailableNotional != 50_000_000-3*1_000_000 {
+					t.Errorf("remaining notional = %d, want %d", chain.RemainingAvailableNotional, 50_000_000-3*1_000_000)
+				}
+				return
+			}
+		}
+	}
+}
+
+func TestRunFailingStep(t *testing.T) {
+	n, _ := startNetwork(t, simulator.Config{NumGuardians: 1})
+	err := n.Run(context.Background(), []simulator.Step{simulator.GoSilent(0, 7)})
+	if err == nil || !strings.Contains(err.Error(), "guardian 7 goes silent") {
+		t.Errorf("Run returned %v, want the failed step", err)
+	}
+}
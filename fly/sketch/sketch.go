@@ -0,0 +1,211 @@
+// Package sketch provides streaming quantile estimates with bounded memory, over all values or a sliding time window.
+package sketch
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// minValue is the smallest value told apart from zero. Values below it, including negative ones, count as zero.
+const minValue = 1e-9
+
+// Sketch estimates quantiles in the manner of DDSketch: values are counted in logarithmic buckets, so every quantile
+// is within the relative accuracy of the true value, and sketches with the same accuracy can be merged.
+// The maximum and the sum are exact. It is not safe for concurrent use.
+type Sketch struct {
+	accuracy float64
+	gamma    float64
+	logGamma float64
+	counts   map[int]uint64
+	zeros    uint64
+	count    uint64
+	sum      float64
+	max      float64
+}
+
+// New creates a sketch with the given relative accuracy, e.g. 0.01 for 1%.
+func New(relativeAccuracy float64) *Sketch {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &Sketch{accuracy: relativeAccuracy, gamma: gamma, logGamma: math.Log(gamma), counts: map[int]uint64{}}
+}
+
+func (s *Sketch) Add(v float64) {
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+	if v < minValue {
+		s.zeros++
+		return
+	}
+	s.counts[int(math.Ceil(math.Log(v)/s.logGamma))]++
+}
+
+// Merge adds the values of o, which must have the same accuracy.
+func (s *Sketch) Merge(o *Sketch) {
+	if o.count == 0 {
+		return
+	}
+	if s.count == 0 || o.max > s.max {
+		s.max = o.max
+	}
+	s.count += o.count
+	s.sum += o.sum
+	s.zeros += o.zeros
+	for k, c := range o.counts {
+		s.counts[k] += c
+	}
+}
+
+func (s *Sketch) Reset() {
+	clear(s.counts)
+	s.zeros, s.count, s.sum, s.max = 0, 0, 0, 0
+}
+
+func (s *Sketch) Accuracy() float64 {
+	return s.accuracy
+}
+
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+// Mean returns the mean of the values added, or 0 if the sketch is empty.
+func (s *Sketch) Mean() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+// Max returns the largest value added, or 0 if the sketch is empty.
+func (s *Sketch) Max() float64 {
+	return s.max
+}
+
+// Quantile estimates the q quantile, 0 <= q <= 1. It returns 0 if the sketch is empty.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	if q >= 1 {
+		return s.max
+	}
+	rank := uint64(q * float64(s.count-1))
+	if rank < s.zeros {
+		return 0
+	}
+	keys := make([]int, 0, len(s.counts))
+	for k := range s.counts {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	cum := s.zeros
+	for _, k := range keys {
+		cum += s.counts[k]
+		if cum > rank {
+			// The middle of the bucket, in relative terms, which bounds the error on either side.
+			return math.Min(2*math.Pow(s.gamma, float64(k))/(s.gamma+1), s.max)
+		}
+	}
+	return s.max
+}
+
+// sketchJSON is the persisted form of a sketch.
+type sketchJSON struct {
+	Accuracy float64        `json:"accuracy"`
+	Counts   map[int]uint64 `json:"counts"`
+	Zeros    uint64         `json:"zeros"`
+	Count    uint64         `json:"count"`
+	Sum      float64        `json:"sum"`
+	Max      float64        `json:"max"`
+}
+
+func (s *Sketch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sketchJSON{Accuracy: s.accuracy, Counts: s.counts, Zeros: s.zeros, Count: s.count, Sum: s.sum, Max: s.max})
+}
+
+// UnmarshalJSON restores a sketch with the accuracy it was saved with.
+func (s *Sketch) UnmarshalJSON(b []byte) error {
+	var j sketchJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if j.Accuracy <= 0 || j.Accuracy >= 1 {
+		return errors.New("sketch accuracy must be between 0 and 1")
+	}
+	*s = *New(j.Accuracy)
+	for k, c := range j.Counts {
+		s.counts[k] = c
+	}
+	s.zeros, s.count, s.sum, s.max = j.Zeros, j.Count, j.Sum, j.Max
+	return nil
+}
+
+// Window estimates quantiles over the values added in a sliding time window. The window is divided in slots,
+// each with its own sketch, and slides one slot at a time: it covers between width minus one slot and width.
+// It is safe for concurrent use.
+type Window struct {
+	width    time.Duration
+	slot     time.Duration
+	accuracy float64
+
+	mu     sync.Mutex
+	slots  []*Sketch
+	starts []time.Time
+}
+
+// NewWindow creates a window of the given width divided in the given number of slots.
+func NewWindow(width time.Duration, slots int, relativeAccuracy float64) *Window {
+	w := &Window{
+		width:    width,
+		slot:     width / time.Duration(slots),
+		accuracy: relativeAccuracy,
+		slots:    make([]*Sketch, slots),
+		starts:   make([]time.Time, slots),
+	}
+	for i := range w.slots {
+		w.slots[i] = New(relativeAccuracy)
+	}
+	return w
+}
+
+func (w *Window) Width() time.Duration {
+	return w.width
+}
+
+// Add records a value at time t. Values older than the window are dropped.
+func (w *Window) Add(t time.Time, v float64) {
+	start := t.Truncate(w.slot)
+	i := int((start.UnixNano() / int64(w.slot)) % int64(len(w.slots)))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case start.Before(w.starts[i]):
+		return
+	case start.After(w.starts[i]):
+		// The slot held values from a previous turn of the ring.
+		w.slots[i].Reset()
+		w.starts[i] = start
+	}
+	w.slots[i].Add(v)
+}
+
+// Snapshot merges the slots still in the window at now into a new sketch.
+func (w *Window) Snapshot(now time.Time) *Sketch {
+	s := New(w.accuracy)
+	cutoff := now.Add(-w.width)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, slot := range w.slots {
+		if w.starts[i].After(cutoff) {
+			s.Merge(slot)
+		}
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package sketch
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestQuantileAccuracy(t *testing.T) {
+	s := New(0.01)
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		want := q * 999
+		if got := s.Quantile(q); math.Abs(got-want) > 0.01*want+1 {
+			t.Errorf("Quantile(%v) = %v, want about %v", q, got, want)
+		}
+	}
+	if s.Quantile(1) != 1000 || s.Max() != 1000 {
+		t.Errorf("max = %v, want 1000", s.Quantile(1))
+	}
+	if s.Mean() != 500.5 {
+		t.Errorf("mean = %v, want 500.5", s.Mean())
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	s := New(0.02)
+	for _, v := range []float64{0, 0.001, 0.5, 1, 42, 1e6} {
+		s.Add(v)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Sketch
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Accuracy() != 0.02 || got.Count() != s.Count() || got.Mean() != s.Mean() || got.Max() != s.Max() {
+		t.Fatalf("restored sketch = %+v, want %+v", got, *s)
+	}
+	for _, q := range []float64{0, 0.25, 0.5, 0.75, 0.99} {
+		if got.Quantile(q) != s.Quantile(q) {
+			t.Errorf("restored Quantile(%v) = %v, want %v", q, got.Quantile(q), s.Quantile(q))
+		}
+	}
+	// The restored sketch keeps working.
+	got.Merge(s)
+	if got.Count() != 2*s.Count() {
+		t.Errorf("count after merge = %d, want %d", got.Count(), 2*s.Count())
+	}
+
+	if err := json.Unmarshal([]byte(`{"accuracy": 0}`), &got); err == nil {
+		t.Error("a sketch without accuracy was restored")
+	}
+}
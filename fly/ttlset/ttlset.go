@@ -0,0 +1,144 @@
+// Package ttlset provides a bounded, concurrent set of keys that expire, for deduplicating gossip messages
+// by hash or digest with predictable memory use.
+package ttlset
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	setSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ttlset_size",
+		Help: "The number of keys in the dedup set",
+	}, []string{"set"})
+	setEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ttlset_evictions_total",
+		Help: "The number of keys evicted from the dedup set, by reason (expired or capacity)",
+	}, []string{"set", "reason"})
+)
+
+type entry struct {
+	key      string
+	lastSeen time.Time
+}
+
+// Set remembers keys for ttl after they were last added. Once it holds maxSize keys, adding a new key evicts
+// the least recently added one. Expired keys are evicted by Run, and are never reported as present.
+type Set struct {
+	name    string
+	ttl     time.Duration
+	maxSize int
+	now     func() time.Time
+
+	mu sync.Mutex
+	// order holds the entries from least to most recently added, so both kinds of eviction start at the front.
+	order *list.List
+	byKey map[string]*list.Element
+
+	size              prometheus.Gauge
+	expiredEvictions  prometheus.Counter
+	capacityEvictions prometheus.Counter
+}
+
+// New creates a set. The name labels its metrics and must be unique within the process.
+// A maxSize of 0 or less means the set is only bounded by ttl.
+func New(name string, ttl time.Duration, maxSize int) *Set {
+	return &Set{
+		name:              name,
+		ttl:               ttl,
+		maxSize:           maxSize,
+		now:               time.Now,
+		order:             list.New(),
+		byKey:             map[string]*list.Element{},
+		size:              setSize.WithLabelValues(name),
+		expiredEvictions:  setEvictions.WithLabelValues(name, "expired"),
+		capacityEvictions: setEvictions.WithLabelValues(name, "capacity"),
+	}
+}
+
+// Add inserts key, or refreshes its expiry if it is already present. It returns true if the key was not present.
+func (s *Set) Add(key string) bool {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.byKey[key]; ok {
+		e := el.Value.(*entry)
+		expired := now.Sub(e.lastSeen) > s.ttl
+		e.lastSeen = now
+		s.order.MoveToBack(el)
+		if expired {
+			// Run hasn't got to it yet, but it was gone as far as callers are concerned.
+			s.expiredEvictions.Inc()
+		}
+		return expired
+	}
+	if s.maxSize > 0 && s.order.Len() >= s.maxSize {
+		s.removeFront()
+		s.capacityEvictions.Inc()
+	}
+	s.byKey[key] = s.order.PushBack(&entry{key: key, lastSeen: now})
+	s.size.Set(float64(s.order.Len()))
+	return true
+}
+
+// Contains reports whether key was added less than ttl ago, without refreshing it.
+func (s *Set) Contains(key string) bool {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.byKey[key]
+	return ok && now.Sub(el.Value.(*entry).lastSeen) <= s.ttl
+}
+
+// Len returns the number of keys held, including expired keys that have not been evicted yet.
+func (s *Set) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// Evict removes the expired keys and returns how many there were.
+func (s *Set) Evict() int {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evicted := 0
+	for el := s.order.Front(); el != nil && now.Sub(el.Value.(*entry).lastSeen) > s.ttl; el = s.order.Front() {
+		s.removeFront()
+		evicted++
+	}
+	s.expiredEvictions.Add(float64(evicted))
+	s.size.Set(float64(s.order.Len()))
+	return evicted
+}
+
+// Run evicts expired keys every interval until the context is cancelled.
+// Each eviction only visits the expired keys, so it holds the lock briefly even for large sets.
+func (s *Set) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Evict()
+		}
+	}
+}
+
+// removeFront must be called with s.mu held.
+func (s *Set) removeFront() {
+	el := s.order.Front()
+	if el == nil {
+		return
+	}
+	s.order.Remove(el)
+	delete(s.byKey, el.Value.(*entry).key)
+}
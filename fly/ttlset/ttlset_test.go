@@ -0,0 +1,217 @@
+package ttlset
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// clock is a fake time source that is safe to advance while Run reads it.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestSet creates a set on a fake clock, with its metrics reset.
+func newTestSet(name string, ttl time.Duration, maxSize int) (*Set, *clock) {
+	setSize.DeleteLabelValues(name)
+	setEvictions.DeleteLabelValues(name, "expired")
+	setEvictions.DeleteLabelValues(name, "capacity")
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := New(name, ttl, maxSize)
+	s.now = c.Now
+	return s, c
+}
+
+func value(t *testing.T, m prometheus.Metric) float64 {
+	t.Helper()
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		t.Fatal(err)
+	}
+	if pb.Gauge != nil {
+		return pb.GetGauge().GetValue()
+	}
+	return pb.GetCounter().GetValue()
+}
+
+// keys returns the keys of the set from the least to the most recently added.
+func keys(s *Set) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for el := s.order.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry).key)
+	}
+	return keys
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddContains(t *testing.T) {
+	s, c := newTestSet("test_add_contains", time.Minute, 0)
+	if !s.Add("a") {
+		t.Error("Add of a new key = false, want true")
+	}
+	if s.Add("a") {
+		t.Error("Add of a present key = true, want false")
+	}
+	if !s.Contains("a") || s.Contains("b") {
+		t.Error("Contains does not match the added keys")
+	}
+
+	c.advance(time.Minute + time.Second)
+	if s.Contains("a") {
+		t.Error("Contains of an expired key = true, want false")
+	}
+	if got := s.Len(); got != 1 {
+		t.Errorf("Len = %d, want 1 until the key is evicted", got)
+	}
+	// An expired key that hasn't been evicted yet is new again.
+	if !s.Add("a") {
+		t.Error("Add of an expired key = false, want true")
+	}
+	if got := value(t, s.expiredEvictions); got != 1 {
+		t.Errorf("expired evictions = %v, want 1", got)
+	}
+}
+
+func TestRefreshMovesToBack(t *testing.T) {
+	s, c := newTestSet("test_refresh", time.Minute, 0)
+	for _, k := range []string{"a", "b", "c"} {
+		s.Add(k)
+		c.advance(time.Second)
+	}
+	s.Add("a")
+	if got, want := keys(s), []string{"b", "c", "a"}; !equal(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+
+	// The refreshed key expires a minute after it was refreshed, not after it was first added.
+	c.advance(time.Minute)
+	if got := s.Evict(); got != 2 {
+		t.Errorf("Evict = %d, want 2", got)
+	}
+	if got, want := keys(s), []string{"a"}; !equal(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+	// Contains doesn't refresh.
+	c.advance(2 * time.Second)
+	s.Contains("a")
+	if got := s.Evict(); got != 1 {
+		t.Errorf("Evict = %d, want 1", got)
+	}
+}
+
+func TestRunExpires(t *testing.T) {
+	s, c := newTestSet("test_run", time.Minute, 0)
+	s.Add("a")
+	s.Add("b")
+	c.advance(30 * time.Second)
+	s.Add("c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	c.advance(31 * time.Second)
+	for deadline := time.Now().Add(5 * time.Second); s.Len() != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("keys = %v after the ttl, want [c]", keys(s))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got, want := keys(s), []string{"c"}; !equal(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+	if got := value(t, s.size); got != 1 {
+		t.Errorf("size = %v, want 1", got)
+	}
+	if got := value(t, s.expiredEvictions); got != 2 {
+		t.Errorf("expired evictions = %v, want 2", got)
+	}
+}
+
+func TestCapacityEviction(t *testing.T) {
+	s, c := newTestSet("test_capacity", time.Minute, 3)
+	for _, k := range []string{"a", "b", "c"} {
+		s.Add(k)
+		c.advance(time.Second)
+	}
+	// Refreshing b makes a then c the least recently added.
+	s.Add("b")
+	s.Add("d")
+	s.Add("e")
+	if got, want := keys(s), []string{"b", "d", "e"}; !equal(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+	if s.Contains("a") || s.Contains("c") {
+		t.Error("evicted keys are still present")
+	}
+	if got := value(t, s.size); got != 3 {
+		t.Errorf("size = %v, want 3", got)
+	}
+	if got := value(t, s.capacityEvictions); got != 2 {
+		t.Errorf("capacity evictions = %v, want 2", got)
+	}
+	if got := value(t, s.expiredEvictions); got != 0 {
+		t.Errorf("expired evictions = %v, want 0", got)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	s := New("test_concurrent", time.Minute, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := string(rune('a'+g)) + string(rune(i))
+				s.Add(k)
+				s.Contains(k)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if got := s.Len(); got != 100 {
+		t.Errorf("Len = %d, want the capacity of 100", got)
+	}
+}
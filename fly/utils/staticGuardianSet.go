@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+
+	node_common "github.com/certusone/wormhole/node/pkg/common"
+	"github.com/certusone/wormhole/node/pkg/watchers/evm/connectors/ethabi"
+	eth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/wormhole-foundation/wormhole-monitor/fly/common"
+)
+
+// StaticGuardianSet returns the index and the keys of the known guardian set of an environment, for use when the chain
+// can't be queried (e.g. offline replays). The keys are ordered by the index of the guardians.
+func StaticGuardianSet(env node_common.Environment) (uint32, *ethabi.StructsGuardianSet, error) {
+	var index uint32
+	var guardians []common.GuardianEntry
+	switch env {
+	case node_common.MainNet:
+		index, guardians = common.MainnetGuardianSetIndex, common.MainnetGuardians
+	case node_common.TestNet:
+		index, guardians = common.TestnetGuardianSetIndex, common.TestnetGuardians
+	case node_common.UnsafeDevNet:
+		index, guardians = common.DevnetGuardianSetIndex, common.DevnetGuardians
+	default:
+		return 0, nil, fmt.Errorf("no known guardian set for environment %q", env)
+	}
+	keys := make([]eth_common.Address, len(guardians))
+	for _, g := range guardians {
+		if g.Index >= 0 && g.Index < len(keys) {
+			keys[g.Index] = eth_common.HexToAddress(g.Address)
+		}
+	}
+	return index, &ethabi.StructsGuardianSet{Keys: keys}, nil
+}
+
+// GuardianSet returns the index and the keys of the guardian set to verify messages with: the known set of the
+// environment when offline, otherwise the current set of the core bridge at coreBridgeAddr.
+func GuardianSet(env node_common.Environment, offline bool, rpcUrl string, coreBridgeAddr string) (uint32, *ethabi.StructsGuardianSet, error) {
+	if offline {
+		return StaticGuardianSet(env)
+	}
+	return FetchCurrentGuardianSet(rpcUrl, coreBridgeAddr)
+}
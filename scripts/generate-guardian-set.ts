@@ -106,6 +106,9 @@ package common
 
 import "strings"
 
+// MainnetGuardianSetIndex is the index of the guardian set in mainnetv2/v${VERSION}.prototxt, which starts at v1 for index 0.
+const MainnetGuardianSetIndex uint32 = ${VERSION - 1}
+
 var MainnetGuardians = []GuardianEntry{
 ${sliceEntries},
 }